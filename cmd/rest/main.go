@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,14 +10,26 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
 	"github.com/AlejandroHerr/go-common/pkg/logging"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
 	"github.com/AlejandroHerr/go-idasen-desk/internal/ble"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/certs"
 	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/history"
 	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/ratelimit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/recording"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/registry"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/reminders"
 	"github.com/AlejandroHerr/go-idasen-desk/internal/restapi"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/scheduler"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/webhooks"
 	"github.com/AlejandroHerr/go-idasen-desk/version"
 	goble "github.com/go-ble/ble"
 )
@@ -47,59 +60,274 @@ func run(pctx context.Context, logger *slog.Logger) error {
 	ctx, cancelCtx := context.WithCancel(pctx)
 	defer cancelCtx()
 
-	cfg, err := loadConfig(logger)
+	appCfg, err := loadConfig(logger)
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
 	}
 
-	dev, err := ble.NewDevice("default")
+	cfg := &appCfg.Rest
+
+	adapters, err := openAdapters(appCfg.Bluetooth)
 	if err != nil {
-		return fmt.Errorf("new device: %w", err)
+		return fmt.Errorf("opening adapters: %w", err)
 	}
 
 	defer func() {
-		logger.InfoContext(ctx, "Shutting down device...")
-
-		if err = dev.Stop(); err != nil {
-			logger.ErrorContext(ctx, "Error stopping device", slog.String("error", err.Error()))
+		logger.InfoContext(ctx, "Shutting down devices...")
+
+		for _, adapter := range adapters {
+			if err = adapter.device.Stop(); err != nil {
+				logger.ErrorContext(
+					ctx,
+					"Error stopping device",
+					slog.String("adapter", adapter.name),
+					slog.String("error", err.Error()),
+				)
+			}
 		}
 	}()
 
+	dev := adapters[0].device
+
 	goble.SetDefaultDevice(dev)
 
-	manager := idasen.NewManager(ctx, ble.NewDeskClientFunc(dev, logger), logger)
+	var gattCache *ble.CharacteristicCache
+	if appCfg.Bluetooth.CacheCharacteristics {
+		gattCache = ble.NewCharacteristicCache()
+	}
+
+	// Reminders and schedules observe the desks, so they are created before the manager they move the desks with,
+	// and so is the registry, as adopted desks are configured like the others
+	desks := &managerRef{manager: nil}
+
+	deskRegistry, err := newRegistry(appCfg, desks, logger)
+	if err != nil {
+		return fmt.Errorf("loading desk registry: %w", err)
+	}
+
+	// Adopted desks are added to the desk settings as soon as they are adopted
+	deskSettings := func() config.DesksConfig { return appCfg.Desks }
+	if deskRegistry != nil {
+		deskSettings = deskRegistry.DesksConfig
+	}
+
+	historyStore, err := newHistoryStore(appCfg.History, logger)
+	if err != nil {
+		return fmt.Errorf("creating history store: %w", err)
+	}
+
+	defer func() {
+		if err = historyStore.Close(); err != nil {
+			logger.ErrorContext(ctx, "Error closing history store", slog.String("error", err.Error()))
+		}
+	}()
+
+	go historyStore.Run(ctx)
+
+	managerOpts, err := newManagerOptions(appCfg, adapters, gattCache, logger)
+	if err != nil {
+		return fmt.Errorf("assigning adapters: %w", err)
+	}
+
+	if appCfg.History != nil {
+		recorder := history.NewRecorder(historyStore, appCfg.History.SettleDelay, logger)
+		defer recorder.Close()
+
+		managerOpts = append(managerOpts, idasen.ManagerOptionsWithDeskServiceOptions(
+			idasen.DeskServiceOptionsWithHeightObserver(recorder.Observe),
+		))
+	}
+
+	auditLog, err := newAuditLog(appCfg.Audit)
+	if err != nil {
+		return fmt.Errorf("creating audit log: %w", err)
+	}
+
 	defer func() {
-		logger.InfoContext(ctx, "Shutting down manager...")
+		if err = auditLog.Close(); err != nil {
+			logger.ErrorContext(ctx, "Error closing audit log", slog.String("error", err.Error()))
+		}
+	}()
 
+	// Schedules and auto stands leave the desks leased to someone alone
+	leases := newLeaseStore(appCfg.Leases)
+
+	reminderEngine, reminderEvents, err := newReminders(appCfg, deskSettings, desks, leases, logger)
+	if err != nil {
+		return fmt.Errorf("creating reminders: %w", err)
+	}
+
+	if reminderEngine != nil {
+		defer func() {
+			if err = reminderEngine.Close(); err != nil {
+				logger.ErrorContext(ctx, "Error closing reminders", slog.String("error", err.Error()))
+			}
+		}()
+
+		managerOpts = append(
+			managerOpts,
+			idasen.ManagerOptionsWithEventObserver(reminderEngine.HandleEvent),
+			idasen.ManagerOptionsWithDeskServiceOptions(
+				idasen.DeskServiceOptionsWithHeightObserver(reminderEngine.Observe),
+			),
+		)
+	}
+
+	deskScheduler, err := newScheduler(appCfg, deskSettings, desks, leases, auditLog, logger)
+	if err != nil {
+		return fmt.Errorf("creating scheduler: %w", err)
+	}
+
+	if deskScheduler != nil {
+		managerOpts = append(managerOpts, idasen.ManagerOptionsWithDeskServiceOptions(
+			idasen.DeskServiceOptionsWithHeightObserver(deskScheduler.Observe),
+		))
+	}
+
+	webhookDispatcher, err := newWebhookDispatcher(appCfg, deskSettings, logger)
+	if err != nil {
+		return fmt.Errorf("creating webhooks: %w", err)
+	}
+
+	if webhookDispatcher != nil {
+		go webhookDispatcher.Run(ctx)
+
+		managerOpts = append(
+			managerOpts,
+			idasen.ManagerOptionsWithEventObserver(webhookDispatcher.HandleEvent),
+			idasen.ManagerOptionsWithDeskServiceOptions(
+				idasen.DeskServiceOptionsWithHeightObserver(webhookDispatcher.Observe),
+			),
+		)
+	}
+
+	discovery := newDiscovery(appCfg.Discovery, adapters, desks, webhookDispatcher, logger)
+	if discovery != nil && len(adapters) > 1 {
+		managerOpts = append(managerOpts, idasen.ManagerOptionsWithAdapterSelector(discovery.Adapter))
+	}
+
+	// Desks outlive ctx so they can still be stopped during shutdown
+	managerCtx, cancelManager := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelManager()
+
+	manager := idasen.NewManager(managerCtx, newBTClient(dev, appCfg, gattCache, logger), logger, managerOpts...)
+	desks.manager = manager
+
+	defer func() {
 		if err = manager.Close(); err != nil {
 			logger.ErrorContext(ctx, "Error closing manager", slog.String("error", err.Error()))
 		}
 	}()
 
-	handler := restapi.NewHandler(cfg.AuthTokens, manager, logger)
+	authValidators, err := newAuthValidators(ctx, cfg, logger)
+	if err != nil {
+		return fmt.Errorf("creating auth validators: %w", err)
+	}
+
+	handler := restapi.NewHandler(restapi.Services{
+		AuthValidators: authValidators,
+		Manager:        manager,
+		Audit:          auditLog,
+		MoveLimiter:    newMoveLimiter(cfg.RateLimit),
+		History:        historyStore,
+		Reminders:      reminderEngine,
+		ReminderEvents: reminderEvents,
+		Scheduler:      deskScheduler,
+		Webhooks:       webhookDispatcher,
+		Discovery:      discovery,
+		Registry:       deskRegistry,
+		Desks:          deskSettings,
+		Leases:         leases,
+	}, logger)
+
+	tlsConfig, err := newTLSConfig(ctx, cfg, logger)
+	if err != nil {
+		return fmt.Errorf("creating tls config: %w", err)
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		TLSConfig:         tlsConfig,
+	}
+
+	if reminderEvents != nil {
+		// Event streams never finish on their own, so end them before waiting for in-flight requests
+		server.RegisterOnShutdown(func() {
+			reminderEvents.Close() //nolint:errcheck,gosec // never fails
+		})
+	}
+
+	if reminderEngine != nil {
+		go reminderEngine.Run(ctx)
+	}
+
+	if deskScheduler != nil {
+		go deskScheduler.Run(ctx)
+	}
+
+	if discovery != nil {
+		go discovery.Run(ctx)
+	}
 
 	serverResult := make(chan error, 1)
-	defer close(serverResult)
 
-	go startServer(ctx, cfg.Port, serverResult, handler, logger)
+	go startServer(ctx, server, serverResult, logger)
 
 	select {
 	case err = <-serverResult:
-		if err != nil {
-			return fmt.Errorf("starting server: %w", err)
-		}
+		return fmt.Errorf("starting server: %w", err)
 	case <-ctx.Done():
-		logger.InfoContext(ctx, "Shutting down...")
+	}
 
-		return nil
+	return shutdown(server, manager, cfg.ShutdownTimeout, logger)
+}
+
+// shutdown stops the service in order: new moves are rejected, moving desks are stopped, in-flight requests are
+// waited for up to timeout, subscriptions are ended and finally the desks are disconnected.
+func shutdown(server *http.Server, manager *idasen.Manager, timeout time.Duration, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+
+	logger.InfoContext(ctx, "Shutting down: rejecting new moves")
+	manager.Drain()
+
+	logger.InfoContext(ctx, "Shutting down: stopping moving desks")
+
+	if err := manager.StopMoving(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("stopping desks: %w", err))
+	}
+
+	logger.InfoContext(ctx, "Shutting down: waiting for in-flight requests", slog.Duration("timeout", timeout))
+
+	if err := server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("shutting down server: %w", err))
+	}
+
+	logger.InfoContext(ctx, "Shutting down: unsubscribing")
+	manager.UnsubscribeAll()
+
+	logger.InfoContext(ctx, "Shutting down: disconnecting desks")
+
+	if err := manager.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("closing manager: %w", err))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
 	}
 
+	logger.InfoContext(ctx, "Shutdown complete")
+
 	return nil
 }
 
 const defaultConfigPath = "/etc/go-idasen-desk/config.yaml"
 
-func loadConfig(logger *slog.Logger) (*config.RestConfig, error) {
+func loadConfig(logger *slog.Logger) (*config.Config, error) {
 	configPath := flag.String("config", defaultConfigPath, "Path to the config file")
 	flag.Parse()
 
@@ -108,42 +336,375 @@ func loadConfig(logger *slog.Logger) (*config.RestConfig, error) {
 		return nil, fmt.Errorf("loading config: %w", err)
 	}
 
-	return &cfg.Rest, nil
+	return cfg, nil
 }
 
-const defaultReadHeaderTimeout = 5 * time.Minute
+// openAdapters opens every configured adapter, or the default one when none is configured. The first one is the
+// default adapter.
+func openAdapters(cfg config.BluetoothConfig) ([]adapter, error) {
+	names := cfg.Adapters
+	if len(names) == 0 {
+		names = []string{ble.DefaultAdapter}
+	}
 
-func startServer(ctx context.Context, port int, resultCh chan<- error, handler http.Handler, logger *slog.Logger) {
-	server := &http.Server{
-		Addr:              fmt.Sprintf(":%d", port),
-		Handler:           handler,
-		ReadHeaderTimeout: defaultReadHeaderTimeout,
+	adapters := make([]adapter, 0, len(names))
+
+	for _, name := range names {
+		dev, err := ble.NewDevice(name)
+		if err != nil {
+			for _, opened := range adapters {
+				opened.device.Stop() //nolint:errcheck,gosec // opening error is returned
+			}
+
+			return nil, fmt.Errorf("new device %s: %w", name, err)
+		}
+
+		adapters = append(adapters, adapter{name: name, device: dev})
 	}
 
-	defer func() {
-		logger.InfoContext(ctx, "Shutting down server...")
+	return adapters, nil
+}
+
+func newManagerOptions(
+	cfg *config.Config,
+	adapters []adapter,
+	gattCache *ble.CharacteristicCache,
+	logger *slog.Logger,
+) ([]idasen.ManagerOption, error) {
+	opts := []idasen.ManagerOption{idasen.ManagerOptionsWithIdleTimeout(cfg.Desks.IdleTimeout)}
+
+	for _, adapter := range adapters {
+		opts = append(opts, idasen.ManagerOptionsWithAdapter(
+			adapter.name,
+			newBTClient(adapter.device, cfg, gattCache, logger),
+		))
+	}
 
-		if err := server.Shutdown(ctx); err != nil {
-			logger.ErrorContext(ctx, "Error shutting down server", slog.String("error", err.Error()))
+	for _, desk := range cfg.Desks.Devices {
+		if desk.IdleTimeout != nil {
+			opts = append(opts, idasen.ManagerOptionsWithDeskIdleTimeout(desk.ID, *desk.IdleTimeout))
 		}
-	}()
 
-	errCh := make(chan error, 1)
+		if desk.Adapter == "" {
+			continue
+		}
+
+		if !slices.ContainsFunc(adapters, func(a adapter) bool { return a.name == desk.Adapter }) {
+			return nil, fmt.Errorf("%w: %s of desk %s", idasen.ErrUnknownAdapter, desk.Adapter, desk.ID)
+		}
+
+		opts = append(opts, idasen.ManagerOptionsWithDeskAdapter(desk.ID, desk.Adapter))
+	}
+
+	return opts, nil
+}
+
+// newBTClient connects to desks through the device, recording their traffic when recording is configured. The
+// characteristics of the desks are cached when gattCache is not nil.
+func newBTClient(
+	dev goble.Device,
+	cfg *config.Config,
+	gattCache *ble.CharacteristicCache,
+	logger *slog.Logger,
+) idasen.NewBTClient {
+	opts := []ble.DeskClientOption{ble.DeskClientOptionsWithWakeTimeout(cfg.Bluetooth.WakeTimeout)}
+	if gattCache != nil {
+		opts = append(opts, ble.DeskClientOptionsWithCache(gattCache))
+	}
+
+	newDeskClient := ble.NewDeskClientFunc(dev, logger, opts...)
+	if cfg.Recording == nil {
+		return newDeskClient
+	}
+
+	return recording.NewBTClientFunc(newDeskClient, cfg.Recording.Dir, logger)
+}
+
+// newAuditLog returns a nil log, which discards entries, when auditing is not configured.
+func newAuditLog(cfg *config.AuditConfig) (*audit.Log, error) {
+	if cfg == nil {
+		return nil, nil //nolint:nilnil // auditing disabled
+	}
+
+	auditLog, err := audit.NewLog(*cfg)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+
+	return auditLog, nil
+}
+
+// newHistoryStore returns a nil store, which records nothing, when history is not configured.
+func newHistoryStore(cfg *config.HistoryConfig, logger *slog.Logger) (*history.Store, error) {
+	if cfg == nil {
+		return nil, nil //nolint:nilnil // history disabled
+	}
+
+	store, err := history.NewStore(*cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("opening history store: %w", err)
+	}
+
+	return store, nil
+}
+
+// newReminders returns a nil engine and broker when reminders are not configured. The broker is nil as well when
+// server-sent events are disabled.
+func newReminders(
+	cfg *config.Config,
+	deskSettings func() config.DesksConfig,
+	mover reminders.Mover,
+	leases *lease.Store,
+	logger *slog.Logger,
+) (*reminders.Engine, *reminders.Broker, error) {
+	if cfg.Reminders == nil {
+		return nil, nil, nil
+	}
 
-	go func() {
-		logger.InfoContext(ctx, "Starting server...", slog.Int("port", port))
+	var (
+		sinks  []reminders.Sink
+		broker *reminders.Broker
+	)
 
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.ErrorContext(ctx, "Error starting server", slog.String("error", err.Error()))
-			errCh <- err
+	if cfg.Reminders.Webhook != nil {
+		sinks = append(sinks, reminders.NewWebhookSink(*cfg.Reminders.Webhook))
+	}
 
-			return
+	if cfg.Reminders.MQTT != nil {
+		mqttSink, err := reminders.NewMQTTSink(*cfg.Reminders.MQTT)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating mqtt sink: %w", err)
 		}
-	}()
 
-	select {
-	case err := <-errCh:
+		sinks = append(sinks, mqttSink)
+	}
+
+	if cfg.Reminders.SSE {
+		broker = reminders.NewBroker()
+		sinks = append(sinks, broker)
+	}
+
+	engine := reminders.NewEngine(
+		*cfg.Reminders,
+		deskSettings,
+		mover,
+		sinks,
+		logger,
+		reminders.EngineOptionsWithLeases(leases),
+	)
+
+	return engine, broker, nil
+}
+
+// newScheduler returns a nil scheduler when scheduling is not configured.
+func newScheduler(
+	cfg *config.Config,
+	deskSettings func() config.DesksConfig,
+	mover scheduler.Mover,
+	leases *lease.Store,
+	auditLog *audit.Log,
+	logger *slog.Logger,
+) (*scheduler.Scheduler, error) {
+	if cfg.Scheduler == nil {
+		return nil, nil //nolint:nilnil // scheduling disabled
+	}
+
+	deskScheduler, err := scheduler.NewScheduler(
+		*cfg.Scheduler,
+		deskSettings,
+		mover,
+		auditLog,
+		logger,
+		scheduler.SchedulerOptionsWithLeases(leases),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("loading schedules: %w", err)
+	}
+
+	return deskScheduler, nil
+}
+
+// newWebhookDispatcher returns a nil dispatcher when webhooks are not configured.
+func newWebhookDispatcher(
+	cfg *config.Config,
+	deskSettings func() config.DesksConfig,
+	logger *slog.Logger,
+) (*webhooks.Dispatcher, error) {
+	if cfg.Webhooks == nil {
+		return nil, nil //nolint:nilnil // webhooks disabled
+	}
+
+	dispatcher, err := webhooks.NewDispatcher(*cfg.Webhooks, deskSettings, logger)
+	if err != nil {
+		return nil, fmt.Errorf("loading webhooks: %w", err)
+	}
+
+	return dispatcher, nil
+}
+
+// newDiscovery returns a nil discovery when discovery is not configured. Appearing and disappearing desks are sent to
+// the webhooks, if any.
+func newDiscovery(
+	cfg *config.DiscoveryConfig,
+	adapters []adapter,
+	desks *managerRef,
+	dispatcher *webhooks.Dispatcher,
+	logger *slog.Logger,
+) *idasen.Discovery {
+	if cfg == nil {
+		return nil
+	}
+
+	scannerOpts := []idasen.ScannerOptionsFunc{
+		idasen.ScannerOptionsWithTimeout(cfg.ScanDuration),
+		idasen.ScannerOptionsWithNamePattern(cfg.NamePattern),
+		idasen.ScannerOptionsWithManufacturerIDs(cfg.ManufacturerIDs...),
+	}
+
+	if len(cfg.ServiceUUIDs) > 0 {
+		scannerOpts = append(scannerOpts, idasen.ScannerOptionsWithServiceUUIDs(cfg.ServiceUUIDs...))
+	}
+
+	scanners := make([]*idasen.Scanner, 0, len(adapters))
+
+	for _, adapter := range adapters {
+		opts := append(slices.Clone(scannerOpts), idasen.ScannerOptionsWithAdapter(adapter.name))
+		scanners = append(scanners, idasen.NewScanner(ble.NewScanner(adapter.device, logger), logger, opts...))
+	}
+
+	opts := []idasen.DiscoveryOption{
+		idasen.DiscoveryOptionsWithInterval(cfg.Interval),
+		idasen.DiscoveryOptionsWithExpireAfter(cfg.ExpireAfter),
+		idasen.DiscoveryOptionsWithConnected(desks.IsConnected),
+	}
+
+	if dispatcher != nil {
+		opts = append(opts, idasen.DiscoveryOptionsWithEventObserver(dispatcher.HandleEvent))
+	}
+
+	return idasen.NewDiscovery(scanners, logger, opts...)
+}
+
+// newRegistry returns a nil registry, which rejects adoptions, when adopting desks is not enabled.
+func newRegistry(cfg *config.Config, verifier registry.Verifier, logger *slog.Logger) (*registry.Registry, error) {
+	if cfg.Registry == nil {
+		return nil, nil //nolint:nilnil // adoption disabled
+	}
+
+	deskRegistry, err := registry.NewRegistry(*cfg.Registry, cfg.Desks, verifier, logger)
+	if err != nil {
+		return nil, fmt.Errorf("opening registry: %w", err)
+	}
+
+	return deskRegistry, nil
+}
+
+// adapter is an opened bluetooth adapter.
+type adapter struct {
+	name   string
+	device goble.Device
+}
+
+// managerRef uses the manager, which must be set before any desk is moved or read.
+type managerRef struct {
+	manager *idasen.Manager
+}
+
+func (m *managerRef) MoveTo(ctx context.Context, addr string, targetHeight int) (int, error) {
+	return m.manager.MoveTo(ctx, addr, targetHeight) //nolint:wrapcheck // plain forwarding
+}
+
+func (m *managerRef) ReadHeight(addr string) (int, error) {
+	return m.manager.ReadHeight(addr) //nolint:wrapcheck // plain forwarding
+}
+
+func (m *managerRef) IsMoving(addr string) bool {
+	return m.manager.IsMoving(addr)
+}
+
+func (m *managerRef) IsConnected(addr string) bool {
+	return m.manager.IsConnected(addr)
+}
+
+// newLeaseStore returns a nil store, which holds no leases, when leases are not configured.
+func newLeaseStore(cfg *config.LeasesConfig) *lease.Store {
+	if cfg == nil {
+		return nil
+	}
+
+	return lease.NewStore(*cfg)
+}
+
+// newMoveLimiter returns a nil limiter, which allows every move, when rate limiting is not configured.
+func newMoveLimiter(cfg *config.RateLimitConfig) *ratelimit.MoveLimiter {
+	if cfg == nil {
+		return nil
+	}
+
+	return ratelimit.NewMoveLimiter(*cfg)
+}
+
+const jwksClientTimeout = 10 * time.Second
+
+func newAuthValidators(ctx context.Context, cfg *config.RestConfig, logger *slog.Logger) ([]auth.Validator, error) {
+	validators := []auth.Validator{auth.NewStaticTokenValidator(cfg.AuthTokens)}
+
+	if cfg.JWT != nil {
+		jwtValidator, err := auth.NewJWTValidator(ctx, *cfg.JWT, &http.Client{Timeout: jwksClientTimeout}, logger)
+		if err != nil {
+			return nil, fmt.Errorf("creating jwt validator: %w", err)
+		}
+
+		validators = append(validators, jwtValidator)
+	}
+
+	if cfg.TLS != nil && len(cfg.TLS.ClientIdentities) > 0 {
+		validators = append(validators, auth.NewCertificateValidator(cfg.TLS.ClientIdentities))
+	}
+
+	return validators, nil
+}
+
+// newTLSConfig returns nil when TLS is not configured. Certificates are reloaded in the background until ctx is done.
+func newTLSConfig(ctx context.Context, cfg *config.RestConfig, logger *slog.Logger) (*tls.Config, error) {
+	if cfg.TLS == nil {
+		return nil, nil //nolint:nilnil // plain HTTP
+	}
+
+	reloader, err := certs.NewReloader(*cfg.TLS, logger)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificates: %w", err)
+	}
+
+	tlsConfig, err := reloader.TLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("building tls config: %w", err)
+	}
+
+	go reloader.Run(ctx)
+
+	return tlsConfig, nil
+}
+
+const defaultReadHeaderTimeout = 5 * time.Minute
+
+func startServer(ctx context.Context, server *http.Server, resultCh chan<- error, logger *slog.Logger) {
+	logger.InfoContext(
+		ctx,
+		"Starting server...",
+		slog.String("addr", server.Addr),
+		slog.Bool("tls", server.TLSConfig != nil),
+	)
+
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.ErrorContext(ctx, "Error starting server", slog.String("error", err.Error()))
 		resultCh <- err
-	case <-ctx.Done():
 	}
 }
@@ -2,19 +2,63 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/AlejandroHerr/go-common/pkg/logging"
 	"github.com/AlejandroHerr/go-idasen-desk/internal/ble"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
 	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
 	"github.com/AlejandroHerr/go-idasen-desk/version"
 	goble "github.com/go-ble/ble"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+
+	defaultTimeout = 10 * time.Second
+	tablePadding   = 2
+)
+
+var ErrUnknownOutput = errors.New("unknown output format")
+
+type (
+	options struct {
+		timeout     time.Duration
+		namePattern string
+		services    string
+		output      string
+		writeConfig string
+		logLevel    string
+		adapter     string
+	}
+	// desk is a desk found by the scan, as printed in the json and yaml outputs.
+	desk struct {
+		Address        string   `json:"address"                   yaml:"address"`
+		Name           string   `json:"name"                      yaml:"name"`
+		RSSI           int      `json:"rssi"                      yaml:"rssi"`
+		Connectable    bool     `json:"connectable"               yaml:"connectable"`
+		ServiceUUIDs   []string `json:"service_uuids,omitempty"   yaml:"service_uuids,omitempty"`
+		ManufacturerID *uint16  `json:"manufacturer_id,omitempty" yaml:"manufacturer_id,omitempty"`
+	}
 )
 
 func main() {
 	ctx := context.Background()
+
+	opts := parseFlags()
+
 	logger := logging.NewLogger(
 		logging.WithApp("go-idasen-desk-scanner"),
 		logging.WithEnvironment(version.GetEnvironment()),
@@ -22,17 +66,42 @@ func main() {
 		logging.WithCommit(version.GetCommit()),
 		logging.WithBuildTime(version.GetBuildTime()),
 		logging.WithGoVersion(version.GetGoVersion()),
+		logging.WithLevel(opts.logLevel),
 	)
 
-	if err := run(ctx, logger); err != nil {
+	if err := run(ctx, opts, logger); err != nil {
 		logger.ErrorContext(ctx, "Error occurred", slog.String("error", err.Error()))
 
 		os.Exit(1)
 	}
 }
 
-func run(ctx context.Context, logger *slog.Logger) error {
-	dev, err := ble.NewDevice("default")
+func parseFlags() options {
+	var opts options
+
+	flag.DurationVar(&opts.timeout, "timeout", defaultTimeout, "How long to scan for")
+	flag.StringVar(&opts.namePattern, "name", config.DefaultDeskNamePattern, "Regular expression of the desk names")
+	flag.StringVar(
+		&opts.services,
+		"service",
+		idasen.LinakControlServiceUUID,
+		"Comma separated service UUIDs advertised by the desks, empty to match by name only",
+	)
+	flag.StringVar(&opts.output, "output", outputTable, "Output format: table, json or yaml")
+	flag.StringVar(&opts.writeConfig, "write-config", "", "Add the desks found to the desks section of this config file")
+	flag.StringVar(&opts.logLevel, "log-level", "warn", "Log level: debug, info, warn or error")
+	flag.StringVar(&opts.adapter, "adapter", ble.DefaultAdapter, "Bluetooth adapter to scan with, such as hci1")
+	flag.Parse()
+
+	return opts
+}
+
+func run(ctx context.Context, opts options, logger *slog.Logger) error {
+	if opts.output != outputTable && opts.output != outputJSON && opts.output != outputYAML {
+		return fmt.Errorf("%w: %s", ErrUnknownOutput, opts.output)
+	}
+
+	dev, err := ble.NewDevice(opts.adapter)
 	if err != nil {
 		return fmt.Errorf("new device: %w", err)
 	}
@@ -41,7 +110,13 @@ func run(ctx context.Context, logger *slog.Logger) error {
 
 	bleScanner := ble.NewScanner(dev, logger)
 
-	scanner := idasen.NewScanner(bleScanner, logger)
+	scanner := idasen.NewScanner(
+		bleScanner,
+		logger,
+		idasen.ScannerOptionsWithTimeout(opts.timeout),
+		idasen.ScannerOptionsWithNamePattern(opts.namePattern),
+		idasen.ScannerOptionsWithServiceUUIDs(splitList(opts.services)...),
+	)
 
 	advs, err := scanner.ScanDesks(ctx)
 	if err != nil {
@@ -50,9 +125,102 @@ func run(ctx context.Context, logger *slog.Logger) error {
 
 	logger.InfoContext(ctx, "Desks found", slog.Int("count", len(advs)))
 
+	desks := make([]desk, 0, len(advs))
 	for _, adv := range advs {
-		logger.InfoContext(ctx, "Desk found", slog.String("address", adv.Addr), slog.String("name", adv.Name))
+		desks = append(desks, newDesk(adv))
+	}
+
+	if err = printDesks(os.Stdout, opts.output, desks); err != nil {
+		return fmt.Errorf("printing desks: %w", err)
+	}
+
+	if opts.writeConfig == "" {
+		return nil
+	}
+
+	return writeConfig(opts.writeConfig, desks)
+}
+
+func newDesk(adv idasen.Advertisement) desk {
+	d := desk{
+		Address:        adv.Addr,
+		Name:           adv.Name,
+		RSSI:           adv.RSSI,
+		Connectable:    adv.Connectable,
+		ServiceUUIDs:   adv.ServiceUUIDs,
+		ManufacturerID: nil,
 	}
 
+	if id, ok := adv.ManufacturerID(); ok {
+		d.ManufacturerID = &id
+	}
+
+	return d
+}
+
+func printDesks(w io.Writer, output string, desks []desk) error {
+	switch output {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(desks) //nolint:wrapcheck // wrapped by the caller
+	case outputYAML:
+		encoder := yaml.NewEncoder(w)
+
+		if err := encoder.Encode(desks); err != nil {
+			return err //nolint:wrapcheck // wrapped by the caller
+		}
+
+		return encoder.Close() //nolint:wrapcheck // wrapped by the caller
+	default:
+		table := tabwriter.NewWriter(w, 0, 0, tablePadding, ' ', 0)
+
+		// Write errors are reported by Flush
+		fmt.Fprintln(table, "ADDRESS\tNAME\tRSSI\tCONNECTABLE") //nolint:errcheck // see above
+
+		for _, d := range desks {
+			fmt.Fprintf(table, "%s\t%s\t%d\t%t\n", d.Address, d.Name, d.RSSI, d.Connectable) //nolint:errcheck // see above
+		}
+
+		return table.Flush() //nolint:wrapcheck // wrapped by the caller
+	}
+}
+
+// writeConfig adds the desks to the config file, named after their advertised name.
+func writeConfig(file string, desks []desk) error {
+	devices := make([]config.DeskConfig, 0, len(desks))
+
+	for _, d := range desks {
+		devices = append(devices, config.DeskConfig{
+			ID:             d.Address,
+			Name:           d.Name,
+			IdleTimeout:    nil,
+			StandThreshold: 0,
+			SittingGoal:    0,
+			Presets:        nil,
+			Adapter:        "",
+		})
+	}
+
+	added, err := config.AddDevices(file, devices)
+	if err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Added %d desk(s) to %s\n", len(added), file) //nolint:errcheck // best effort
+
 	return nil
 }
+
+func splitList(list string) []string {
+	var items []string
+
+	for item := range strings.SplitSeq(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
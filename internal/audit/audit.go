@@ -0,0 +1,299 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+)
+
+const (
+	bytesPerMB      = 1 << 20
+	filePermissions = 0o600
+	maxLineSize     = 1 << 20
+)
+
+type (
+	Action  string
+	Outcome string
+	Entry   struct {
+		Time       time.Time      `json:"time"`
+		Action     Action         `json:"action"`
+		Subject    string         `json:"subject"`
+		RequestID  string         `json:"request_id,omitempty"`
+		Desk       string         `json:"desk,omitempty"`
+		FromHeight *int           `json:"from_height,omitempty"`
+		ToHeight   *int           `json:"to_height,omitempty"`
+		Outcome    Outcome        `json:"outcome"`
+		Error      string         `json:"error,omitempty"`
+		DurationMS int64          `json:"duration_ms"`
+		Details    map[string]any `json:"details,omitempty"`
+	}
+	Filter struct {
+		Desk    string
+		Subject string
+		Action  Action
+		From    time.Time
+		To      time.Time
+		Limit   int
+	}
+	// Log appends entries to a JSON lines file, rotating it when it grows over the configured size. A nil *Log
+	// discards every entry, so callers do not need to check whether auditing is enabled.
+	Log struct {
+		file       string
+		maxSize    int64
+		maxBackups int
+		mutex      sync.Mutex
+		writer     *os.File
+		size       int64
+	}
+)
+
+const (
+	ActionMove         Action = "move"
+	ActionStop         Action = "stop"
+	ActionPresetChange Action = "preset_change"
+	ActionConfigChange Action = "config_change"
+	ActionLease        Action = "lease"
+
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+func NewLog(cfg config.AuditConfig) (*Log, error) {
+	log := &Log{
+		file:       cfg.File,
+		maxSize:    int64(cfg.MaxSizeMB) * bytesPerMB,
+		maxBackups: cfg.MaxBackups,
+		mutex:      sync.Mutex{},
+		writer:     nil,
+		size:       0,
+	}
+
+	if err := log.open(); err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+// NewEntry starts an entry for the caller found in ctx. Finish it with Entry.Done.
+func NewEntry(ctx context.Context, action Action, desk string) *Entry {
+	subject := ""
+	if identity, ok := auth.IdentityFromContext(ctx); ok {
+		subject = identity.Subject
+	}
+
+	requestID, _ := ctx.Value(api.RequestIDContextKey{}).(string)
+
+	return &Entry{
+		Time:       time.Now(),
+		Action:     action,
+		Subject:    subject,
+		RequestID:  requestID,
+		Desk:       desk,
+		FromHeight: nil,
+		ToHeight:   nil,
+		Outcome:    OutcomeSuccess,
+		Error:      "",
+		DurationMS: 0,
+		Details:    nil,
+	}
+}
+
+// Done sets the outcome and duration of the entry.
+func (e *Entry) Done(err error) *Entry {
+	e.DurationMS = time.Since(e.Time).Milliseconds()
+
+	if err != nil {
+		e.Outcome = OutcomeFailure
+		e.Error = err.Error()
+	}
+
+	return e
+}
+
+func (l *Log) Record(entry *Entry) error {
+	if l == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding audit entry: %w", err)
+	}
+
+	line = append(line, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.maxSize > 0 && l.size+int64(len(line)) > l.maxSize && l.size > 0 {
+		if err = l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.writer.Write(line)
+	l.size += int64(n)
+
+	if err != nil {
+		return fmt.Errorf("writing audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Query returns the matching entries, most recent first.
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	entries := []Entry{}
+
+	if l == nil {
+		return entries, nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Read from the oldest backup to the current file so entries come out in chronological order
+	for i := l.maxBackups; i >= 0; i-- {
+		fileEntries, err := readEntries(l.backupName(i), filter)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, fileEntries...)
+	}
+
+	slices.Reverse(entries)
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+
+	return entries, nil
+}
+
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.writer.Close(); err != nil {
+		return fmt.Errorf("closing audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (f *Filter) matches(entry *Entry) bool {
+	switch {
+	case f.Desk != "" && entry.Desk != f.Desk:
+		return false
+	case f.Subject != "" && entry.Subject != f.Subject:
+		return false
+	case f.Action != "" && entry.Action != f.Action:
+		return false
+	case !f.From.IsZero() && entry.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !entry.Time.Before(f.To):
+		return false
+	default:
+		return true
+	}
+}
+
+func (l *Log) open() error {
+	writer, err := os.OpenFile(l.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, filePermissions)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+
+	info, err := writer.Stat()
+	if err != nil {
+		writer.Close()
+
+		return fmt.Errorf("reading audit log size: %w", err)
+	}
+
+	l.writer = writer
+	l.size = info.Size()
+
+	return nil
+}
+
+func (l *Log) rotate() error {
+	if err := l.writer.Close(); err != nil {
+		return fmt.Errorf("closing audit log: %w", err)
+	}
+
+	for i := l.maxBackups; i > 0; i-- {
+		err := os.Rename(l.backupName(i-1), l.backupName(i))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("rotating audit log: %w", err)
+		}
+	}
+
+	if l.maxBackups == 0 {
+		if err := os.Remove(l.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("truncating audit log: %w", err)
+		}
+	}
+
+	return l.open()
+}
+
+func (l *Log) backupName(index int) string {
+	if index == 0 {
+		return l.file
+	}
+
+	return fmt.Sprintf("%s.%d", l.file, index)
+}
+
+func readEntries(file string, filter Filter) ([]Entry, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	defer reader.Close()
+
+	entries := []Entry{}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+
+	for scanner.Scan() {
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Skip partially written lines
+			continue
+		}
+
+		if filter.matches(&entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+
+	return entries, nil
+}
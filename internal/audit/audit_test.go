@@ -0,0 +1,99 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+
+	log, err := audit.NewLog(config.AuditConfig{File: file, MaxSizeMB: 1, MaxBackups: 2})
+	require.NoError(t, err)
+
+	defer log.Close()
+
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{Subject: "alice", Scopes: nil, Desks: nil})
+	ctx = context.WithValue(ctx, api.RequestIDContextKey{}, "req-1")
+
+	for i := range 3 {
+		entry := audit.NewEntry(ctx, audit.ActionMove, fmt.Sprintf("desk-%d", i%2))
+
+		height := 7000 + i
+		entry.ToHeight = &height
+
+		require.NoError(t, log.Record(entry.Done(nil)))
+	}
+
+	require.NoError(t, log.Record(audit.NewEntry(ctx, audit.ActionStop, "desk-0").Done(errors.New("boom"))))
+
+	entries, err := log.Query(audit.Filter{Desk: "desk-0", Limit: 10}) //nolint:exhaustruct // partial filter
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	require.Equal(t, audit.ActionStop, entries[0].Action, "should return most recent first")
+	require.Equal(t, audit.OutcomeFailure, entries[0].Outcome)
+	require.Equal(t, "boom", entries[0].Error)
+	require.Equal(t, "alice", entries[0].Subject)
+	require.Equal(t, "req-1", entries[0].RequestID)
+	require.Equal(t, 7002, *entries[1].ToHeight)
+
+	entries, err = log.Query(audit.Filter{Action: audit.ActionMove, Limit: 1}) //nolint:exhaustruct // partial filter
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "desk-0", entries[0].Desk)
+}
+
+func TestLogRotation(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+
+	log, err := audit.NewLog(config.AuditConfig{File: file, MaxSizeMB: 1, MaxBackups: 1})
+	require.NoError(t, err)
+
+	defer log.Close()
+
+	entry := audit.NewEntry(context.Background(), audit.ActionConfigChange, "")
+	entry.Details = map[string]any{"padding": strings.Repeat("x", 300*1024)}
+
+	for range 8 {
+		require.NoError(t, log.Record(entry))
+	}
+
+	_, err = os.Stat(file + ".1")
+	require.NoError(t, err, "should have rotated the log")
+
+	_, err = os.Stat(file + ".2")
+	require.True(t, os.IsNotExist(err), "should keep a single backup")
+
+	entries, err := log.Query(audit.Filter{}) //nolint:exhaustruct // no filter
+	require.NoError(t, err)
+	require.Less(t, len(entries), 8, "should drop entries beyond the last backup")
+}
+
+func TestNilLogDiscards(t *testing.T) {
+	t.Parallel()
+
+	var log *audit.Log
+
+	require.NoError(t, log.Record(audit.NewEntry(context.Background(), audit.ActionMove, "desk")))
+
+	entries, err := log.Query(audit.Filter{}) //nolint:exhaustruct // no filter
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.NoError(t, log.Close())
+}
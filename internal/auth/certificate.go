@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+)
+
+type (
+	// PeerValidator is implemented by validators that can authenticate a request from its verified TLS client
+	// certificate. Authenticate consults them before looking at the Authorization header.
+	PeerValidator interface {
+		ValidatePeer(cert *x509.Certificate) (*Identity, error)
+	}
+	// CertificateValidator maps the common name of verified client certificates to identities.
+	CertificateValidator struct {
+		identities map[string]config.ClientIdentity
+	}
+)
+
+var (
+	_ Validator     = (*CertificateValidator)(nil)
+	_ PeerValidator = (*CertificateValidator)(nil)
+)
+
+func NewCertificateValidator(identities []config.ClientIdentity) *CertificateValidator {
+	byCommonName := make(map[string]config.ClientIdentity, len(identities))
+	for _, identity := range identities {
+		byCommonName[identity.CommonName] = identity
+	}
+
+	return &CertificateValidator{
+		identities: byCommonName,
+	}
+}
+
+// Validate never accepts bearer tokens, certificates are only checked through ValidatePeer.
+func (*CertificateValidator) Validate(context.Context, string) (*Identity, error) {
+	return nil, ErrInvalidToken
+}
+
+func (v *CertificateValidator) ValidatePeer(cert *x509.Certificate) (*Identity, error) {
+	identity, ok := v.identities[cert.Subject.CommonName]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	subject := identity.Name
+	if subject == "" {
+		subject = "cert:" + identity.CommonName
+	}
+
+	// Certificates without explicit scopes are read-only
+	scopes := identity.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{ScopeDeskRead}
+	}
+
+	return &Identity{
+		Subject: subject,
+		Scopes:  scopes,
+		Desks:   identity.Desks,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+type (
+	// Identity is the authenticated caller of a request.
+	Identity struct {
+		Subject string
+		// Scopes granted to the caller. ScopeAdmin grants every other scope.
+		Scopes []string
+		// Desks the caller is allowed to operate on. An empty list allows every desk.
+		Desks []string
+	}
+	identityContextKey struct{}
+)
+
+const (
+	ScopeDeskRead = "desk:read"
+	ScopeDeskMove = "desk:move"
+	ScopeAdmin    = "admin"
+)
+
+// AllScopes returns every scope known to the server.
+func AllScopes() []string {
+	return []string{ScopeDeskRead, ScopeDeskMove, ScopeAdmin}
+}
+
+func (i *Identity) HasScope(scope string) bool {
+	return slices.Contains(i.Scopes, ScopeAdmin) || slices.Contains(i.Scopes, scope)
+}
+
+func (i *Identity) CanAccessDesk(addr string) bool {
+	return len(i.Desks) == 0 || slices.Contains(i.Desks, addr)
+}
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(*Identity)
+
+	return identity, ok
+}
@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// minKeySetRefresh limits how often an unknown kid or a failing source can trigger a refresh.
+	minKeySetRefresh = time.Minute
+	maxJWKSSize      = 1 << 20
+	uncompressedMark = 0x04
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+
+type (
+	// KeySet is a JWKS loaded from a local file or a URL and refreshed periodically. Only one refresh runs at a time,
+	// and callers waiting for it share its result.
+	KeySet struct {
+		file            string
+		url             string
+		client          *http.Client
+		refreshInterval time.Duration
+		logger          *slog.Logger
+		refreshMutex    sync.Mutex
+		mutex           sync.RWMutex
+		keys            map[string]publicKey
+		fetchedAt       time.Time // last successful refresh
+		attemptedAt     time.Time // last refresh, successful or not
+		attempts        uint64
+		attemptErr      error
+	}
+	publicKey struct {
+		alg string
+		key crypto.PublicKey
+	}
+	jsonWebKeySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	jsonWebKey struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid,omitempty"`
+		Use string `json:"use,omitempty"`
+		Alg string `json:"alg,omitempty"`
+		N   string `json:"n,omitempty"`
+		E   string `json:"e,omitempty"`
+		Crv string `json:"crv,omitempty"`
+		X   string `json:"x,omitempty"`
+		Y   string `json:"y,omitempty"`
+	}
+)
+
+func NewKeySet(
+	file string,
+	url string,
+	refreshInterval time.Duration,
+	client *http.Client,
+	logger *slog.Logger,
+) *KeySet {
+	return &KeySet{
+		file:            file,
+		url:             url,
+		client:          client,
+		refreshInterval: refreshInterval,
+		logger:          logger.With(slog.String("component", "auth-jwks")),
+		mutex:           sync.RWMutex{},
+		refreshMutex:    sync.Mutex{},
+		keys:            map[string]publicKey{},
+		fetchedAt:       time.Time{},
+		attemptedAt:     time.Time{},
+		attempts:        0,
+		attemptErr:      nil,
+	}
+}
+
+// Refresh reloads the key set from its source.
+func (k *KeySet) Refresh(ctx context.Context) error {
+	k.refreshMutex.Lock()
+	defer k.refreshMutex.Unlock()
+
+	return k.load(ctx)
+}
+
+// refresh reloads the key set unless another refresh happened after the given attempt, as callers that wait for a
+// running refresh reuse its result instead of reloading again.
+func (k *KeySet) refresh(ctx context.Context, attempt uint64) error {
+	k.refreshMutex.Lock()
+	defer k.refreshMutex.Unlock()
+
+	k.mutex.RLock()
+	refreshed, err := k.attempts != attempt, k.attemptErr
+	k.mutex.RUnlock()
+
+	if refreshed {
+		return err
+	}
+
+	return k.load(ctx)
+}
+
+func (k *KeySet) load(ctx context.Context) error {
+	keys, err := k.fetch(ctx)
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.attemptedAt = time.Now()
+	k.attempts++
+	k.attemptErr = err
+
+	if err != nil {
+		return err
+	}
+
+	k.keys = keys
+	k.fetchedAt = k.attemptedAt
+
+	k.logger.DebugContext(ctx, "Key set refreshed", slog.Int("keys", len(keys)))
+
+	return nil
+}
+
+func (k *KeySet) fetch(ctx context.Context) (map[string]publicKey, error) {
+	data, err := k.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jsonWebKeySet
+	if err = json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decoding jwks: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, parseErr := jwk.publicKey()
+		if parseErr != nil {
+			k.logger.WarnContext(
+				ctx,
+				"Skipping invalid key",
+				slog.String("kid", jwk.Kid),
+				slog.String("error", parseErr.Error()),
+			)
+
+			continue
+		}
+
+		keys[jwk.Kid] = publicKey{alg: jwk.Alg, key: key}
+	}
+
+	return keys, nil
+}
+
+// key returns the key for the given kid, refreshing the set when it is stale or the kid is unknown. Refreshes for
+// unknown kids and after a failed refresh are throttled, so neither can flood the source.
+func (k *KeySet) key(ctx context.Context, kid string) (publicKey, error) {
+	k.mutex.RLock()
+	key, ok := k.lookup(kid)
+	stale := time.Since(k.fetchedAt) >= k.refreshInterval
+	throttled := time.Since(k.attemptedAt) < minKeySetRefresh && (!ok || k.attemptErr != nil)
+	attempt := k.attempts
+	k.mutex.RUnlock()
+
+	switch {
+	case ok && (!stale || throttled):
+		return key, nil
+	case !ok && throttled:
+		return publicKey{}, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+	}
+
+	if err := k.refresh(ctx, attempt); err != nil {
+		if ok {
+			// Keep serving the cached key if the source is temporarily unavailable
+			k.logger.WarnContext(ctx, "Refreshing key set", slog.String("error", err.Error()))
+
+			return key, nil
+		}
+
+		return publicKey{}, fmt.Errorf("refreshing key set: %w", err)
+	}
+
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	if key, ok = k.lookup(kid); !ok {
+		return publicKey{}, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+	}
+
+	return key, nil
+}
+
+func (k *KeySet) lookup(kid string) (publicKey, bool) {
+	if key, ok := k.keys[kid]; ok {
+		return key, true
+	}
+
+	// A token without kid can only be matched against a single-key set
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+
+	return publicKey{}, false
+}
+
+func (k *KeySet) read(ctx context.Context) ([]byte, error) {
+	if k.file != "" {
+		data, err := os.ReadFile(k.file)
+		if err != nil {
+			return nil, fmt.Errorf("reading jwks file: %w", err)
+		}
+
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating jwks request: %w", err)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading jwks response: %w", err)
+	}
+
+	return data, nil
+}
+
+func (j *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("decoding modulus: %w", err)
+		}
+
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("decoding exponent: %w", err)
+		}
+
+		if !e.IsInt64() {
+			return nil, errors.New("exponent too large")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		return j.ecdsaPublicKey()
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
+
+func (j *jsonWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var (
+		curve     elliptic.Curve
+		ecdhCurve ecdh.Curve
+	)
+
+	switch j.Crv {
+	case "P-256":
+		curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(j.X)
+	if err != nil {
+		return nil, fmt.Errorf("decoding x: %w", err)
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(j.Y)
+	if err != nil {
+		return nil, fmt.Errorf("decoding y: %w", err)
+	}
+
+	// Let crypto/ecdh validate that the point is on the curve
+	point := append([]byte{uncompressedMark}, append(x, y...)...)
+	if _, err = ecdhCurve.NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("invalid point: %w", err)
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64: %w", err)
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
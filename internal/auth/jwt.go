@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers SHA-256 for crypto.Hash
+	_ "crypto/sha512" // registers SHA-384 and SHA-512 for crypto.Hash
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+)
+
+const jwtParts = 3
+
+var ErrInvalidJWT = errors.New("invalid jwt")
+
+type (
+	// JWTValidator validates signed JWTs against a JWKS and maps their claims to an Identity.
+	JWTValidator struct {
+		config config.JWTConfig
+		keys   *KeySet
+		now    func() time.Time
+	}
+	jwtHeader struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid,omitempty"`
+	}
+	jwtClaims map[string]any
+)
+
+var _ Validator = (*JWTValidator)(nil)
+
+// NewJWTValidator creates a validator and loads the configured JWKS.
+func NewJWTValidator(
+	ctx context.Context,
+	cfg config.JWTConfig,
+	client *http.Client,
+	logger *slog.Logger,
+) (*JWTValidator, error) {
+	if (cfg.JWKSFile == "") == (cfg.JWKSURL == "") {
+		return nil, errors.New("exactly one of jwks_file or jwks_url must be set")
+	}
+
+	keys := NewKeySet(cfg.JWKSFile, cfg.JWKSURL, cfg.RefreshInterval, client, logger)
+	if err := keys.Refresh(ctx); err != nil {
+		return nil, fmt.Errorf("loading jwks: %w", err)
+	}
+
+	return &JWTValidator{
+		config: cfg,
+		keys:   keys,
+		now:    time.Now,
+	}, nil
+}
+
+func (v *JWTValidator) Validate(ctx context.Context, token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != jwtParts {
+		// Not a JWT, leave it to other validators
+		return nil, ErrInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: decoding header: %w", ErrInvalidJWT, err)
+	}
+
+	key, err := v.keys.key(ctx, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWT, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding signature: %w", ErrInvalidJWT, err)
+	}
+
+	if err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWT, err)
+	}
+
+	var claims jwtClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: decoding claims: %w", ErrInvalidJWT, err)
+	}
+
+	if err = v.validateClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWT, err)
+	}
+
+	return v.identity(claims)
+}
+
+func (v *JWTValidator) validateClaims(claims jwtClaims) error {
+	now := v.now()
+
+	exp, ok := claims.timestamp("exp")
+	if !ok {
+		return errors.New("missing exp claim")
+	}
+
+	if !now.Before(exp.Add(v.config.Leeway)) {
+		return ErrTokenExpired
+	}
+
+	if nbf, found := claims.timestamp("nbf"); found && now.Add(v.config.Leeway).Before(nbf) {
+		return ErrTokenExpired
+	}
+
+	if v.config.Issuer != "" {
+		if iss, _ := claims.lookup("iss").(string); iss != v.config.Issuer {
+			return fmt.Errorf("unexpected issuer %q", iss)
+		}
+	}
+
+	if v.config.Audience != "" && !slices.Contains(claims.stringList("aud"), v.config.Audience) {
+		return fmt.Errorf("audience %q not allowed", v.config.Audience)
+	}
+
+	return nil
+}
+
+func (v *JWTValidator) identity(claims jwtClaims) (*Identity, error) {
+	subject, _ := claims.lookup(v.config.SubjectClaim).(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidJWT, v.config.SubjectClaim)
+	}
+
+	scopes := []string{}
+
+	for _, value := range claims.stringList(v.config.ScopesClaim) {
+		if mapped, ok := v.config.ScopeMapping[value]; ok {
+			scopes = append(scopes, mapped...)
+		} else if slices.Contains(AllScopes(), value) {
+			scopes = append(scopes, value)
+		}
+	}
+
+	slices.Sort(scopes)
+
+	return &Identity{
+		Subject: subject,
+		Scopes:  slices.Compact(scopes),
+		Desks:   claims.stringList(v.config.DesksClaim),
+	}, nil
+}
+
+// lookup resolves a claim by name, following dots into nested objects (e.g. "realm_access.roles").
+func (c jwtClaims) lookup(name string) any {
+	var current any = map[string]any(c)
+
+	for part := range strings.SplitSeq(name, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+
+		current = object[part]
+	}
+
+	return current
+}
+
+// stringList reads a claim that is either a space separated string or an array of strings.
+func (c jwtClaims) stringList(name string) []string {
+	switch value := c.lookup(name).(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		values := make([]string, 0, len(value))
+
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		return values
+	default:
+		return nil
+	}
+}
+
+func (c jwtClaims) timestamp(name string) (time.Time, bool) {
+	number, ok := c.lookup(name).(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(seconds), 0), true
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("decoding base64: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err = decoder.Decode(v); err != nil {
+		return fmt.Errorf("decoding json: %w", err)
+	}
+
+	return nil
+}
+
+func verifySignature(alg string, key publicKey, signingInput, signature []byte) error {
+	if key.alg != "" && key.alg != alg {
+		return fmt.Errorf("algorithm %s does not match key algorithm %s", alg, key.alg)
+	}
+
+	hash, err := algHash(alg)
+	if err != nil {
+		return err
+	}
+
+	hasher := hash.New()
+	hasher.Write(signingInput)
+	digest := hasher.Sum(nil)
+
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		switch {
+		case strings.HasPrefix(alg, "RS"):
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		case strings.HasPrefix(alg, "PS"):
+			err = rsa.VerifyPSS(pub, hash, digest, signature, nil)
+		default:
+			return fmt.Errorf("algorithm %s not supported for RSA keys", alg)
+		}
+
+		if err != nil {
+			return fmt.Errorf("verifying signature: %w", err)
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("algorithm %s not supported for EC keys", alg)
+		}
+
+		size := (pub.Curve.Params().BitSize + 7) / 8 //nolint:mnd // bits to bytes
+		if len(signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("verifying signature: invalid signature")
+		}
+	default:
+		return errors.New("unsupported key")
+	}
+
+	return nil
+}
+
+func algHash(alg string) (crypto.Hash, error) {
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		return crypto.SHA256, nil
+	case "RS384", "PS384", "ES384":
+		return crypto.SHA384, nil
+	case "RS512", "PS512", "ES512":
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
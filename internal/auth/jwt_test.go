@@ -0,0 +1,380 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/logging"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIssuer   = "https://sso.example.com"
+	testAudience = "go-idasen-desk"
+	testDesk     = "6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10"
+)
+
+type testSigner struct {
+	kid string
+	alg string
+	key crypto.Signer
+}
+
+func (s *testSigner) jwk(t *testing.T) map[string]string {
+	t.Helper()
+
+	switch pub := s.key.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"kid": s.kid,
+			"alg": s.alg,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+
+		return map[string]string{
+			"kty": "EC",
+			"kid": s.kid,
+			"crv": pub.Curve.Params().Name,
+			"x":   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			"y":   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}
+	default:
+		t.Fatalf("unsupported key %T", pub)
+
+		return nil
+	}
+}
+
+func (s *testSigner) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": s.alg, "kid": s.kid, "typ": "JWT"})
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, sig, signErr := ecdsa.Sign(rand.Reader, key, digest[:])
+		require.NoError(t, signErr)
+
+		signature = append(r.FillBytes(make([]byte, 32)), sig.FillBytes(make([]byte, 32))...)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJWKS(t *testing.T, signers ...*testSigner) string {
+	t.Helper()
+
+	keys := make([]map[string]string, 0, len(signers))
+	for _, signer := range signers {
+		keys = append(keys, signer.jwk(t))
+	}
+
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+
+	return file
+}
+
+func validClaims() map[string]any {
+	now := time.Now()
+
+	return map[string]any{
+		"sub":    "alice",
+		"iss":    testIssuer,
+		"aud":    []string{testAudience, "other"},
+		"exp":    now.Add(time.Hour).Unix(),
+		"nbf":    now.Add(-time.Minute).Unix(),
+		"scope":  "desk:read desk-movers unknown",
+		"desks":  []string{testDesk},
+		"groups": map[string]any{"roles": []string{"desk-admins"}},
+	}
+}
+
+func jwtConfig(jwksFile string) config.JWTConfig {
+	return config.JWTConfig{
+		JWKSFile:        jwksFile,
+		JWKSURL:         "",
+		RefreshInterval: time.Hour,
+		Issuer:          testIssuer,
+		Audience:        testAudience,
+		Leeway:          0,
+		SubjectClaim:    "sub",
+		ScopesClaim:     "scope",
+		DesksClaim:      "desks",
+		ScopeMapping:    map[string][]string{"desk-movers": {auth.ScopeDeskMove}, "desk-admins": {auth.ScopeAdmin}},
+	}
+}
+
+func TestJWTValidator(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	rsaSigner := &testSigner{kid: "rsa", alg: "RS256", key: rsaKey}
+	ecSigner := &testSigner{kid: "ec", alg: "ES256", key: ecKey}
+	forger := &testSigner{kid: "rsa", alg: "RS256", key: otherKey}
+
+	validator, err := auth.NewJWTValidator(
+		context.Background(),
+		jwtConfig(writeJWKS(t, rsaSigner, ecSigner)),
+		http.DefaultClient,
+		logging.NewLogger(),
+	)
+	require.NoError(t, err)
+
+	t.Run("maps claims to identity", func(t *testing.T) {
+		t.Parallel()
+
+		for _, signer := range []*testSigner{rsaSigner, ecSigner} {
+			identity, err := validator.Validate(context.Background(), signer.sign(t, validClaims()))
+			require.NoError(t, err)
+			require.Equal(t, "alice", identity.Subject)
+			require.Equal(t, []string{auth.ScopeDeskMove, auth.ScopeDeskRead}, identity.Scopes)
+			require.Equal(t, []string{testDesk}, identity.Desks)
+			require.True(t, identity.CanAccessDesk(testDesk))
+			require.False(t, identity.CanAccessDesk("00000000-0000-0000-0000-000000000000"))
+			require.False(t, identity.HasScope(auth.ScopeAdmin))
+		}
+	})
+
+	t.Run("rejects invalid tokens", func(t *testing.T) {
+		t.Parallel()
+
+		tests := map[string]func(map[string]any){
+			"expired":         func(c map[string]any) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+			"not yet valid":   func(c map[string]any) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+			"missing exp":     func(c map[string]any) { delete(c, "exp") },
+			"wrong issuer":    func(c map[string]any) { c["iss"] = "https://evil.example.com" },
+			"wrong audience":  func(c map[string]any) { c["aud"] = "other" },
+			"missing subject": func(c map[string]any) { delete(c, "sub") },
+		}
+
+		for name, mutate := range tests {
+			claims := validClaims()
+			mutate(claims)
+
+			_, err := validator.Validate(context.Background(), rsaSigner.sign(t, claims))
+			require.Error(t, err, name)
+			require.True(t, errors.Is(err, auth.ErrInvalidJWT), "%s: unexpected error %v", name, err)
+		}
+	})
+
+	t.Run("rejects forged signature", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := validator.Validate(context.Background(), forger.sign(t, validClaims()))
+		require.True(t, errors.Is(err, auth.ErrInvalidJWT), "unexpected error %v", err)
+	})
+
+	t.Run("leaves non jwt tokens to other validators", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := validator.Validate(context.Background(), "go_idasen_desk_abc")
+		require.True(t, errors.Is(err, auth.ErrInvalidToken), "unexpected error %v", err)
+	})
+}
+
+func TestJWTValidatorScopeClaimPath(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signer := &testSigner{kid: "ec", alg: "ES256", key: key}
+
+	cfg := jwtConfig(writeJWKS(t, signer))
+	cfg.ScopesClaim = "groups.roles"
+
+	validator, err := auth.NewJWTValidator(context.Background(), cfg, http.DefaultClient, logging.NewLogger())
+	require.NoError(t, err)
+
+	identity, err := validator.Validate(context.Background(), signer.sign(t, validClaims()))
+	require.NoError(t, err)
+	require.True(t, identity.HasScope(auth.ScopeDeskMove), "admin should grant every scope")
+}
+
+func TestJWTValidatorKeySetRefresh(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signer := &testSigner{kid: "ec", alg: "ES256", key: key}
+
+	jwks, err := os.ReadFile(writeJWKS(t, signer))
+	require.NoError(t, err)
+
+	var (
+		requests  atomic.Int32
+		failing   atomic.Bool
+		requested = make(chan struct{}, 1)
+		release   = make(chan struct{})
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+
+		if failing.Load() {
+			select {
+			case requested <- struct{}{}:
+			default:
+			}
+
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = w.Write(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := jwtConfig("")
+	cfg.JWKSURL = server.URL
+	cfg.RefreshInterval = time.Nanosecond // every key is stale
+
+	validator, err := auth.NewJWTValidator(context.Background(), cfg, server.Client(), logging.NewLogger())
+	require.NoError(t, err)
+	require.Equal(t, int32(1), requests.Load())
+
+	failing.Store(true)
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, 10)
+
+	for range cap(errs) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := validator.Validate(context.Background(), signer.sign(t, validClaims()))
+			errs <- err
+		}()
+	}
+
+	<-requested
+	time.Sleep(50 * time.Millisecond) // let the other validations wait for the refresh
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err, "should keep serving the cached key")
+	}
+
+	require.Equal(t, int32(2), requests.Load(), "concurrent validations should share a refresh")
+
+	_, err = validator.Validate(context.Background(), signer.sign(t, validClaims()))
+	require.NoError(t, err)
+
+	unknown := &testSigner{kid: "unknown", alg: "ES256", key: key}
+	_, err = validator.Validate(context.Background(), unknown.sign(t, validClaims()))
+	require.ErrorIs(t, err, auth.ErrKeyNotFound)
+
+	require.Equal(t, int32(2), requests.Load(), "should not refresh again right after a failed refresh")
+}
+
+func TestAuthenticateWithStaticAndJWT(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signer := &testSigner{kid: "ec", alg: "ES256", key: key}
+
+	jwtValidator, err := auth.NewJWTValidator(
+		context.Background(),
+		jwtConfig(writeJWKS(t, signer)),
+		http.DefaultClient,
+		logging.NewLogger(),
+	)
+	require.NoError(t, err)
+
+	staticValidator := auth.NewStaticTokenValidator([]config.AuthToken{
+		{Token: "static", Name: "", Scopes: []string{auth.ScopeDeskRead}, Desks: nil, ExpiresAt: nil, NotBefore: nil},
+	})
+
+	handler := auth.Authenticate(staticValidator, jwtValidator)(
+		auth.RequireScope(auth.ScopeDeskMove)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := auth.IdentityFromContext(r.Context())
+			require.True(t, ok)
+			w.Header().Set("X-Subject", identity.Subject)
+			w.WriteHeader(http.StatusOK)
+		})),
+	)
+
+	tests := []struct {
+		name    string
+		token   string
+		status  int
+		subject string
+	}{
+		{name: "jwt", token: signer.sign(t, validClaims()), status: http.StatusOK, subject: "alice"},
+		{name: "static without scope", token: "static", status: http.StatusForbidden, subject: ""},
+		{name: "unknown", token: "nope", status: http.StatusUnauthorized, subject: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code)
+			require.Equal(t, tt.subject, rec.Header().Get("X-Subject"))
+		})
+	}
+}
@@ -2,30 +2,70 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
-	"slices"
+	"strings"
 
 	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
 	"github.com/go-chi/render"
 )
 
-func ValidateToken(authTokens []string) func(http.Handler) http.Handler {
+const (
+	bearerScheme = "Bearer"
+	realm        = "go-idasen-desk"
+)
+
+var (
+	ErrMissingToken = errors.New("missing token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired or not yet valid")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// ValidateToken authenticates requests against the configured static tokens. The token is read from the
+// Authorization header, either as "Bearer <token>" (RFC 6750) or as the bare token.
+func ValidateToken(authTokens []config.AuthToken) func(http.Handler) http.Handler {
+	return Authenticate(NewStaticTokenValidator(authTokens))
+}
+
+// Authenticate tries each validator in order and stores the resulting Identity in the request context. Requests
+// with a verified TLS client certificate are first offered to the validators implementing PeerValidator.
+func Authenticate(validators ...Validator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			token := r.Header.Get("Authorization")
+			if identity, ok := validatePeer(r, validators); ok {
+				next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+
+				return
+			}
+
+			token, err := ParseAuthorization(r.Header.Get("Authorization"))
+			if err != nil {
+				renderUnauthorized(w, r, err)
+
+				return
+			}
+
+			identity, err := validate(r, validators, token)
+			if err != nil {
+				renderUnauthorized(w, r, err)
 
-			if token == "" || !slices.Contains(authTokens, token) {
-				resp := api.NewErrorResponse(
-					errors.New("Unauthorized"),
-					http.StatusUnauthorized,
-					http.StatusText(http.StatusUnauthorized),
-					"Unauthorized",
-					nil,
-				)
+				return
+			}
 
-				if err := render.Render(w, r, resp); err != nil {
-					render.Render(w, r, api.RenderErrorResponse(err)) //nolint: errcheck,gosec // ignore error
-				}
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// RequireScope rejects requests whose identity lacks the given scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := IdentityFromContext(r.Context())
+			if !ok || !identity.HasScope(scope) {
+				RenderForbidden(w, r, fmt.Errorf("%w: missing scope %s", ErrForbidden, scope))
 
 				return
 			}
@@ -34,3 +74,98 @@ func ValidateToken(authTokens []string) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// ParseAuthorization extracts the token from an Authorization header value.
+func ParseAuthorization(header string) (string, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return "", ErrMissingToken
+	}
+
+	scheme, token, found := strings.Cut(header, " ")
+	if !found {
+		if strings.EqualFold(header, bearerScheme) {
+			return "", ErrMissingToken
+		}
+
+		// Bare token, kept for compatibility with older clients
+		return header, nil
+	}
+
+	if !strings.EqualFold(scheme, bearerScheme) {
+		return "", ErrMissingToken
+	}
+
+	return strings.TrimSpace(token), nil
+}
+
+func RenderForbidden(w http.ResponseWriter, r *http.Request, err error) {
+	resp := api.NewErrorResponse(
+		err,
+		http.StatusForbidden,
+		http.StatusText(http.StatusForbidden),
+		"Forbidden",
+		nil,
+	)
+
+	if renderErr := render.Render(w, r, resp); renderErr != nil {
+		render.Render(w, r, api.RenderErrorResponse(renderErr)) //nolint: errcheck,gosec // ignore error
+	}
+}
+
+func validate(r *http.Request, validators []Validator, token string) (*Identity, error) {
+	for _, validator := range validators {
+		identity, err := validator.Validate(r.Context(), token)
+		if err == nil {
+			return identity, nil
+		}
+
+		if !errors.Is(err, ErrInvalidToken) {
+			return nil, err
+		}
+	}
+
+	return nil, ErrInvalidToken
+}
+
+func validatePeer(r *http.Request, validators []Validator) (*Identity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+
+	for _, validator := range validators {
+		peerValidator, ok := validator.(PeerValidator)
+		if !ok {
+			continue
+		}
+
+		if identity, err := peerValidator.ValidatePeer(cert); err == nil {
+			return identity, true
+		}
+	}
+
+	return nil, false
+}
+
+func renderUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	challenge := fmt.Sprintf("%s realm=%q", bearerScheme, realm)
+	if !errors.Is(err, ErrMissingToken) {
+		challenge += fmt.Sprintf(", error=\"invalid_token\", error_description=%q", err.Error())
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+
+	resp := api.NewErrorResponse(
+		err,
+		http.StatusUnauthorized,
+		http.StatusText(http.StatusUnauthorized),
+		"Unauthorized",
+		nil,
+	)
+
+	if renderErr := render.Render(w, r, resp); renderErr != nil {
+		render.Render(w, r, api.RenderErrorResponse(renderErr)) //nolint: errcheck,gosec // ignore error
+	}
+}
@@ -0,0 +1,111 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuthorization(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		header string
+		token  string
+		err    error
+	}{
+		{name: "bearer", header: "Bearer abc", token: "abc", err: nil},
+		{name: "bearer case insensitive", header: "bearer abc", token: "abc", err: nil},
+		{name: "bare token", header: "abc", token: "abc", err: nil},
+		{name: "empty", header: "", token: "", err: auth.ErrMissingToken},
+		{name: "other scheme", header: "Basic abc", token: "", err: auth.ErrMissingToken},
+		{name: "empty bearer", header: "Bearer  ", token: "", err: auth.ErrMissingToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			token, err := auth.ParseAuthorization(tt.header)
+			require.True(t, errors.Is(err, tt.err), "unexpected error: %v", err)
+			require.Equal(t, tt.token, token)
+		})
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	t.Parallel()
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	handler := auth.ValidateToken([]config.AuthToken{
+		{Token: "valid", Name: "", Scopes: nil, Desks: nil, ExpiresAt: nil, NotBefore: nil},
+		{Token: "expired", Name: "", Scopes: nil, Desks: nil, ExpiresAt: &past, NotBefore: nil},
+		{Token: "early", Name: "", Scopes: nil, Desks: nil, ExpiresAt: nil, NotBefore: &future},
+		{Token: "window", Name: "", Scopes: nil, Desks: nil, ExpiresAt: &future, NotBefore: &past},
+	})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name      string
+		header    string
+		status    int
+		challenge string
+	}{
+		{name: "bearer token", header: "Bearer valid", status: http.StatusOK, challenge: ""},
+		{name: "bare token", header: "valid", status: http.StatusOK, challenge: ""},
+		{name: "inside window", header: "Bearer window", status: http.StatusOK, challenge: ""},
+		{
+			name:      "missing",
+			header:    "",
+			status:    http.StatusUnauthorized,
+			challenge: `Bearer realm="go-idasen-desk"`,
+		},
+		{
+			name:      "unknown",
+			header:    "Bearer nope",
+			status:    http.StatusUnauthorized,
+			challenge: `Bearer realm="go-idasen-desk", error="invalid_token", error_description="invalid token"`,
+		},
+		{
+			name:   "expired",
+			header: "Bearer expired",
+			status: http.StatusUnauthorized,
+			challenge: `Bearer realm="go-idasen-desk", error="invalid_token", ` +
+				`error_description="token expired or not yet valid"`,
+		},
+		{
+			name:   "not yet valid",
+			header: "Bearer early",
+			status: http.StatusUnauthorized,
+			challenge: `Bearer realm="go-idasen-desk", error="invalid_token", ` +
+				`error_description="token expired or not yet valid"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code)
+			require.Equal(t, tt.challenge, rec.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
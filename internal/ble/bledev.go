@@ -1,9 +1,27 @@
 package ble
 
 import (
+	"errors"
+
 	goble "github.com/go-ble/ble"
 )
 
-func NewDevice(_ string, opts ...goble.Option) (goble.Device, error) { //nolint:ireturn // must return interface
-	return DefaultDevice(opts...)
+// DefaultAdapter is the adapter picked by the operating system.
+const DefaultAdapter = "default"
+
+var ErrInvalidAdapter = errors.New("invalid bluetooth adapter")
+
+// NewDevice opens the named adapter. On Linux, adapters are named after their HCI device, such as hci1.
+func NewDevice(name string, opts ...goble.Option) (goble.Device, error) { //nolint:ireturn // must return interface
+	adapterOpts, err := adapterOptions(name)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := DefaultDevice(append(adapterOpts, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return device, nil
 }
@@ -15,3 +15,12 @@ func DefaultDevice(opts ...goble.Option) (*darwin.Device, error) {
 
 	return device, nil
 }
+
+// adapterOptions only accepts the default adapter, as CoreBluetooth does not let clients choose one.
+func adapterOptions(name string) ([]goble.Option, error) {
+	if name == "" || name == DefaultAdapter {
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s, only the default adapter is supported on macOS", ErrInvalidAdapter, name)
+}
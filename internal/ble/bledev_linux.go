@@ -2,6 +2,8 @@ package ble
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	goble "github.com/go-ble/ble"
 	"github.com/go-ble/ble/linux"
@@ -15,3 +17,17 @@ func DefaultDevice(opts ...goble.Option) (*linux.Device, error) {
 
 	return device, nil
 }
+
+// adapterOptions selects the HCI device of the adapter, hci0 being the first one.
+func adapterOptions(name string) ([]goble.Option, error) {
+	if name == "" || name == DefaultAdapter {
+		return nil, nil
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(name, "hci"))
+	if err != nil || id < 0 {
+		return nil, fmt.Errorf("%w: %s, expected a name like hci0", ErrInvalidAdapter, name)
+	}
+
+	return []goble.Option{goble.OptDeviceID(id)}, nil
+}
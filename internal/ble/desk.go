@@ -6,107 +6,124 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
 	goble "github.com/go-ble/ble"
 )
 
 const (
-	heightCharUUID   = "99fa0021338a10248a49009c0215f78a"
-	controlCharrUUID = "99fa0002338a10248a49009c0215f78a"
+	heightCharUUID   = idasen.LinakHeightCharUUID
+	controlCharrUUID = idasen.LinakControlCharUUID
 	offsetHeight     = 6150
 	uint32Size       = 4 // 32 bits
+
+	// DPG commands are written as dpgRead and the command, followed by 0x00 to read a value or by dpgWrite, 0x01 and
+	// the data to set it. Responses start with dpgResponseOK and the length of the data.
+	dpgRead             = 0x7F
+	dpgWrite            = 0x80
+	dpgResponseOK       = 0x01
+	dpgHeaderSize       = 2
+	dpgCapabilities     = 0x80
+	dpgMemoryPosition1  = 0x89
+	memorySlotsMask     = 0x07
+	memoryPositionSize  = 2
+	maxMemoryPositionID = 0xFF
+
+	// DefaultWakeTimeout is how long a desk has to notify its height after the wake-up sent on connection.
+	DefaultWakeTimeout = 3 * time.Second
 )
 
 var (
+	ErrInvalidResponse        = errors.New("invalid response")
+	ErrControllerUnresponsive = errors.New("desk controller is unresponsive")
+
 	moveUpCmd                 = []byte{0x47, 0x00} //nolint:gochecknoglobals //needs to be a const
 	moveDownCmd               = []byte{0x46, 0x00} //nolint:gochecknoglobals //needs to be a const
 	stopCmd                   = []byte{0xFF, 0x00} //nolint:gochecknoglobals //needs to be a const
+	wakeUpCmd                 = []byte{0xFE, 0x00} //nolint:gochecknoglobals //needs to be a const
 	_           idasen.BTDesk = (*DeskClient)(nil)
+
+	// referenceInputStopCmd writes an empty reference input, which makes idle controllers take commands again.
+	referenceInputStopCmd = []byte{0x01, 0x80} //nolint:gochecknoglobals //needs to be a const
+
+	_ idasen.BTDeskMetadata = (*DeskClient)(nil)
 )
 
 type (
+	DeskClientOptions struct {
+		cache       *CharacteristicCache
+		wakeTimeout time.Duration
+	}
+	DeskClientOption func(*DeskClientOptions)
+	// DeskClient controls a desk. Its name and memory positions are only available when the desk exposes the device
+	// name and DPG characteristics.
 	DeskClient struct {
 		client      goble.Client
 		controlChar *goble.Characteristic
 		heightChar  *goble.Characteristic
+		nameChar    *goble.Characteristic
+		dpgChar     *goble.Characteristic
+		dpgMutex    sync.Mutex // a DPG command is a write followed by a read
 		logger      *slog.Logger
 	}
 )
 
-func NewDeskClientFunc(device goble.Device, logger *slog.Logger) idasen.NewBTClient {
+func NewDeskClientFunc(device goble.Device, logger *slog.Logger, opts ...DeskClientOption) idasen.NewBTClient {
 	return func(ctx context.Context, addr string) (idasen.BTDesk, error) {
-		return NewDeskClient(ctx, addr, device, logger)
+		return NewDeskClient(ctx, addr, device, logger, opts...)
 	}
 }
 
-func NewDeskClient(ctx context.Context, addr string, device goble.Device, logger *slog.Logger) (*DeskClient, error) {
-	bleAddr := goble.NewAddr(addr)
-
-	client, err := device.Dial(ctx, bleAddr)
-	if err != nil {
-		return nil, fmt.Errorf("dialing %s: %w", bleAddr.String(), err)
+func NewDeskClient(
+	ctx context.Context,
+	addr string,
+	device goble.Device,
+	logger *slog.Logger,
+	opts ...DeskClientOption,
+) (*DeskClient, error) {
+	options := &DeskClientOptions{
+		cache:       nil,
+		wakeTimeout: DefaultWakeTimeout,
 	}
 
-	services, err := client.DiscoverServices(nil)
-	if err != nil {
-		return nil, fmt.Errorf("discovering services: %w", err)
+	for _, opt := range opts {
+		opt(options)
 	}
 
-	var controlChar, heightChar *goble.Characteristic
-
-	for _, service := range services {
-		chars, err := client.DiscoverCharacteristics( //nolint:govet,shadow // this is the correct way to use it
-			nil,
-			service,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("discovering characteristics for service %s: %w", service.UUID.String(), err)
-		}
-
-		for _, char := range chars {
-			if char.UUID.String() == controlCharrUUID {
-				controlChar = char
-
-				break
-			} else if char.UUID.String() == heightCharUUID {
-				heightChar = char
+	bleAddr := goble.NewAddr(addr)
 
-				break
-			}
-		}
+	client, err := device.Dial(ctx, bleAddr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", bleAddr.String(), err)
 	}
 
-	if controlChar == nil {
-		if err = client.CancelConnection(); err != nil {
-			logger.ErrorContext(
-				ctx,
-				"Cancelling contection",
-				slog.String("error", err.Error()),
-				slog.String("address", addr),
-			)
-		}
-
-		return nil, fmt.Errorf("control characteristic '%s' not found", controlCharrUUID)
+	profile, err := loadProfile(ctx, client, addr, options.cache, logger)
+	if err == nil {
+		err = wakeUp(ctx, client, profile, options.wakeTimeout)
 	}
 
-	if heightChar == nil {
-		if err = client.CancelConnection(); err != nil {
+	if err != nil {
+		if cancelErr := client.CancelConnection(); cancelErr != nil {
 			logger.ErrorContext(
 				ctx,
 				"Cancelling contection",
-				slog.String("error", err.Error()),
+				slog.String("error", cancelErr.Error()),
 				slog.String("address", addr),
 			)
 		}
 
-		return nil, fmt.Errorf("height characteristic '%s' not found", heightCharUUID)
+		return nil, err
 	}
 
 	return &DeskClient{
 		client:      client,
-		controlChar: controlChar,
-		heightChar:  heightChar,
+		controlChar: profile.control,
+		heightChar:  profile.height,
+		nameChar:    profile.name,
+		dpgChar:     profile.dpg,
+		dpgMutex:    sync.Mutex{},
 		logger: logger.With(
 			slog.String("component", "ble-desk-client"),
 			slog.String("address", client.Addr().String()),
@@ -114,6 +131,91 @@ func NewDeskClient(ctx context.Context, addr string, device goble.Device, logger
 	}, nil
 }
 
+// loadProfile returns the cached characteristics of the desk, if they can still be read, or discovers them.
+func loadProfile(
+	ctx context.Context,
+	client goble.Client,
+	addr string,
+	cache *CharacteristicCache,
+	logger *slog.Logger,
+) (deskProfile, error) {
+	if cache == nil {
+		return discoverProfile(client)
+	}
+
+	if profile, ok := cache.get(addr); ok {
+		if _, err := client.ReadCharacteristic(profile.height); err == nil {
+			logger.DebugContext(ctx, "Using cached characteristics", slog.String("address", addr))
+
+			return profile, nil
+		}
+
+		logger.InfoContext(ctx, "Cached characteristics are stale, discovering them", slog.String("address", addr))
+		cache.forget(addr)
+	}
+
+	profile, err := discoverProfile(client)
+	if err != nil {
+		return profile, err
+	}
+
+	cache.put(addr, profile)
+
+	return profile, nil
+}
+
+// wakeUp sends the wake-up command, and clears the reference input when the desk has one, so a controller that was
+// idling takes movement commands again. Controllers that are awake notify their height in response, the others
+// silently ignore every command. A zero timeout skips the wake-up.
+func wakeUp(ctx context.Context, client goble.Client, profile deskProfile, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+
+	notified := make(chan struct{}, 1)
+
+	err := client.Subscribe(profile.height, false, func([]byte) {
+		select {
+		case notified <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("subscribing to height characteristic %s: %w", profile.height.UUID.String(), err)
+	}
+
+	err = client.WriteCharacteristic(profile.control, wakeUpCmd, true)
+	if err == nil && profile.referenceInput != nil {
+		err = client.WriteCharacteristic(profile.referenceInput, referenceInputStopCmd, true)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("writing wake-up command: %w", err)
+	} else {
+		err = waitForNotification(ctx, notified, timeout)
+	}
+
+	if unsubscribeErr := client.Unsubscribe(profile.height, false); unsubscribeErr != nil && err == nil {
+		err = fmt.Errorf("unsubscribing from height characteristic %s: %w", profile.height.UUID.String(), unsubscribeErr)
+	}
+
+	return err
+}
+
+func waitForNotification(ctx context.Context, notified <-chan struct{}, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-notified:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: no height notification within %s of waking it up", ErrControllerUnresponsive, timeout)
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the desk to wake up: %w", ctx.Err())
+	}
+}
+
 func (c *DeskClient) ReadHeight() (int, error) {
 	value, err := c.client.ReadCharacteristic(c.heightChar)
 	if err != nil {
@@ -209,6 +311,112 @@ func (c *DeskClient) Close() error {
 	return nil
 }
 
+func (c *DeskClient) ReadName() (string, error) {
+	if c.nameChar == nil {
+		return "", idasen.ErrMetadataUnsupported
+	}
+
+	value, err := c.client.ReadCharacteristic(c.nameChar)
+	if err != nil {
+		return "", fmt.Errorf("reading device name characteristic: %w", err)
+	}
+
+	return string(value), nil
+}
+
+func (c *DeskClient) WriteName(name string) error {
+	if c.nameChar == nil {
+		return idasen.ErrMetadataUnsupported
+	}
+
+	if err := c.client.WriteCharacteristic(c.nameChar, []byte(name), false); err != nil {
+		return fmt.Errorf("writing device name characteristic: %w", err)
+	}
+
+	return nil
+}
+
+// ReadMemoryPositions reads as many memory positions as the capabilities of the controller report.
+func (c *DeskClient) ReadMemoryPositions() ([]int, error) {
+	capabilities, err := c.dpgCommand(dpgCapabilities, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading capabilities: %w", err)
+	}
+
+	if len(capabilities) == 0 {
+		return nil, fmt.Errorf("%w: empty capabilities", ErrInvalidResponse)
+	}
+
+	slots := int(capabilities[0] & memorySlotsMask)
+	positions := make([]int, slots)
+
+	for slot := range slots {
+		data, err := c.dpgCommand(memoryPositionCommand(slot+1), nil)
+		if err != nil {
+			return nil, fmt.Errorf("reading memory position %d: %w", slot+1, err)
+		}
+
+		// Empty slots have no data
+		if len(data) >= memoryPositionSize {
+			positions[slot] = int(binary.LittleEndian.Uint16(data)) + offsetHeight
+		}
+	}
+
+	return positions, nil
+}
+
+func (c *DeskClient) WriteMemoryPosition(slot, height int) error {
+	if slot < 1 || dpgMemoryPosition1+slot-1 > maxMemoryPositionID {
+		return idasen.ErrInvalidMemorySlot
+	}
+
+	if height < offsetHeight {
+		return idasen.ErrInvalidHeight
+	}
+
+	data := binary.LittleEndian.AppendUint16(nil, uint16(height-offsetHeight)) //nolint:gosec // checked above
+
+	if _, err := c.dpgCommand(memoryPositionCommand(slot), data); err != nil {
+		return fmt.Errorf("writing memory position %d: %w", slot, err)
+	}
+
+	return nil
+}
+
+// dpgCommand writes a DPG command, with data if it sets a value, and returns the data of the response.
+func (c *DeskClient) dpgCommand(command byte, data []byte) ([]byte, error) {
+	if c.dpgChar == nil {
+		return nil, idasen.ErrMetadataUnsupported
+	}
+
+	request := []byte{dpgRead, command, 0x00}
+	if data != nil {
+		request = append([]byte{dpgRead, command, dpgWrite, 0x01}, data...)
+	}
+
+	c.dpgMutex.Lock()
+	defer c.dpgMutex.Unlock()
+
+	if err := c.client.WriteCharacteristic(c.dpgChar, request, false); err != nil {
+		return nil, fmt.Errorf("writing command 0x%X to characteristic %s: %w", request, c.dpgChar.UUID.String(), err)
+	}
+
+	response, err := c.client.ReadCharacteristic(c.dpgChar)
+	if err != nil {
+		return nil, fmt.Errorf("reading characteristic %s: %w", c.dpgChar.UUID.String(), err)
+	}
+
+	if len(response) < dpgHeaderSize || response[0] != dpgResponseOK {
+		return nil, fmt.Errorf("%w: 0x%X", ErrInvalidResponse, response)
+	}
+
+	return response[dpgHeaderSize:], nil
+}
+
+func memoryPositionCommand(slot int) byte {
+	return byte(dpgMemoryPosition1 + slot - 1) //nolint:gosec // slots are checked by the callers
+}
+
 func (c *DeskClient) parseHeight(data []byte) (int, error) {
 	if len(data) < uint32Size {
 		return 0, errors.New("invalid data length")
@@ -218,3 +426,17 @@ func (c *DeskClient) parseHeight(data []byte) (int, error) {
 
 	return height, nil
 }
+
+// DeskClientOptionsWithCache reuses the characteristics found on previous connections to the same desk.
+func DeskClientOptionsWithCache(cache *CharacteristicCache) DeskClientOption {
+	return func(o *DeskClientOptions) {
+		o.cache = cache
+	}
+}
+
+// DeskClientOptionsWithWakeTimeout sets how long a desk has to answer the wake-up sent on connection. 0 skips it.
+func DeskClientOptionsWithWakeTimeout(timeout time.Duration) DeskClientOption {
+	return func(o *DeskClientOptions) {
+		o.wakeTimeout = timeout
+	}
+}
@@ -0,0 +1,168 @@
+package ble
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/stretchr/testify/require"
+)
+
+const testAddr = "E8:5B:5B:24:3A:11"
+
+func TestLoadProfile(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.DiscardHandler)
+
+	tests := map[string]struct {
+		cache         bool
+		cached        bool
+		readErr       error
+		noDesk        bool
+		wantDiscovery bool
+		wantCached    bool
+	}{
+		"without cache": {
+			cache: false, cached: false, readErr: nil, noDesk: false, wantDiscovery: true, wantCached: false,
+		},
+		"caches discovered characteristics": {
+			cache: true, cached: false, readErr: nil, noDesk: false, wantDiscovery: true, wantCached: true,
+		},
+		"uses cached characteristics": {
+			cache: true, cached: true, readErr: nil, noDesk: false, wantDiscovery: false, wantCached: true,
+		},
+		"discovers again when cached characteristics are stale": {
+			cache: true, cached: true, readErr: errFakeRead, noDesk: false, wantDiscovery: true, wantCached: true,
+		},
+		"drops stale characteristics that cannot be discovered again": {
+			cache: true, cached: true, readErr: errFakeRead, noDesk: true, wantDiscovery: true, wantCached: false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var cache *CharacteristicCache
+			if tt.cache {
+				cache = NewCharacteristicCache()
+			}
+
+			stale, err := discoverProfile(newFakeClient(
+				newService(idasen.LinakControlServiceUUID, controlCharrUUID, heightCharUUID),
+			))
+			require.NoError(t, err)
+
+			if tt.cached {
+				cache.put(testAddr, stale)
+			}
+
+			client := newFakeClient(
+				newService(idasen.LinakControlServiceUUID, controlCharrUUID),
+				newService(referenceOutputServiceUUID, heightCharUUID),
+			)
+			if tt.noDesk {
+				client = newFakeClient(newService(genericAccessServiceUUID, idasen.GATTDeviceNameCharUUID))
+			}
+
+			client.readErr = tt.readErr
+
+			profile, err := loadProfile(t.Context(), client, testAddr, cache, logger)
+			if tt.noDesk {
+				require.ErrorIs(t, err, ErrMissingCharacteristic)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.Equal(t, tt.wantDiscovery, client.discoveries() > 0)
+
+			if !tt.wantDiscovery {
+				require.Same(t, stale.height, profile.height, "should use the cached characteristics")
+			} else if err == nil {
+				require.NotSame(t, stale.height, profile.height, "should use the discovered characteristics")
+			}
+
+			if tt.cache {
+				got, ok := cache.get(testAddr)
+				require.Equal(t, tt.wantCached, ok)
+
+				if ok {
+					require.Same(t, profile.height, got.height)
+				}
+			}
+		})
+	}
+}
+
+func TestWakeUp(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		awake      bool
+		writeErr   error
+		timeout    time.Duration
+		wantErr    error
+		wantWrites [][]byte
+	}{
+		"wakes up controllers that notify their height": {
+			awake:      true,
+			writeErr:   nil,
+			timeout:    time.Second,
+			wantErr:    nil,
+			wantWrites: [][]byte{wakeUpCmd, referenceInputStopCmd},
+		},
+		"times out on unresponsive controllers": {
+			awake:      false,
+			writeErr:   nil,
+			timeout:    10 * time.Millisecond,
+			wantErr:    ErrControllerUnresponsive,
+			wantWrites: [][]byte{wakeUpCmd, referenceInputStopCmd},
+		},
+		"unsubscribes when the wake-up cannot be written": {
+			awake:      true,
+			writeErr:   errFakeWrite,
+			timeout:    time.Second,
+			wantErr:    errFakeWrite,
+			wantWrites: nil,
+		},
+		"skips the wake-up without timeout": {
+			awake:      false,
+			writeErr:   nil,
+			timeout:    0,
+			wantErr:    nil,
+			wantWrites: nil,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := newFakeClient(
+				newService(idasen.LinakControlServiceUUID, controlCharrUUID),
+				newService(referenceOutputServiceUUID, heightCharUUID),
+				newService(referenceInputServiceUUID, referenceInputCharUUID),
+			)
+
+			profile, err := discoverProfile(client)
+			require.NoError(t, err)
+
+			client.awake = tt.awake
+			client.writeErr = tt.writeErr
+
+			err = wakeUp(t.Context(), client, profile, tt.timeout)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.Equal(t, tt.wantWrites, client.writes)
+			require.Equal(t, client.subscribes, client.unsubscribes, "should always unsubscribe")
+			require.Equal(t, tt.timeout > 0, client.subscribes == 1)
+			require.Empty(t, client.handlers)
+		})
+	}
+}
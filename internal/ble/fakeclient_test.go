@@ -0,0 +1,150 @@
+package ble
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	goble "github.com/go-ble/ble"
+)
+
+var (
+	errFakeRead  = errors.New("fake read failed")
+	errFakeWrite = errors.New("fake write failed")
+)
+
+// fakeClient is a goble.Client serving the given services. Only the methods needed to connect to a desk are
+// implemented, the others panic through the nil embedded client. When awake, writing the wake-up command notifies
+// the height synchronously, like the BLE stack does.
+type fakeClient struct {
+	goble.Client
+
+	mutex        sync.Mutex
+	services     []*goble.Service
+	readErr      error
+	writeErr     error
+	awake        bool
+	handlers     map[*goble.Characteristic]goble.NotificationHandler
+	writes       [][]byte
+	discovers    int
+	subscribes   int
+	unsubscribes int
+}
+
+func newFakeClient(services ...*goble.Service) *fakeClient {
+	return &fakeClient{
+		Client:       nil,
+		mutex:        sync.Mutex{},
+		services:     services,
+		readErr:      nil,
+		writeErr:     nil,
+		awake:        false,
+		handlers:     map[*goble.Characteristic]goble.NotificationHandler{},
+		writes:       nil,
+		discovers:    0,
+		subscribes:   0,
+		unsubscribes: 0,
+	}
+}
+
+// newService returns a service with a characteristic per UUID.
+func newService(uuid string, chars ...string) *goble.Service {
+	service := goble.NewService(goble.MustParse(uuid))
+
+	for _, char := range chars {
+		service.NewCharacteristic(goble.MustParse(char))
+	}
+
+	return service
+}
+
+func (f *fakeClient) DiscoverServices(filter []goble.UUID) ([]*goble.Service, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.discovers++
+
+	var services []*goble.Service
+
+	for _, service := range f.services {
+		if slices.ContainsFunc(filter, service.UUID.Equal) {
+			services = append(services, service)
+		}
+	}
+
+	return services, nil
+}
+
+func (f *fakeClient) DiscoverCharacteristics(_ []goble.UUID, service *goble.Service) ([]*goble.Characteristic, error) {
+	return service.Characteristics, nil
+}
+
+func (f *fakeClient) DiscoverDescriptors(_ []goble.UUID, char *goble.Characteristic) ([]*goble.Descriptor, error) {
+	return char.Descriptors, nil
+}
+
+func (f *fakeClient) ReadCharacteristic(*goble.Characteristic) ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.readErr != nil {
+		return nil, f.readErr
+	}
+
+	return []byte{0x00, 0x00, 0x00, 0x00}, nil
+}
+
+func (f *fakeClient) discoveries() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.discovers
+}
+
+func (f *fakeClient) WriteCharacteristic(char *goble.Characteristic, value []byte, _ bool) error {
+	f.mutex.Lock()
+
+	if f.writeErr != nil {
+		f.mutex.Unlock()
+
+		return f.writeErr
+	}
+
+	f.writes = append(f.writes, value)
+
+	var notify []goble.NotificationHandler
+
+	if f.awake && slices.Equal(value, wakeUpCmd) {
+		for _, handler := range f.handlers {
+			notify = append(notify, handler)
+		}
+	}
+
+	f.mutex.Unlock()
+
+	for _, handler := range notify {
+		handler([]byte{0x00, 0x00, 0x00, 0x00})
+	}
+
+	return nil
+}
+
+func (f *fakeClient) Subscribe(char *goble.Characteristic, _ bool, handler goble.NotificationHandler) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.subscribes++
+	f.handlers[char] = handler
+
+	return nil
+}
+
+func (f *fakeClient) Unsubscribe(char *goble.Characteristic, _ bool) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.unsubscribes++
+	delete(f.handlers, char)
+
+	return nil
+}
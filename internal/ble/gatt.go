@@ -0,0 +1,144 @@
+package ble
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	goble "github.com/go-ble/ble"
+)
+
+const (
+	referenceOutputServiceUUID = "99fa0020338a10248a49009c0215f78a"
+	referenceInputServiceUUID  = "99fa0030338a10248a49009c0215f78a"
+	referenceInputCharUUID     = "99fa0031338a10248a49009c0215f78a"
+	dpgServiceUUID             = "99fa0010338a10248a49009c0215f78a"
+	genericAccessServiceUUID   = "1800"
+)
+
+var ErrMissingCharacteristic = errors.New("missing characteristic")
+
+type (
+	// MissingCharacteristicError is returned when a desk lacks a characteristic required to control it. It matches
+	// ErrMissingCharacteristic.
+	MissingCharacteristicError struct {
+		Name           string
+		Service        string
+		Characteristic string
+	}
+	// CharacteristicCache keeps the characteristics found on every desk, so reconnections skip the discovery. The
+	// cached handles are only valid on Linux, where they are the attribute handles of the desk.
+	CharacteristicCache struct {
+		mutex    sync.Mutex
+		profiles map[string]deskProfile
+	}
+	// deskProfile holds the characteristics of a desk. Reference input, name and dpg are optional.
+	deskProfile struct {
+		control        *goble.Characteristic
+		height         *goble.Characteristic
+		referenceInput *goble.Characteristic
+		name           *goble.Characteristic
+		dpg            *goble.Characteristic
+	}
+)
+
+func NewCharacteristicCache() *CharacteristicCache {
+	return &CharacteristicCache{
+		mutex:    sync.Mutex{},
+		profiles: map[string]deskProfile{},
+	}
+}
+
+func (e *MissingCharacteristicError) Error() string {
+	return fmt.Sprintf("%s characteristic %s not found in service %s", e.Name, e.Characteristic, e.Service)
+}
+
+func (e *MissingCharacteristicError) Unwrap() error {
+	return ErrMissingCharacteristic
+}
+
+func (c *CharacteristicCache) get(addr string) (deskProfile, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	profile, ok := c.profiles[addr]
+
+	return profile, ok
+}
+
+func (c *CharacteristicCache) put(addr string, profile deskProfile) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.profiles[addr] = profile
+}
+
+func (c *CharacteristicCache) forget(addr string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.profiles, addr)
+}
+
+// discoverProfile discovers the characteristics of the Linak and generic access services only, instead of every
+// service of the desk. The descriptors of the height characteristic are discovered as well, as subscribing needs its
+// configuration descriptor.
+func discoverProfile(client goble.Client) (deskProfile, error) {
+	profile := deskProfile{control: nil, height: nil, referenceInput: nil, name: nil, dpg: nil}
+
+	services, err := client.DiscoverServices([]goble.UUID{
+		goble.MustParse(idasen.LinakControlServiceUUID),
+		goble.MustParse(referenceOutputServiceUUID),
+		goble.MustParse(referenceInputServiceUUID),
+		goble.MustParse(dpgServiceUUID),
+		goble.MustParse(genericAccessServiceUUID),
+	})
+	if err != nil {
+		return profile, fmt.Errorf("discovering services: %w", err)
+	}
+
+	for _, service := range services {
+		chars, charsErr := client.DiscoverCharacteristics(nil, service)
+		if charsErr != nil {
+			return profile, fmt.Errorf("discovering characteristics for service %s: %w", service.UUID.String(), charsErr)
+		}
+
+		for _, char := range chars {
+			switch char.UUID.String() {
+			case controlCharrUUID:
+				profile.control = char
+			case heightCharUUID:
+				profile.height = char
+			case referenceInputCharUUID:
+				profile.referenceInput = char
+			case idasen.LinakDPGCharUUID:
+				profile.dpg = char
+			case idasen.GATTDeviceNameCharUUID:
+				profile.name = char
+			}
+		}
+	}
+
+	if profile.control == nil {
+		return profile, &MissingCharacteristicError{
+			Name:           "control",
+			Service:        idasen.LinakControlServiceUUID,
+			Characteristic: controlCharrUUID,
+		}
+	}
+
+	if profile.height == nil {
+		return profile, &MissingCharacteristicError{
+			Name:           "height",
+			Service:        referenceOutputServiceUUID,
+			Characteristic: heightCharUUID,
+		}
+	}
+
+	if _, err = client.DiscoverDescriptors(nil, profile.height); err != nil {
+		return profile, fmt.Errorf("discovering descriptors of the height characteristic: %w", err)
+	}
+
+	return profile, nil
+}
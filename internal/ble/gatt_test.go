@@ -0,0 +1,98 @@
+package ble
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	goble "github.com/go-ble/ble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverProfile(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		services []*goble.Service
+		missing  *MissingCharacteristicError
+		optional bool
+	}{
+		"linak services": {
+			services: []*goble.Service{
+				newService(idasen.LinakControlServiceUUID, controlCharrUUID),
+				newService(referenceOutputServiceUUID, heightCharUUID),
+				newService(referenceInputServiceUUID, referenceInputCharUUID),
+				newService(dpgServiceUUID, idasen.LinakDPGCharUUID),
+				newService(genericAccessServiceUUID, idasen.GATTDeviceNameCharUUID),
+			},
+			missing:  nil,
+			optional: true,
+		},
+		"control and height in the same service": {
+			services: []*goble.Service{
+				newService(idasen.LinakControlServiceUUID, controlCharrUUID, heightCharUUID),
+			},
+			missing:  nil,
+			optional: false,
+		},
+		"missing control": {
+			services: []*goble.Service{
+				newService(referenceOutputServiceUUID, heightCharUUID),
+			},
+			missing: &MissingCharacteristicError{
+				Name:           "control",
+				Service:        idasen.LinakControlServiceUUID,
+				Characteristic: controlCharrUUID,
+			},
+			optional: false,
+		},
+		"missing height": {
+			services: []*goble.Service{
+				newService(idasen.LinakControlServiceUUID, controlCharrUUID),
+				newService(genericAccessServiceUUID, idasen.GATTDeviceNameCharUUID),
+			},
+			missing: &MissingCharacteristicError{
+				Name:           "height",
+				Service:        referenceOutputServiceUUID,
+				Characteristic: heightCharUUID,
+			},
+			optional: false,
+		},
+		"characteristics of other services": {
+			services: []*goble.Service{
+				newService("180f", controlCharrUUID, heightCharUUID),
+			},
+			missing: &MissingCharacteristicError{
+				Name:           "control",
+				Service:        idasen.LinakControlServiceUUID,
+				Characteristic: controlCharrUUID,
+			},
+			optional: false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			profile, err := discoverProfile(newFakeClient(tt.services...))
+
+			if tt.missing != nil {
+				require.ErrorIs(t, err, ErrMissingCharacteristic)
+
+				var missing *MissingCharacteristicError
+				require.True(t, errors.As(err, &missing))
+				require.Equal(t, tt.missing, missing)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, controlCharrUUID, profile.control.UUID.String())
+			require.Equal(t, heightCharUUID, profile.height.UUID.String())
+			require.Equal(t, tt.optional, profile.referenceInput != nil)
+			require.Equal(t, tt.optional, profile.dpg != nil)
+			require.Equal(t, tt.optional, profile.name != nil)
+		})
+	}
+}
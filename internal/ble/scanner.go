@@ -5,7 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"regexp"
+	"slices"
 	"time"
 
 	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
@@ -26,54 +26,87 @@ func NewScanner(device goble.Device, logger *slog.Logger) *Scanner {
 	}
 }
 
-func (s *Scanner) ScanByName(
+// Scan listens to advertisements until timeout and returns the devices selected by filter. Advertisements and scan
+// responses of the same device are merged, as the name and the services may come in different packets.
+func (s *Scanner) Scan(
 	ctx context.Context,
-	nameRegexp string,
+	filter idasen.ScanFilter,
 	timeout time.Duration,
 ) ([]idasen.Advertisement, error) {
-	rgxp, err := regexp.Compile(nameRegexp)
-	if err != nil {
-		return nil, fmt.Errorf("compiling regexp: %w", err)
-	}
-
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	s.logger.DebugContext(ctxWithTimeout, "Starting scan")
 
-	advs := make([]idasen.Advertisement, 0)
+	var addrs []string
+
+	advsMap := make(map[string]*idasen.Advertisement)
+
+	err := s.device.Scan(ctxWithTimeout, true, func(a goble.Advertisement) {
+		addr := a.Addr().String()
+
+		adv, ok := advsMap[addr]
+		if !ok {
+			adv = &idasen.Advertisement{
+				Name:             "",
+				Addr:             addr,
+				RSSI:             0,
+				Connectable:      false,
+				ServiceUUIDs:     nil,
+				ManufacturerData: nil,
+				Adapter:          "",
+			}
+			advsMap[addr] = adv
+			addrs = append(addrs, addr)
+		}
 
-	advsMap := make(map[string]bool)
+		mergeAdvertisement(adv, a)
+	})
 
-	err = s.device.Scan(ctxWithTimeout, false, func(a goble.Advertisement) {
-		if _, ok := advsMap[a.Addr().String()]; ok {
-			return
-		}
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("scanning: %w", err)
+	}
 
-		// Ignore duplicates
-		advsMap[a.Addr().String()] = true
+	advs := make([]idasen.Advertisement, 0)
 
-		matches := rgxp.MatchString(a.LocalName())
+	for _, addr := range addrs {
+		adv := advsMap[addr]
+		matches := filter.Matches(*adv)
 
 		s.logger.DebugContext(
 			ctx,
 			"Advertisement found",
 			slog.Bool("matches", matches),
-			slog.String("address", a.Addr().String()),
-			slog.String("name", a.LocalName()),
+			slog.String("address", adv.Addr),
+			slog.String("name", adv.Name),
+			slog.Int("rssi", adv.RSSI),
+			slog.Bool("connectable", adv.Connectable),
+			slog.Any("services", adv.ServiceUUIDs),
 		)
 
 		if matches {
-			advs = append(advs, idasen.Advertisement{
-				Name: a.LocalName(),
-				Addr: a.Addr().String(),
-			})
+			advs = append(advs, *adv)
 		}
-	})
-
-	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
-		return nil, fmt.Errorf("scanning: %w", err)
 	}
 
 	return advs, nil
 }
+
+func mergeAdvertisement(adv *idasen.Advertisement, a goble.Advertisement) {
+	adv.RSSI = a.RSSI()
+	adv.Connectable = adv.Connectable || a.Connectable()
+
+	if name := a.LocalName(); name != "" {
+		adv.Name = name
+	}
+
+	if data := a.ManufacturerData(); len(data) > 0 {
+		adv.ManufacturerData = data
+	}
+
+	for _, service := range append(a.Services(), a.OverflowService()...) {
+		if uuid := service.String(); !slices.Contains(adv.ServiceUUIDs, uuid) {
+			adv.ServiceUUIDs = append(adv.ServiceUUIDs, uuid)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+)
+
+var ErrInvalidTLSVersion = errors.New("invalid tls version")
+
+type (
+	// Reloader serves the configured certificate and client CA pool, reloading them when the files change.
+	Reloader struct {
+		config    config.TLSConfig
+		logger    *slog.Logger
+		mutex     sync.RWMutex
+		cert      *tls.Certificate
+		clientCAs *x509.CertPool
+		modTimes  map[string]time.Time
+	}
+)
+
+func NewReloader(cfg config.TLSConfig, logger *slog.Logger) (*Reloader, error) {
+	reloader := &Reloader{
+		config:    cfg,
+		logger:    logger.With(slog.String("component", "tls-reloader")),
+		mutex:     sync.RWMutex{},
+		cert:      nil,
+		clientCAs: nil,
+		modTimes:  map[string]time.Time{},
+	}
+
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// TLSConfig returns a server configuration that always uses the latest loaded certificate and client CAs.
+func (r *Reloader) TLSConfig() (*tls.Config, error) {
+	minVersion, err := ParseTLSVersion(r.config.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{ //nolint:exhaustruct // only the relevant fields are set
+		MinVersion: minVersion,
+	}
+
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		return &tls.Config{ //nolint:exhaustruct // only the relevant fields are set
+			MinVersion:   minVersion,
+			NextProtos:   base.NextProtos, // set by http.Server for HTTP/2
+			Certificates: []tls.Certificate{*r.cert},
+			ClientCAs:    r.clientCAs,
+			ClientAuth:   r.clientAuth(),
+		}, nil
+	}
+
+	return base, nil
+}
+
+// Run polls the certificate files until the context is done.
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+
+			if err := r.load(); err != nil {
+				r.logger.ErrorContext(ctx, "Error reloading certificates", slog.String("error", err.Error()))
+
+				continue
+			}
+
+			r.logger.InfoContext(ctx, "Certificates reloaded")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *Reloader) clientAuth() tls.ClientAuthType {
+	switch {
+	case r.clientCAs == nil:
+		return tls.NoClientCert
+	case r.config.RequireClientCert:
+		return tls.RequireAndVerifyClientCert
+	default:
+		return tls.VerifyClientCertIfGiven
+	}
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.ClientCAFile != "" {
+		files = append(files, r.config.ClientCAFile)
+	}
+
+	return files
+}
+
+func (r *Reloader) changed() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			// Files may be briefly missing while being replaced
+			continue
+		}
+
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Reloader) load() error {
+	modTimes := make(map[string]time.Time, len(r.files()))
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", file, err)
+		}
+
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading key pair: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+
+	if r.config.ClientCAFile != "" {
+		caPEM, readErr := os.ReadFile(r.config.ClientCAFile)
+		if readErr != nil {
+			return fmt.Errorf("reading client ca file: %w", readErr)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return errors.New("no certificates found in client ca file")
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+
+	return nil
+}
+
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("%w: %q, supported versions are 1.2 and 1.3", ErrInvalidTLSVersion, version)
+	}
+}
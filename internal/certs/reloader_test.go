@@ -0,0 +1,179 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/logging"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/certs"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, commonName string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+
+	if keyFile == "" {
+		return
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key} //nolint:exhaustruct // test cert
+}
+
+func TestReloaderServesMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server-key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+
+	ca := newTestCert(t, "test-ca", nil, true)
+	ca.write(t, caFile, "")
+
+	first := newTestCert(t, "server-1", ca, false)
+	first.write(t, certFile, keyFile)
+
+	reloader, err := certs.NewReloader(config.TLSConfig{
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		MinVersion:        "1.3",
+		ClientCAFile:      caFile,
+		RequireClientCert: true,
+		ClientIdentities:  nil,
+		ReloadInterval:    10 * time.Millisecond,
+	}, logging.NewLogger())
+	require.NoError(t, err)
+
+	tlsConfig, err := reloader.TLSConfig()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go reloader.Run(ctx)
+
+	validator := auth.NewCertificateValidator([]config.ClientIdentity{
+		{CommonName: "kiosk", Name: "meeting-room", Scopes: nil, Desks: nil},
+	})
+
+	server := httptest.NewUnstartedServer(auth.Authenticate(validator)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, _ := auth.IdentityFromContext(r.Context())
+			w.Header().Set("X-Subject", identity.Subject)
+		}),
+	))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	client := &http.Client{Transport: &http.Transport{ //nolint:exhaustruct // test client
+		TLSClientConfig: &tls.Config{ //nolint:exhaustruct // test client
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: []tls.Certificate{newTestCert(t, "kiosk", ca, false).tlsCertificate()},
+		},
+		DisableKeepAlives: true,
+	}}
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "meeting-room", resp.Header.Get("X-Subject"))
+	require.Equal(t, "server-1", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	// Make sure the modification time changes on filesystems with coarse timestamps
+	second := newTestCert(t, "server-2", ca, false)
+	second.write(t, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	require.Eventually(t, func() bool {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+
+		return resp.TLS.PeerCertificates[0].Subject.CommonName == "server-2"
+	}, 2*time.Second, 20*time.Millisecond, "should serve the reloaded certificate")
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	t.Parallel()
+
+	version, err := certs.ParseTLSVersion("1.3")
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), version)
+
+	_, err = certs.ParseTLSVersion("1.0")
+	require.Error(t, err)
+}
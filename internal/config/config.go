@@ -1,32 +1,282 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+var ErrInvalidConfig = errors.New("invalid config")
+
 type (
+	// AuthToken is a static API token. In the config file it can be written either as a bare string or as a
+	// mapping with an optional validity window.
+	AuthToken struct {
+		Token     string     `yaml:"token"`
+		Name      string     `yaml:"name,omitempty"`
+		Scopes    []string   `yaml:"scopes,omitempty"`
+		Desks     []string   `yaml:"desks,omitempty"`
+		ExpiresAt *time.Time `yaml:"expires_at,omitempty"`
+		NotBefore *time.Time `yaml:"not_before,omitempty"`
+	}
+	// JWTConfig enables authentication with signed JWTs verified against a JWKS.
+	JWTConfig struct {
+		JWKSFile        string              `yaml:"jwks_file,omitempty"`
+		JWKSURL         string              `yaml:"jwks_url,omitempty"`
+		RefreshInterval time.Duration       `yaml:"refresh_interval,omitempty"`
+		Issuer          string              `yaml:"issuer,omitempty"`
+		Audience        string              `yaml:"audience,omitempty"`
+		Leeway          time.Duration       `yaml:"leeway,omitempty"`
+		SubjectClaim    string              `yaml:"subject_claim,omitempty"`
+		ScopesClaim     string              `yaml:"scopes_claim,omitempty"`
+		DesksClaim      string              `yaml:"desks_claim,omitempty"`
+		ScopeMapping    map[string][]string `yaml:"scope_mapping,omitempty"`
+	}
+	// TLSConfig enables HTTPS. Setting ClientCAFile enables mutual TLS, where the common name of a verified client
+	// certificate is looked up in ClientIdentities. RequireClientCert rejects clients without one, and needs ClientCAFile.
+	TLSConfig struct {
+		CertFile          string           `yaml:"cert_file"`
+		KeyFile           string           `yaml:"key_file"`
+		MinVersion        string           `yaml:"min_version,omitempty"`
+		ClientCAFile      string           `yaml:"client_ca_file,omitempty"`
+		RequireClientCert bool             `yaml:"require_client_cert,omitempty"`
+		ClientIdentities  []ClientIdentity `yaml:"client_identities,omitempty"`
+		ReloadInterval    time.Duration    `yaml:"reload_interval,omitempty"`
+	}
+	ClientIdentity struct {
+		CommonName string   `yaml:"common_name"`
+		Name       string   `yaml:"name,omitempty"`
+		Scopes     []string `yaml:"scopes,omitempty"`
+		Desks      []string `yaml:"desks,omitempty"`
+	}
+	// RateLimitConfig limits move requests per caller and per desk, and enforces a cool-down between moves.
+	RateLimitConfig struct {
+		Token        *BucketConfig `yaml:"token,omitempty"`
+		Desk         *BucketConfig `yaml:"desk,omitempty"`
+		MoveCooldown time.Duration `yaml:"move_cooldown,omitempty"`
+	}
+	BucketConfig struct {
+		RequestsPerMinute float64 `yaml:"requests_per_minute"`
+		Burst             int     `yaml:"burst,omitempty"`
+	}
 	RestConfig struct {
-		Port       int      `yaml:"port,omitempty"`
-		AuthTokens []string `yaml:"auth_tokens,omitempty"`
+		Port       int              `yaml:"port,omitempty"`
+		AuthTokens []AuthToken      `yaml:"auth_tokens,omitempty"`
+		JWT        *JWTConfig       `yaml:"jwt,omitempty"`
+		TLS        *TLSConfig       `yaml:"tls,omitempty"`
+		RateLimit  *RateLimitConfig `yaml:"rate_limit,omitempty"`
+		// ShutdownTimeout bounds how long in-flight requests are waited for on shutdown.
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout,omitempty"`
+	}
+	// AuditConfig enables the audit log, written as JSON lines and rotated by size.
+	AuditConfig struct {
+		File       string `yaml:"file"`
+		MaxSizeMB  int    `yaml:"max_size_mb,omitempty"`
+		MaxBackups int    `yaml:"max_backups,omitempty"`
+	}
+	// DesksConfig holds the settings of the managed desks. IdleTimeout, StandThreshold and Presets apply to every
+	// desk without its own. Groups are desks moved together.
+	DesksConfig struct {
+		IdleTimeout    time.Duration  `yaml:"idle_timeout,omitempty"`
+		StandThreshold int            `yaml:"stand_threshold,omitempty"`
+		Presets        map[string]int `yaml:"presets,omitempty"`
+		Devices        []DeskConfig   `yaml:"devices,omitempty"`
+		Groups         []GroupConfig  `yaml:"groups,omitempty"`
+	}
+	// DeskConfig holds the settings of a single desk, identified by the id used in the API. A zero IdleTimeout keeps
+	// the desk connected. Heights at or over StandThreshold count as standing. Adapter is the bluetooth adapter used
+	// to connect to the desk, picked from discovery or the default one when empty.
+	DeskConfig struct {
+		ID             string         `yaml:"id"`
+		Name           string         `yaml:"name,omitempty"`
+		IdleTimeout    *time.Duration `yaml:"idle_timeout,omitempty"`
+		StandThreshold int            `yaml:"stand_threshold,omitempty"`
+		SittingGoal    time.Duration  `yaml:"sitting_goal,omitempty"`
+		Presets        map[string]int `yaml:"presets,omitempty"`
+		Adapter        string         `yaml:"adapter,omitempty"`
+	}
+	// GroupConfig names desks that move together, such as the desks of a meeting room. With AbortOnFailure, every desk
+	// is stopped as soon as one fails or stalls, that is, its height does not change for StallTimeout while moving.
+	GroupConfig struct {
+		Name           string        `yaml:"name"`
+		Desks          []string      `yaml:"desks"`
+		AbortOnFailure bool          `yaml:"abort_on_failure,omitempty"`
+		StallTimeout   time.Duration `yaml:"stall_timeout,omitempty"`
+	}
+	// HistoryConfig enables recording the settled heights of the desks in a local database. A height counts towards
+	// the statistics for at most MaxHold when no other follows it, so nights and weekends away from the desk do not
+	// count as sitting.
+	HistoryConfig struct {
+		File        string        `yaml:"file"`
+		Retention   time.Duration `yaml:"retention,omitempty"`
+		SettleDelay time.Duration `yaml:"settle_delay,omitempty"`
+		MaxHold     time.Duration `yaml:"max_hold,omitempty"`
+	}
+	// RemindersConfig enables reminders to stand up when a desk stays in sitting position for longer than
+	// SittingGoal. With AutoStand, the desk moves to its stand preset when a reminder is not acted on within
+	// GracePeriod. Reminders are delivered to every configured sink.
+	RemindersConfig struct {
+		SittingGoal time.Duration          `yaml:"sitting_goal,omitempty"`
+		AutoStand   bool                   `yaml:"auto_stand,omitempty"`
+		GracePeriod time.Duration          `yaml:"grace_period,omitempty"`
+		Webhook     *ReminderWebhookConfig `yaml:"webhook,omitempty"`
+		MQTT        *MQTTConfig            `yaml:"mqtt,omitempty"`
+		SSE         bool                   `yaml:"sse,omitempty"`
+	}
+	ReminderWebhookConfig struct {
+		URL     string            `yaml:"url"`
+		Headers map[string]string `yaml:"headers,omitempty"`
+		Timeout time.Duration     `yaml:"timeout,omitempty"`
+	}
+	// MQTTConfig publishes events to Topic followed by the desk id, e.g. go-idasen-desk/reminders/<id>.
+	MQTTConfig struct {
+		Broker   string `yaml:"broker"`
+		Topic    string `yaml:"topic,omitempty"`
+		ClientID string `yaml:"client_id,omitempty"`
+		Username string `yaml:"username,omitempty"`
+		Password string `yaml:"password,omitempty"`
+	}
+	// SchedulerConfig enables moving desks on cron schedules. Schedules created through the API, and the results of
+	// the last runs, are kept in File so they survive restarts. Desks whose height changed within ActiveWindow are
+	// considered in use and skipped.
+	SchedulerConfig struct {
+		File         string           `yaml:"file"`
+		Timezone     string           `yaml:"timezone,omitempty"`
+		ActiveWindow time.Duration    `yaml:"active_window,omitempty"`
+		Schedules    []ScheduleConfig `yaml:"schedules,omitempty"`
+	}
+	// ScheduleConfig moves Desks, or every configured desk when empty, to Height or to the named Preset. Cron is a
+	// standard five field expression or a descriptor such as @daily, evaluated in Timezone.
+	ScheduleConfig struct {
+		ID       string   `yaml:"id"`
+		Name     string   `yaml:"name,omitempty"`
+		Cron     string   `yaml:"cron"`
+		Timezone string   `yaml:"timezone,omitempty"`
+		Desks    []string `yaml:"desks,omitempty"`
+		Height   int      `yaml:"height,omitempty"`
+		Preset   string   `yaml:"preset,omitempty"`
+		Disabled bool     `yaml:"disabled,omitempty"`
+	}
+	// WebhooksConfig sends desk events to HTTP endpoints. The last DeliveryLogSize deliveries are kept in memory.
+	WebhooksConfig struct {
+		DeliveryLogSize int                     `yaml:"delivery_log_size,omitempty"`
+		Endpoints       []WebhookEndpointConfig `yaml:"endpoints"`
+	}
+	// WebhookEndpointConfig receives Events, or every event when empty, of Desks, or of every desk when empty. With a
+	// Secret, payloads are signed with HMAC-SHA256. Failed deliveries are retried up to MaxAttempts times, doubling
+	// RetryBackoff after each attempt.
+	WebhookEndpointConfig struct {
+		ID           string            `yaml:"id,omitempty"`
+		URL          string            `yaml:"url"`
+		Secret       string            `yaml:"secret,omitempty"`
+		Events       []string          `yaml:"events,omitempty"`
+		Desks        []string          `yaml:"desks,omitempty"`
+		Headers      map[string]string `yaml:"headers,omitempty"`
+		Timeout      time.Duration     `yaml:"timeout,omitempty"`
+		MaxAttempts  int               `yaml:"max_attempts,omitempty"`
+		RetryBackoff time.Duration     `yaml:"retry_backoff,omitempty"`
+	}
+	// DiscoveryConfig enables scanning for desks in the background every Interval, for ScanDuration. Desks are found
+	// by advertised name matching NamePattern, by service, the Linak control service unless ServiceUUIDs is set, or
+	// by the company identifiers in ManufacturerIDs. Desks not seen for ExpireAfter are considered gone.
+	DiscoveryConfig struct {
+		Interval        time.Duration `yaml:"interval,omitempty"`
+		ScanDuration    time.Duration `yaml:"scan_duration,omitempty"`
+		ExpireAfter     time.Duration `yaml:"expire_after,omitempty"`
+		NamePattern     string        `yaml:"name_pattern,omitempty"`
+		ServiceUUIDs    []string      `yaml:"service_uuids,omitempty"`
+		ManufacturerIDs []uint16      `yaml:"manufacturer_ids,omitempty"`
+	}
+	// BluetoothConfig lists the adapters to use, such as hci0 and hci1 on Linux. The first one is the default. When
+	// empty, the adapter picked by the operating system is used. CacheCharacteristics skips the discovery of the
+	// characteristics of desks already connected to, which only works on Linux. WakeTimeout is how long a desk has to
+	// answer the wake-up sent on every connection before it is reported as unresponsive, 0 skips the wake-up.
+	BluetoothConfig struct {
+		Adapters             []string      `yaml:"adapters,omitempty"`
+		CacheCharacteristics bool          `yaml:"cache_characteristics,omitempty"`
+		WakeTimeout          time.Duration `yaml:"wake_timeout,omitempty"`
+	}
+	// RegistryConfig enables adopting desks through the API. Adopted desks are kept in File.
+	RegistryConfig struct {
+		File string `yaml:"file"`
+	}
+	// RecordingConfig records the GATT traffic of every desk connection to a file in Dir, to attach to bug reports.
+	RecordingConfig struct {
+		Dir string `yaml:"dir"`
+	}
+	// LeasesConfig enables leasing desks through the API, so only the lease holder moves them. Leases last
+	// DefaultDuration unless a duration up to MaxDuration is requested.
+	LeasesConfig struct {
+		DefaultDuration time.Duration `yaml:"default_duration,omitempty"`
+		MaxDuration     time.Duration `yaml:"max_duration,omitempty"`
 	}
 	Config struct {
-		Rest RestConfig `yaml:"rest"`
+		Rest      RestConfig       `yaml:"rest"`
+		Desks     DesksConfig      `yaml:"desks,omitempty"`
+		Audit     *AuditConfig     `yaml:"audit,omitempty"`
+		History   *HistoryConfig   `yaml:"history,omitempty"`
+		Reminders *RemindersConfig `yaml:"reminders,omitempty"`
+		Scheduler *SchedulerConfig `yaml:"scheduler,omitempty"`
+		Webhooks  *WebhooksConfig  `yaml:"webhooks,omitempty"`
+		Discovery *DiscoveryConfig `yaml:"discovery,omitempty"`
+		Registry  *RegistryConfig  `yaml:"registry,omitempty"`
+		Bluetooth BluetoothConfig  `yaml:"bluetooth,omitempty"`
+		Recording *RecordingConfig `yaml:"recording,omitempty"`
+		Leases    *LeasesConfig    `yaml:"leases,omitempty"`
 	}
 )
 
 const (
-	DefaultPort = 8080
+	DefaultPort                = 8080
+	DefaultShutdownTimeout     = 15 * time.Second
+	DefaultJWKSRefreshInterval = time.Hour
+	DefaultJWTLeeway           = 30 * time.Second
+	DefaultJWTSubjectClaim     = "sub"
+	DefaultJWTScopesClaim      = "scope"
+	DefaultJWTDesksClaim       = "desks"
+	DefaultTLSMinVersion       = "1.2"
+	DefaultTLSReloadInterval   = 30 * time.Second
+	DefaultAuditMaxSizeMB      = 10
+	DefaultAuditMaxBackups     = 5
+	DefaultHistoryRetention    = 90 * 24 * time.Hour
+	DefaultHistorySettleDelay  = 2 * time.Second
+	DefaultHistoryMaxHold      = 4 * time.Hour
+	DefaultStandThreshold      = 9500
+	DefaultSittingGoal         = 45 * time.Minute
+	DefaultReminderGracePeriod = 5 * time.Minute
+	DefaultWebhookTimeout      = 10 * time.Second
+	DefaultMQTTTopic           = "go-idasen-desk/reminders"
+	DefaultMQTTClientID        = "go-idasen-desk"
+	DefaultSchedulerTimezone   = "Local"
+	DefaultActiveWindow        = 10 * time.Minute
+	DefaultDeliveryLogSize     = 500
+	DefaultWebhookMaxAttempts  = 5
+	DefaultWebhookRetryBackoff = time.Second
+	DefaultDiscoveryInterval   = time.Minute
+	DefaultScanDuration        = 10 * time.Second
+	DefaultDiscoveryExpiry     = 5 * time.Minute
+	DefaultDeskNamePattern     = "^Desk"
+	DefaultWakeTimeout         = 3 * time.Second
+	DefaultLeaseDuration       = 15 * time.Minute
+	DefaultMaxLeaseDuration    = 8 * time.Hour
 )
 
 func Load(file string, logger *slog.Logger) (*Config, error) {
 	config := &Config{
 		Rest: RestConfig{
-			Port:       DefaultPort,
-			AuthTokens: []string{},
+			Port:            DefaultPort,
+			AuthTokens:      []AuthToken{},
+			ShutdownTimeout: DefaultShutdownTimeout,
+		},
+		Desks: DesksConfig{
+			StandThreshold: DefaultStandThreshold,
+		},
+		Bluetooth: BluetoothConfig{
+			WakeTimeout: DefaultWakeTimeout,
 		},
 	}
 
@@ -45,5 +295,300 @@ func Load(file string, logger *slog.Logger) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config file: %w", err)
 	}
 
+	if config.Rest.RateLimit != nil {
+		if err = config.Rest.RateLimit.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	config.Desks.setDefaults()
+
+	if config.Rest.JWT != nil {
+		config.Rest.JWT.setDefaults()
+	}
+
+	if config.Rest.TLS != nil {
+		if err = config.Rest.TLS.validate(); err != nil {
+			return nil, err
+		}
+
+		config.Rest.TLS.setDefaults()
+	}
+
+	if config.Audit != nil {
+		config.Audit.setDefaults()
+	}
+
+	if config.History != nil {
+		config.History.setDefaults()
+	}
+
+	if config.Reminders != nil {
+		config.Reminders.setDefaults()
+	}
+
+	if config.Scheduler != nil {
+		config.Scheduler.setDefaults()
+	}
+
+	if config.Webhooks != nil {
+		config.Webhooks.setDefaults()
+	}
+
+	if config.Discovery != nil {
+		config.Discovery.setDefaults()
+	}
+
+	if config.Leases != nil {
+		config.Leases.setDefaults()
+	}
+
 	return config, nil
 }
+
+func (t *AuthToken) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		if err := value.Decode(&t.Token); err != nil {
+			return fmt.Errorf("decoding auth token: %w", err)
+		}
+
+		return nil
+	}
+
+	type plain AuthToken
+
+	if err := value.Decode((*plain)(t)); err != nil {
+		return fmt.Errorf("decoding auth token: %w", err)
+	}
+
+	return nil
+}
+
+// IsActive reports whether the token is inside its validity window at the given time.
+func (t AuthToken) IsActive(now time.Time) bool {
+	if t.NotBefore != nil && now.Before(*t.NotBefore) {
+		return false
+	}
+
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return false
+	}
+
+	return true
+}
+
+// Device returns the settings of the desk with the given id.
+func (c DesksConfig) Device(id string) (DeskConfig, bool) {
+	for _, desk := range c.Devices {
+		if desk.ID == id {
+			return desk, true
+		}
+	}
+
+	return DeskConfig{}, false //nolint:exhaustruct // not found
+}
+
+// Group returns the group with the given name.
+func (c DesksConfig) Group(name string) (GroupConfig, bool) {
+	for _, group := range c.Groups {
+		if group.Name == name {
+			return group, true
+		}
+	}
+
+	return GroupConfig{}, false //nolint:exhaustruct // not found
+}
+
+// StandThresholdFor returns the height from which the desk with the given id counts as standing.
+func (c DesksConfig) StandThresholdFor(id string) int {
+	if desk, ok := c.Device(id); ok && desk.StandThreshold > 0 {
+		return desk.StandThreshold
+	}
+
+	return c.StandThreshold
+}
+
+// PresetFor returns the height of the named preset of the desk with the given id, looking at the desk presets first.
+func (c DesksConfig) PresetFor(id, name string) (int, bool) {
+	if desk, ok := c.Device(id); ok {
+		if height, found := desk.Presets[name]; found {
+			return height, true
+		}
+	}
+
+	height, found := c.Presets[name]
+
+	return height, found
+}
+
+// validate rejects buckets that would never refill, which would block moves for good once their burst is used.
+func (c *RateLimitConfig) validate() error {
+	if c.Token != nil && c.Token.RequestsPerMinute <= 0 {
+		return fmt.Errorf("%w: rate_limit.token.requests_per_minute must be positive", ErrInvalidConfig)
+	}
+
+	if c.Desk != nil && c.Desk.RequestsPerMinute <= 0 {
+		return fmt.Errorf("%w: rate_limit.desk.requests_per_minute must be positive", ErrInvalidConfig)
+	}
+
+	return nil
+}
+
+// validate rejects requiring client certificates without a CA to verify them, which would accept any client.
+func (c *TLSConfig) validate() error {
+	if c.RequireClientCert && c.ClientCAFile == "" {
+		return fmt.Errorf("%w: tls.require_client_cert needs tls.client_ca_file", ErrInvalidConfig)
+	}
+
+	return nil
+}
+
+func (c *DesksConfig) setDefaults() {
+	if c.StandThreshold == 0 {
+		c.StandThreshold = DefaultStandThreshold
+	}
+}
+
+func (c *JWTConfig) setDefaults() {
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = DefaultJWKSRefreshInterval
+	}
+
+	if c.Leeway == 0 {
+		c.Leeway = DefaultJWTLeeway
+	}
+
+	if c.SubjectClaim == "" {
+		c.SubjectClaim = DefaultJWTSubjectClaim
+	}
+
+	if c.ScopesClaim == "" {
+		c.ScopesClaim = DefaultJWTScopesClaim
+	}
+
+	if c.DesksClaim == "" {
+		c.DesksClaim = DefaultJWTDesksClaim
+	}
+}
+
+func (c *TLSConfig) setDefaults() {
+	if c.MinVersion == "" {
+		c.MinVersion = DefaultTLSMinVersion
+	}
+
+	if c.ReloadInterval == 0 {
+		c.ReloadInterval = DefaultTLSReloadInterval
+	}
+}
+
+func (c *AuditConfig) setDefaults() {
+	if c.MaxSizeMB == 0 {
+		c.MaxSizeMB = DefaultAuditMaxSizeMB
+	}
+
+	if c.MaxBackups == 0 {
+		c.MaxBackups = DefaultAuditMaxBackups
+	}
+}
+
+func (c *HistoryConfig) setDefaults() {
+	if c.Retention == 0 {
+		c.Retention = DefaultHistoryRetention
+	}
+
+	if c.SettleDelay == 0 {
+		c.SettleDelay = DefaultHistorySettleDelay
+	}
+
+	if c.MaxHold == 0 {
+		c.MaxHold = DefaultHistoryMaxHold
+	}
+}
+
+func (c *RemindersConfig) setDefaults() {
+	if c.SittingGoal == 0 {
+		c.SittingGoal = DefaultSittingGoal
+	}
+
+	if c.GracePeriod == 0 {
+		c.GracePeriod = DefaultReminderGracePeriod
+	}
+
+	if c.Webhook != nil && c.Webhook.Timeout == 0 {
+		c.Webhook.Timeout = DefaultWebhookTimeout
+	}
+
+	if c.MQTT != nil {
+		if c.MQTT.Topic == "" {
+			c.MQTT.Topic = DefaultMQTTTopic
+		}
+
+		if c.MQTT.ClientID == "" {
+			c.MQTT.ClientID = DefaultMQTTClientID
+		}
+	}
+}
+
+func (c *SchedulerConfig) setDefaults() {
+	if c.Timezone == "" {
+		c.Timezone = DefaultSchedulerTimezone
+	}
+
+	if c.ActiveWindow == 0 {
+		c.ActiveWindow = DefaultActiveWindow
+	}
+}
+
+func (c *WebhooksConfig) setDefaults() {
+	if c.DeliveryLogSize == 0 {
+		c.DeliveryLogSize = DefaultDeliveryLogSize
+	}
+
+	for i := range c.Endpoints {
+		endpoint := &c.Endpoints[i]
+
+		if endpoint.ID == "" {
+			endpoint.ID = endpoint.URL
+		}
+
+		if endpoint.Timeout == 0 {
+			endpoint.Timeout = DefaultWebhookTimeout
+		}
+
+		if endpoint.MaxAttempts == 0 {
+			endpoint.MaxAttempts = DefaultWebhookMaxAttempts
+		}
+
+		if endpoint.RetryBackoff == 0 {
+			endpoint.RetryBackoff = DefaultWebhookRetryBackoff
+		}
+	}
+}
+
+func (c *DiscoveryConfig) setDefaults() {
+	if c.Interval == 0 {
+		c.Interval = DefaultDiscoveryInterval
+	}
+
+	if c.ScanDuration == 0 {
+		c.ScanDuration = DefaultScanDuration
+	}
+
+	if c.ExpireAfter == 0 {
+		c.ExpireAfter = DefaultDiscoveryExpiry
+	}
+
+	if c.NamePattern == "" {
+		c.NamePattern = DefaultDeskNamePattern
+	}
+}
+
+func (c *LeasesConfig) setDefaults() {
+	if c.DefaultDuration == 0 {
+		c.DefaultDuration = DefaultLeaseDuration
+	}
+
+	if c.MaxDuration == 0 {
+		c.MaxDuration = DefaultMaxLeaseDuration
+	}
+}
@@ -3,6 +3,7 @@ package config_test
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/AlejandroHerr/go-common/pkg/logging"
 	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
@@ -22,7 +23,9 @@ func TestLoadConfig(t *testing.T) {
 		require.NoError(t, err, "should not error loading config")
 
 		require.Equal(t, config.DefaultPort, cfg.Rest.Port, "should use default port")
-		require.Equal(t, make([]string, 0), cfg.Rest.AuthTokens, "should be an empty array")
+		require.Equal(t, make([]config.AuthToken, 0), cfg.Rest.AuthTokens, "should be an empty array")
+		require.Equal(t, config.DefaultShutdownTimeout, cfg.Rest.ShutdownTimeout, "should use default shutdown timeout")
+		require.Equal(t, config.DefaultWakeTimeout, cfg.Bluetooth.WakeTimeout, "should use default wake timeout")
 	})
 	t.Run("uses default if file is empty", func(t *testing.T) {
 		t.Parallel()
@@ -31,7 +34,7 @@ func TestLoadConfig(t *testing.T) {
 		require.NoError(t, err, "should not error loading config")
 
 		require.Equal(t, config.DefaultPort, cfg.Rest.Port, "should use default port")
-		require.Equal(t, []string{}, cfg.Rest.AuthTokens, "should be an empty array")
+		require.Equal(t, []config.AuthToken{}, cfg.Rest.AuthTokens, "should be an empty array")
 	})
 	t.Run("loads config from file", func(t *testing.T) {
 		t.Parallel()
@@ -51,6 +54,156 @@ func TestLoadConfig(t *testing.T) {
 		require.NoError(t, err, "should not error loading config")
 
 		require.Equal(t, fileCfg["rest"]["port"], cfg.Rest.Port, "should use port from file")
-		require.Equal(t, []string{"aaaaa", "bbbbb"}, cfg.Rest.AuthTokens, "should use tokens from file")
+
+		expiresAt := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+		notBefore := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+		require.Equal(t, []config.AuthToken{
+			{Token: "aaaaa", Name: "", Scopes: nil, Desks: nil, ExpiresAt: nil, NotBefore: nil},
+			{Token: "bbbbb", Name: "", Scopes: nil, Desks: nil, ExpiresAt: nil, NotBefore: nil},
+			{Token: "ccccc", Name: "", Scopes: nil, Desks: nil, ExpiresAt: &expiresAt, NotBefore: &notBefore},
+		}, cfg.Rest.AuthTokens, "should use tokens from file")
+
+		require.Equal(t, &config.RateLimitConfig{
+			Token:        &config.BucketConfig{RequestsPerMinute: 30, Burst: 5},
+			Desk:         &config.BucketConfig{RequestsPerMinute: 6, Burst: 0},
+			MoveCooldown: 5 * time.Second,
+		}, cfg.Rest.RateLimit, "should use rate limits from file")
+
+		alwaysConnected := time.Duration(0)
+
+		require.Equal(t, config.DesksConfig{
+			IdleTimeout:    10 * time.Minute,
+			StandThreshold: config.DefaultStandThreshold,
+			Presets:        map[string]int{"stand": 11500},
+			Devices: []config.DeskConfig{
+				{
+					ID:             "6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10",
+					Name:           "office",
+					IdleTimeout:    &alwaysConnected,
+					StandThreshold: 10000,
+					SittingGoal:    30 * time.Minute,
+					Presets:        map[string]int{"stand": 11000},
+					Adapter:        "hci1",
+				},
+			},
+			Groups: []config.GroupConfig{
+				{
+					Name:           "meeting-room",
+					Desks:          []string{"6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10", "0b1c9f4e-7d2a-4f0e-8a3b-5c6d7e8f9a01"},
+					AbortOnFailure: true,
+					StallTimeout:   2 * time.Second,
+				},
+			},
+		}, cfg.Desks, "should use desks from file")
+		require.Equal(t, []string{"hci0", "hci1"}, cfg.Bluetooth.Adapters, "should use adapters from file")
+		require.True(t, cfg.Bluetooth.CacheCharacteristics, "should use characteristics cache from file")
+		require.Equal(t, 5*time.Second, cfg.Bluetooth.WakeTimeout, "should use wake timeout from file")
+		require.Equal(t, "/var/lib/idasen/recordings", cfg.Recording.Dir, "should use recording dir from file")
+		require.Equal(t, &config.LeasesConfig{
+			DefaultDuration: config.DefaultLeaseDuration,
+			MaxDuration:     4 * time.Hour,
+		}, cfg.Leases, "should use leases from file with defaults")
+		_, ok := cfg.Desks.Group("meeting-room")
+		require.True(t, ok, "should find groups by name")
+		require.Equal(t, 10000, cfg.Desks.StandThresholdFor("6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10"))
+		require.Equal(t, config.DefaultStandThreshold, cfg.Desks.StandThresholdFor("unknown"))
+
+		require.Equal(t, &config.HistoryConfig{
+			File:        "/var/lib/go-idasen-desk/history.db",
+			Retention:   30 * 24 * time.Hour,
+			SettleDelay: config.DefaultHistorySettleDelay,
+			MaxHold:     config.DefaultHistoryMaxHold,
+		}, cfg.History, "should use history from file with defaults")
+
+		stand, ok := cfg.Desks.PresetFor("6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10", "stand")
+		require.True(t, ok)
+		require.Equal(t, 11000, stand, "should prefer the desk preset")
+
+		stand, ok = cfg.Desks.PresetFor("unknown", "stand")
+		require.True(t, ok)
+		require.Equal(t, 11500, stand, "should fall back to the shared preset")
+
+		require.Equal(t, &config.RemindersConfig{
+			SittingGoal: config.DefaultSittingGoal,
+			AutoStand:   true,
+			GracePeriod: config.DefaultReminderGracePeriod,
+			Webhook:     nil,
+			MQTT: &config.MQTTConfig{
+				Broker:   "tcp://localhost:1883",
+				Topic:    config.DefaultMQTTTopic,
+				ClientID: config.DefaultMQTTClientID,
+				Username: "",
+				Password: "",
+			},
+			SSE: true,
+		}, cfg.Reminders, "should use reminders from file with defaults")
+
+		require.Equal(t, &config.SchedulerConfig{
+			File:         "/var/lib/go-idasen-desk/schedules.json",
+			Timezone:     config.DefaultSchedulerTimezone,
+			ActiveWindow: config.DefaultActiveWindow,
+			Schedules: []config.ScheduleConfig{{
+				ID:       "cleaning",
+				Name:     "",
+				Cron:     "0 19 * * *",
+				Timezone: "Europe/Madrid",
+				Desks:    nil,
+				Height:   0,
+				Preset:   "stand",
+				Disabled: false,
+			}},
+		}, cfg.Scheduler, "should use scheduler from file with defaults")
+
+		require.Equal(t, &config.WebhooksConfig{
+			DeliveryLogSize: config.DefaultDeliveryLogSize,
+			Endpoints: []config.WebhookEndpointConfig{{
+				ID:           "https://chat.example.com/hooks/desk",
+				URL:          "https://chat.example.com/hooks/desk",
+				Secret:       "s3cr3t",
+				Events:       []string{"target_reached", "position_changed"},
+				Desks:        nil,
+				Headers:      nil,
+				Timeout:      config.DefaultWebhookTimeout,
+				MaxAttempts:  config.DefaultWebhookMaxAttempts,
+				RetryBackoff: config.DefaultWebhookRetryBackoff,
+			}},
+		}, cfg.Webhooks, "should use webhooks from file with defaults")
+
+		require.Equal(t, &config.DiscoveryConfig{
+			Interval:        30 * time.Second,
+			ScanDuration:    config.DefaultScanDuration,
+			ExpireAfter:     config.DefaultDiscoveryExpiry,
+			NamePattern:     config.DefaultDeskNamePattern,
+			ServiceUUIDs:    nil,
+			ManufacturerIDs: []uint16{0x0590},
+		}, cfg.Discovery, "should use discovery from file with defaults")
+	})
+	t.Run("rejects rate limits that never refill", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := config.Load("./__mock__/invalid_rate_limit.yaml", logger)
+		require.ErrorIs(t, err, config.ErrInvalidConfig)
+		require.ErrorContains(t, err, "rate_limit.desk.requests_per_minute")
+	})
+	t.Run("rejects requiring client certificates without a client ca", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := config.Load("./__mock__/invalid_tls.yaml", logger)
+		require.ErrorIs(t, err, config.ErrInvalidConfig)
+		require.ErrorContains(t, err, "tls.client_ca_file")
+	})
+	t.Run("applies jwt defaults", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := config.Load("./__mock__/jwt.yaml", logger)
+		require.NoError(t, err, "should not error loading config")
+
+		require.NotNil(t, cfg.Rest.JWT, "should load jwt config")
+		require.Equal(t, "https://sso.example.com", cfg.Rest.JWT.Issuer)
+		require.Equal(t, config.DefaultJWKSRefreshInterval, cfg.Rest.JWT.RefreshInterval)
+		require.Equal(t, config.DefaultJWTLeeway, cfg.Rest.JWT.Leeway)
+		require.Equal(t, config.DefaultJWTScopesClaim, cfg.Rest.JWT.ScopesClaim)
+		require.Equal(t, []string{"admin"}, cfg.Rest.JWT.ScopeMapping["desk-admins"])
 	})
 }
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	newConfigFileMode = 0o600
+	yamlIndent        = 2
+)
+
+var ErrInvalidConfigFile = errors.New("invalid config file")
+
+// AddDevices adds the desks that are not configured yet to the desks section of the config file, creating the file
+// when it does not exist. Comments and the rest of the settings are kept. It returns the desks it added.
+func AddDevices(file string, desks []DeskConfig) ([]DeskConfig, error) {
+	var doc yaml.Node
+
+	mode := fs.FileMode(newConfigFileMode)
+
+	content, err := os.ReadFile(file)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("reading config file: %w", err)
+	default:
+		if err = yaml.Unmarshal(content, &doc); err != nil {
+			return nil, fmt.Errorf("parsing config file: %w", err)
+		}
+
+		if info, statErr := os.Stat(file); statErr == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+
+	if doc.Kind == 0 {
+		root := &yaml.Node{Kind: yaml.MappingNode}                            //nolint:exhaustruct // empty mapping
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}} //nolint:exhaustruct // new document
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%w: expected a mapping at the top level", ErrInvalidConfigFile)
+	}
+
+	desksNode, err := mappingValue(root, "desks", yaml.MappingNode)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := mappingValue(desksNode, "devices", yaml.SequenceNode)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []DeskConfig
+
+	for _, desk := range desks {
+		if hasDevice(devices, desk.ID) {
+			continue
+		}
+
+		var node yaml.Node
+		if err = node.Encode(desk); err != nil {
+			return nil, fmt.Errorf("encoding desk %s: %w", desk.ID, err)
+		}
+
+		devices.Content = append(devices.Content, &node)
+		added = append(added, desk)
+	}
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	if err = writeYAML(file, &doc, mode); err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// mappingValue returns the value of key in the mapping, adding an empty one of the given kind when missing.
+func mappingValue(mapping *yaml.Node, key string, kind yaml.Kind) (*yaml.Node, error) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+
+		value := mapping.Content[i+1]
+
+		// An empty key, as in "devices:", is a null scalar
+		if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+			*value = yaml.Node{Kind: kind} //nolint:exhaustruct // empty node
+		}
+
+		if value.Kind != kind {
+			return nil, fmt.Errorf("%w: unexpected type of %s", ErrInvalidConfigFile, key)
+		}
+
+		return value, nil
+	}
+
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: key} //nolint:exhaustruct // plain key
+	value := &yaml.Node{Kind: kind}                          //nolint:exhaustruct // empty node
+	mapping.Content = append(mapping.Content, keyNode, value)
+
+	return value, nil
+}
+
+func hasDevice(devices *yaml.Node, id string) bool {
+	for _, device := range devices.Content {
+		var desk DeskConfig
+		if err := device.Decode(&desk); err == nil && desk.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeYAML replaces the file atomically, so a failed write never leaves a truncated config behind.
+func writeYAML(file string, doc *yaml.Node, mode fs.FileMode) error {
+	var buf bytes.Buffer
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(yamlIndent)
+
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("encoding config file: %w", err)
+	}
+
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("encoding config file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary config file: %w", err)
+	}
+
+	defer os.Remove(tmp.Name()) //nolint:errcheck // already renamed on success
+
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close() //nolint:errcheck,gosec // write error is returned
+
+		return fmt.Errorf("writing config file: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("setting config file mode: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("replacing config file: %w", err)
+	}
+
+	return nil
+}
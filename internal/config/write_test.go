@@ -0,0 +1,83 @@
+package config_test
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newDesk(id, name string) config.DeskConfig {
+	return config.DeskConfig{
+		ID:             id,
+		Name:           name,
+		IdleTimeout:    nil,
+		StandThreshold: 0,
+		SittingGoal:    0,
+		Presets:        nil,
+		Adapter:        "",
+	}
+}
+
+func TestAddDevices(t *testing.T) {
+	t.Parallel()
+
+	office := newDesk("6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10", "office")
+	meeting := newDesk("0b9c7c1e-3c4f-4d8a-9a55-7a1f0e2d3c4b", "Desk 5678")
+
+	t.Run("keeps the existing settings", func(t *testing.T) {
+		t.Parallel()
+
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		content := "rest:\n  port: 3000 # behind the proxy\n" +
+			"desks:\n  devices:\n    - id: " + office.ID + "\n      name: office\n"
+		require.NoError(t, os.WriteFile(file, []byte(content), 0o640))
+
+		added, err := config.AddDevices(file, []config.DeskConfig{office, meeting})
+		require.NoError(t, err)
+		require.Equal(t, []config.DeskConfig{meeting}, added, "should skip configured desks")
+
+		written, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.Contains(t, string(written), "# behind the proxy")
+
+		info, err := os.Stat(file)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+		cfg, err := config.Load(file, slog.New(slog.DiscardHandler))
+		require.NoError(t, err)
+		require.Equal(t, 3000, cfg.Rest.Port)
+		require.Equal(t, []config.DeskConfig{office, meeting}, cfg.Desks.Devices)
+
+		added, err = config.AddDevices(file, []config.DeskConfig{meeting})
+		require.NoError(t, err)
+		require.Empty(t, added, "should not add desks twice")
+	})
+
+	t.Run("creates the file", func(t *testing.T) {
+		t.Parallel()
+
+		file := filepath.Join(t.TempDir(), "config.yaml")
+
+		_, err := config.AddDevices(file, []config.DeskConfig{office})
+		require.NoError(t, err)
+
+		cfg, err := config.Load(file, slog.New(slog.DiscardHandler))
+		require.NoError(t, err)
+		require.Equal(t, []config.DeskConfig{office}, cfg.Desks.Devices)
+	})
+
+	t.Run("rejects unexpected files", func(t *testing.T) {
+		t.Parallel()
+
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(file, []byte("desks:\n  devices: office\n"), 0o600))
+
+		_, err := config.AddDevices(file, []config.DeskConfig{office})
+		require.ErrorIs(t, err, config.ErrInvalidConfigFile)
+	})
+}
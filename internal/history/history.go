@@ -0,0 +1,316 @@
+package history
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	filePermissions = 0o600
+	openTimeout     = time.Second
+	pruneInterval   = time.Hour
+	keySize         = 8
+	valueSize       = 4
+)
+
+var ErrInvalidQuery = errors.New("invalid history query")
+
+type (
+	// Sample is a recorded height. Downsampled series average the samples of each window, reporting their range and
+	// count as well.
+	Sample struct {
+		Time   time.Time `json:"time"`
+		Height int       `json:"height"`
+		Min    int       `json:"min,omitempty"`
+		Max    int       `json:"max,omitempty"`
+		Count  int       `json:"count,omitempty"`
+	}
+	// Query selects the samples of a desk in [From, To). A zero Resolution returns the raw samples.
+	Query struct {
+		Desk       string
+		From       time.Time
+		To         time.Time
+		Resolution time.Duration
+	}
+	// Store keeps the height samples in a bbolt database, with a bucket per desk keyed by timestamp. A nil *Store
+	// records nothing and has no history, so callers do not need to check whether history is enabled.
+	Store struct {
+		db        *bolt.DB
+		retention time.Duration
+		maxHold   time.Duration
+		logger    *slog.Logger
+	}
+)
+
+func NewStore(cfg config.HistoryConfig, logger *slog.Logger) (*Store, error) {
+	db, err := bolt.Open(cfg.File, filePermissions, &bolt.Options{Timeout: openTimeout}) //nolint:exhaustruct // defaults
+	if err != nil {
+		return nil, fmt.Errorf("opening history database: %w", err)
+	}
+
+	return &Store{
+		db:        db,
+		retention: cfg.Retention,
+		maxHold:   cfg.MaxHold,
+		logger:    logger.With("component", "history"),
+	}, nil
+}
+
+// MaxHold returns how long a sample holds when no other follows it.
+func (s *Store) MaxHold() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return s.maxHold
+}
+
+func (s *Store) Record(desk string, at time.Time, height int) error {
+	if s == nil {
+		return nil
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(desk))
+		if err != nil {
+			return fmt.Errorf("creating desk bucket: %w", err)
+		}
+
+		value := make([]byte, valueSize)
+		binary.BigEndian.PutUint32(value, uint32(height)) //nolint:gosec // desk heights are small and positive
+
+		return bucket.Put(encodeTime(at), value)
+	})
+	if err != nil {
+		return fmt.Errorf("recording height: %w", err)
+	}
+
+	return nil
+}
+
+// Query returns the samples of a desk in chronological order.
+func (s *Store) Query(query Query) ([]Sample, error) {
+	samples := []Sample{}
+
+	if !query.To.After(query.From) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+
+	if query.Resolution < 0 {
+		return nil, fmt.Errorf("%w: negative resolution", ErrInvalidQuery)
+	}
+
+	if s == nil {
+		return samples, nil
+	}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(query.Desk))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		end := encodeTime(query.To)
+
+		for key, value := cursor.Seek(encodeTime(query.From)); key != nil; key, value = cursor.Next() {
+			if string(key) >= string(end) {
+				break
+			}
+
+			samples = append(samples, Sample{
+				Time:   decodeTime(key),
+				Height: int(binary.BigEndian.Uint32(value)),
+				Min:    0,
+				Max:    0,
+				Count:  0,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+
+	if query.Resolution == 0 {
+		return samples, nil
+	}
+
+	return downsample(samples, query.Resolution), nil
+}
+
+// Last returns the latest sample of a desk recorded before the given time, if any.
+func (s *Store) Last(desk string, before time.Time) (Sample, bool, error) {
+	var (
+		sample Sample
+		found  bool
+	)
+
+	if s == nil {
+		return sample, false, nil
+	}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(desk))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+
+		key, value := cursor.Seek(encodeTime(before))
+		if key == nil {
+			key, value = cursor.Last()
+		} else {
+			key, value = cursor.Prev()
+		}
+
+		if key == nil {
+			return nil
+		}
+
+		sample = Sample{
+			Time:   decodeTime(key),
+			Height: int(binary.BigEndian.Uint32(value)),
+			Min:    0,
+			Max:    0,
+			Count:  0,
+		}
+		found = true
+
+		return nil
+	})
+	if err != nil {
+		return sample, false, fmt.Errorf("reading history: %w", err)
+	}
+
+	return sample, found, nil
+}
+
+// Prune deletes the samples recorded before the given time.
+func (s *Store) Prune(before time.Time) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+
+	deleted := 0
+	end := encodeTime(before)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, bucket *bolt.Bucket) error {
+			// Deleting while iterating with a cursor can skip keys, so collect them first
+			var keys [][]byte
+
+			cursor := bucket.Cursor()
+			for key, _ := cursor.First(); key != nil && string(key) < string(end); key, _ = cursor.Next() {
+				keys = append(keys, append([]byte(nil), key...))
+			}
+
+			for _, key := range keys {
+				if err := bucket.Delete(key); err != nil {
+					return fmt.Errorf("deleting sample: %w", err)
+				}
+			}
+
+			deleted += len(keys)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("pruning history: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// Run prunes the samples older than the retention period until ctx is done.
+func (s *Store) Run(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := s.Prune(time.Now().Add(-s.retention))
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Error pruning history", slog.String("error", err.Error()))
+		} else if deleted > 0 {
+			s.logger.InfoContext(ctx, "Pruned history", slog.Int("deleted", deleted))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("closing history database: %w", err)
+	}
+
+	return nil
+}
+
+// downsample averages the samples in windows of the given resolution, aligned to the Unix epoch.
+func downsample(samples []Sample, resolution time.Duration) []Sample {
+	windows := []Sample{}
+
+	var sum int
+
+	for _, sample := range samples {
+		start := sample.Time.Truncate(resolution)
+
+		last := len(windows) - 1
+		if last < 0 || !windows[last].Time.Equal(start) {
+			windows = append(windows, Sample{
+				Time:   start,
+				Height: sample.Height,
+				Min:    sample.Height,
+				Max:    sample.Height,
+				Count:  0,
+			})
+			sum = 0
+			last++
+		}
+
+		window := &windows[last]
+		sum += sample.Height
+		window.Count++
+		window.Min = min(window.Min, sample.Height)
+		window.Max = max(window.Max, sample.Height)
+		window.Height = int(math.Round(float64(sum) / float64(window.Count)))
+	}
+
+	return windows
+}
+
+// encodeTime returns a key that sorts in chronological order.
+func encodeTime(t time.Time) []byte {
+	key := make([]byte, keySize)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano())) //nolint:gosec // timestamps after 1970
+
+	return key
+}
+
+func decodeTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key))).UTC() //nolint:gosec // written by encodeTime
+}
@@ -0,0 +1,146 @@
+package history_test
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/history"
+	"github.com/stretchr/testify/require"
+)
+
+const testDesk = "6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10"
+
+func newTestStore(t *testing.T) *history.Store {
+	t.Helper()
+
+	store, err := history.NewStore(config.HistoryConfig{
+		File:        filepath.Join(t.TempDir(), "history.db"),
+		Retention:   config.DefaultHistoryRetention,
+		SettleDelay: config.DefaultHistorySettleDelay,
+		MaxHold:     config.DefaultHistoryMaxHold,
+	}, slog.New(slog.DiscardHandler))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, store.Close())
+	})
+
+	return store
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	store := newTestStore(t)
+
+	for i, height := range []int{7000, 7200, 11000, 11400, 7100} {
+		require.NoError(t, store.Record(testDesk, start.Add(time.Duration(i)*10*time.Minute), height))
+	}
+
+	require.NoError(t, store.Record("other", start, 9000))
+
+	t.Run("returns raw samples in range", func(t *testing.T) {
+		t.Parallel()
+
+		samples, err := store.Query(history.Query{
+			Desk:       testDesk,
+			From:       start.Add(10 * time.Minute),
+			To:         start.Add(40 * time.Minute),
+			Resolution: 0,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []history.Sample{
+			{Time: start.Add(10 * time.Minute), Height: 7200, Min: 0, Max: 0, Count: 0},
+			{Time: start.Add(20 * time.Minute), Height: 11000, Min: 0, Max: 0, Count: 0},
+			{Time: start.Add(30 * time.Minute), Height: 11400, Min: 0, Max: 0, Count: 0},
+		}, samples)
+	})
+
+	t.Run("downsamples to the resolution", func(t *testing.T) {
+		t.Parallel()
+
+		samples, err := store.Query(history.Query{
+			Desk:       testDesk,
+			From:       start,
+			To:         start.Add(time.Hour),
+			Resolution: 20 * time.Minute,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []history.Sample{
+			{Time: start, Height: 7100, Min: 7000, Max: 7200, Count: 2},
+			{Time: start.Add(20 * time.Minute), Height: 11200, Min: 11000, Max: 11400, Count: 2},
+			{Time: start.Add(40 * time.Minute), Height: 7100, Min: 7100, Max: 7100, Count: 1},
+		}, samples)
+	})
+
+	t.Run("rejects an empty range", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := store.Query(history.Query{Desk: testDesk, From: start, To: start, Resolution: 0})
+		require.Error(t, err)
+	})
+}
+
+func TestStorePrune(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	store := newTestStore(t)
+
+	for i := range 5 {
+		require.NoError(t, store.Record(testDesk, start.Add(time.Duration(i)*time.Hour), 7000+i))
+	}
+
+	deleted, err := store.Prune(start.Add(3 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 3, deleted)
+
+	samples, err := store.Query(history.Query{Desk: testDesk, From: start, To: start.Add(24 * time.Hour), Resolution: 0})
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	require.Equal(t, 7003, samples[0].Height)
+}
+
+func TestRecorderRecordsSettledHeights(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore(t)
+	recorder := history.NewRecorder(store, 20*time.Millisecond, slog.New(slog.DiscardHandler))
+
+	from := time.Now().Add(-time.Minute)
+
+	// A move reports many heights, only the last one is recorded
+	for height := 7000; height <= 8000; height += 100 {
+		recorder.Observe(testDesk, height)
+	}
+
+	query := history.Query{Desk: testDesk, From: from, To: time.Now().Add(time.Minute), Resolution: 0}
+
+	require.Eventually(t, func() bool {
+		samples, err := store.Query(query)
+
+		return err == nil && len(samples) == 1 && samples[0].Height == 8000
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// Settling again at the same height is not recorded
+	recorder.Observe(testDesk, 8000)
+
+	// Pending heights are recorded on close
+	recorder.Observe("other", 9000)
+	recorder.Close()
+
+	samples, err := store.Query(query)
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+
+	samples, err = store.Query(history.Query{Desk: "other", From: from, To: time.Now().Add(time.Minute), Resolution: 0})
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	require.Equal(t, 9000, samples[0].Height)
+}
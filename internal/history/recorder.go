@@ -0,0 +1,96 @@
+package history
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type (
+	// Recorder debounces the height updates of the desks and records the height each desk settles at, skipping it
+	// when it did not change since the last record.
+	Recorder struct {
+		store       *Store
+		settleDelay time.Duration
+		logger      *slog.Logger
+		mutex       sync.Mutex
+		desks       map[string]*deskHeight
+	}
+	deskHeight struct {
+		height   int
+		at       time.Time
+		timer    *time.Timer
+		recorded int
+	}
+)
+
+func NewRecorder(store *Store, settleDelay time.Duration, logger *slog.Logger) *Recorder {
+	return &Recorder{
+		store:       store,
+		settleDelay: settleDelay,
+		logger:      logger.With("component", "history-recorder"),
+		mutex:       sync.Mutex{},
+		desks:       map[string]*deskHeight{},
+	}
+}
+
+// Observe takes a height update. It does not block, so it can be called from the desk notification loop.
+func (r *Recorder) Observe(desk string, height int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	state, ok := r.desks[desk]
+	if !ok {
+		state = &deskHeight{height: 0, at: time.Time{}, timer: nil, recorded: 0}
+		r.desks[desk] = state
+	}
+
+	state.height = height
+	state.at = time.Now()
+
+	if state.timer == nil {
+		state.timer = time.AfterFunc(r.settleDelay, func() {
+			r.settle(desk)
+		})
+
+		return
+	}
+
+	state.timer.Reset(r.settleDelay)
+}
+
+// Close records the heights still settling.
+func (r *Recorder) Close() {
+	r.mutex.Lock()
+	desks := make([]string, 0, len(r.desks))
+
+	for desk, state := range r.desks {
+		if state.timer != nil && state.timer.Stop() {
+			desks = append(desks, desk)
+		}
+	}
+	r.mutex.Unlock()
+
+	for _, desk := range desks {
+		r.settle(desk)
+	}
+}
+
+func (r *Recorder) settle(desk string) {
+	r.mutex.Lock()
+
+	state := r.desks[desk]
+	if state.height == state.recorded {
+		r.mutex.Unlock()
+
+		return
+	}
+
+	height, at := state.height, state.at
+	state.recorded = height
+	r.mutex.Unlock()
+
+	if err := r.store.Record(desk, at, height); err != nil {
+		r.logger.Error("Error recording height", slog.String("desk", desk), slog.String("error", err.Error()))
+	}
+}
@@ -6,12 +6,18 @@ import (
 	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const (
+	// LinakHeightCharUUID is the characteristic desks report their height and speed with, and LinakControlCharUUID
+	// the one they take move commands on.
+	LinakHeightCharUUID  = "99fa0021338a10248a49009c0215f78a"
+	LinakControlCharUUID = "99fa0002338a10248a49009c0215f78a"
+
 	defaultMargin       = 10
 	defaultTimeout      = 30 * time.Second
 	defaultPollInterval = 100 * time.Millisecond
@@ -45,33 +51,51 @@ type (
 		options        *DeskServiceOptions
 		isRunning      bool
 		isRunningMutex sync.RWMutex
+		done           chan struct{} // closed when the run loop exits
+		moving         atomic.Int32  // number of moveTo commands driving the desk
 		height         int
 		readMutex      sync.RWMutex
 		moveToCmdCh    chan MoveToCmd
-		subscribers    []Subscription
+		stopCmdCh      chan StopCmd
+		subscribers    map[string]*Subscription
+		subscribersMu  sync.RWMutex
 	}
 	DeskServiceOptions struct {
-		margin       int
-		timeout      time.Duration
-		pollInterval time.Duration
+		margin         int
+		timeout        time.Duration
+		pollInterval   time.Duration
+		observers      []HeightObserver
+		eventObservers []EventObserver
 	}
 	MoveToCmd struct {
 		TargetHeight int
 		Ctx          context.Context
 		ResultCh     chan<- error
 	}
-	DeskServiceOption func(*DeskServiceOptions)
-	Subscription      struct {
-		id string
-		ch chan<- int
+	StopCmd struct {
+		ResultCh chan<- error
 	}
+	DeskServiceOption func(*DeskServiceOptions)
+	// HeightObserver is called from the desk service loop with every height reading, so it must not block.
+	HeightObserver func(uuid string, height int)
 )
 
+// ValidateHeight returns ErrInvalidHeight when height is out of the range the desks can move to.
+func ValidateHeight(height int) error {
+	if height < minDeskHeight || height > maxDeskHeight {
+		return ErrInvalidHeight
+	}
+
+	return nil
+}
+
 func NewDeskService(uuid string, client BTDesk, logger *slog.Logger, opts ...DeskServiceOption) *DeskService {
 	options := &DeskServiceOptions{
-		margin:       defaultMargin,
-		timeout:      defaultTimeout,
-		pollInterval: defaultPollInterval,
+		margin:         defaultMargin,
+		timeout:        defaultTimeout,
+		pollInterval:   defaultPollInterval,
+		observers:      nil,
+		eventObservers: nil,
 	}
 
 	for _, opt := range opts {
@@ -84,9 +108,13 @@ func NewDeskService(uuid string, client BTDesk, logger *slog.Logger, opts ...Des
 		readMutex:      sync.RWMutex{},
 		options:        options,
 		moveToCmdCh:    make(chan MoveToCmd),
+		stopCmdCh:      make(chan StopCmd),
 		isRunning:      false,
 		isRunningMutex: sync.RWMutex{},
-		subscribers:    []Subscription{},
+		done:           nil,
+		moving:         atomic.Int32{},
+		subscribers:    map[string]*Subscription{},
+		subscribersMu:  sync.RWMutex{},
 		client:         client,
 		logger: logger.With(
 			slog.String("component", "idasen-desk-service"),
@@ -125,44 +153,100 @@ func (s *DeskService) ReadHeight() (int, error) {
 	return s.readHeight(), nil
 }
 
+// MoveTo sends a moveTo command to the run loop. The result is always sent on resultCh, also when ctx is done or
+// the service stops before the command is accepted.
 func (s *DeskService) MoveTo(ctx context.Context, resultCh chan error, targetHeight int) {
-	if !s.readIsRunning() {
+	done, isRunning := s.runDone()
+	if !isRunning {
 		resultCh <- ErrNotRunning
 
 		return
 	}
 
-	if targetHeight < minDeskHeight || targetHeight > maxDeskHeight {
-		resultCh <- ErrInvalidHeight
+	if err := ValidateHeight(targetHeight); err != nil {
+		resultCh <- err
 
 		return
 	}
 
-	s.moveToCmdCh <- MoveToCmd{
+	select {
+	case s.moveToCmdCh <- MoveToCmd{
 		TargetHeight: targetHeight,
 		ResultCh:     resultCh,
 		Ctx:          ctx,
+	}:
+	case <-ctx.Done():
+		resultCh <- ErrCancelled
+	case <-done:
+		resultCh <- ErrNotRunning
 	}
 }
 
-func (s *DeskService) Subscribe(ch chan<- int) uuid.UUID {
+// Stop cancels any ongoing moveTo command and stops the desk.
+func (s *DeskService) Stop(ctx context.Context, resultCh chan error) {
+	done, isRunning := s.runDone()
+	if !isRunning {
+		resultCh <- ErrNotRunning
+
+		return
+	}
+
+	select {
+	case s.stopCmdCh <- StopCmd{
+		ResultCh: resultCh,
+	}:
+	case <-ctx.Done():
+		resultCh <- ErrCancelled
+	case <-done:
+		resultCh <- ErrNotRunning
+	}
+}
+
+// Subscribe registers ch to receive height updates. Updates are buffered per subscriber according to opts. The
+// service owns ch from now on and closes it when the subscription ends, so callers must not close it.
+func (s *DeskService) Subscribe(ch chan<- int, opts ...SubscriptionOption) uuid.UUID {
 	id := uuid.New()
 
-	s.subscribers = append(s.subscribers, Subscription{
-		id: id.String(),
-		ch: ch,
-	})
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
+	s.subscribers[id.String()] = newSubscription(id.String(), ch, opts...)
 
 	return id
 }
 
 func (s *DeskService) Unsubscribe(id uuid.UUID) {
-	for i, sub := range s.subscribers {
-		if sub.id == id.String() {
-			s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
-			break
-		}
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
+	if sub, ok := s.subscribers[id.String()]; ok {
+		sub.close()
+		delete(s.subscribers, id.String())
+	}
+}
+
+func (s *DeskService) SubscriptionStats() []SubscriptionStats {
+	s.subscribersMu.RLock()
+	defer s.subscribersMu.RUnlock()
+
+	stats := make([]SubscriptionStats, 0, len(s.subscribers))
+	for _, sub := range s.subscribers {
+		stats = append(stats, sub.Stats())
 	}
+
+	return stats
+}
+
+// IsMoving reports whether a moveTo command is driving the desk.
+func (s *DeskService) IsMoving() bool {
+	return s.moving.Load() > 0
+}
+
+func (s *DeskService) subscriberCount() int {
+	s.subscribersMu.RLock()
+	defer s.subscribersMu.RUnlock()
+
+	return len(s.subscribers)
 }
 
 func (s *DeskService) Close() error {
@@ -193,9 +277,10 @@ func (s *DeskService) run(ctx context.Context, errCh chan<- error) {
 	}
 
 	s.updateHeight(height)
+	s.observe(height)
 
+	// updateCh is not closed, the BLE stack may still deliver a notification after unsubscribing
 	updateCh := make(chan int)
-	defer close(updateCh)
 
 	err = s.client.Subscribe(updateCh)
 	if err != nil {
@@ -215,10 +300,7 @@ func (s *DeskService) run(ctx context.Context, errCh chan<- error) {
 
 	errCh <- nil
 
-	var (
-		moveToCtx    context.Context
-		moveToCancel context.CancelFunc
-	)
+	var moveToCancel context.CancelFunc
 
 	defer func() {
 		if moveToCancel != nil {
@@ -236,10 +318,8 @@ func (s *DeskService) run(ctx context.Context, errCh chan<- error) {
 			)
 
 			s.updateHeight(updatedHeight)
-
-			for _, sub := range s.subscribers {
-				sub.ch <- updatedHeight
-			}
+			s.observe(updatedHeight)
+			s.publish(ctx, updatedHeight)
 
 		case moveToCmd := <-s.moveToCmdCh:
 			s.logger.DebugContext(
@@ -253,18 +333,83 @@ func (s *DeskService) run(ctx context.Context, errCh chan<- error) {
 				moveToCancel()
 			}
 
-			moveToCtx, moveToCancel = context.WithTimeout( //nolint:fatcontext // sda
-				moveToCmd.Ctx,
-				s.options.timeout,
-			)
+			moveToCtx, cancel := context.WithTimeout(moveToCmd.Ctx, s.options.timeout)
+			moveToCancel = cancel
 
 			go s.handleMoveTo(moveToCtx, moveToCmd.TargetHeight, moveToCmd.ResultCh)
+		case stopCmd := <-s.stopCmdCh:
+			s.logger.DebugContext(ctx, "Received stop command")
+
+			if moveToCancel != nil {
+				moveToCancel()
+				moveToCancel = nil
+			}
+
+			if err = s.client.Stop(); err != nil {
+				stopCmd.ResultCh <- fmt.Errorf("stopping desk: %w", err)
+			} else {
+				stopCmd.ResultCh <- nil
+			}
 		case <-ctx.Done():
+			s.closeSubscribers()
 			s.logger.InfoContext(ctx, "Desk service stopped")
+
+			return
 		}
 	}
 }
 
+// publish hands the update to every subscriber without blocking, disconnecting those that overflow.
+func (s *DeskService) publish(ctx context.Context, height int) {
+	var overflowed []*Subscription
+
+	s.subscribersMu.RLock()
+
+	for _, sub := range s.subscribers {
+		if !sub.push(height) {
+			overflowed = append(overflowed, sub)
+		}
+	}
+
+	s.subscribersMu.RUnlock()
+
+	for _, sub := range overflowed {
+		stats := sub.Stats()
+
+		s.logger.WarnContext(
+			ctx,
+			"Disconnecting slow subscriber",
+			slog.String("subscriptionID", stats.ID),
+			slog.Int("pending", stats.Pending),
+			slog.Uint64("delivered", stats.Delivered),
+			slog.Duration("lastLag", stats.LastLag),
+			slog.Duration("maxLag", stats.MaxLag),
+		)
+
+		s.Unsubscribe(uuid.MustParse(stats.ID))
+	}
+}
+
+func (s *DeskService) observe(height int) {
+	for _, observer := range s.options.observers {
+		observer(s.uuid, height)
+	}
+}
+
+func (s *DeskService) emit(eventType EventType, height, targetHeight int, err error) {
+	emit(s.options.eventObservers, newEvent(eventType, s.uuid, height, targetHeight, err))
+}
+
+func (s *DeskService) closeSubscribers() {
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
+	for id, sub := range s.subscribers {
+		sub.close()
+		delete(s.subscribers, id)
+	}
+}
+
 func (s *DeskService) handleMoveTo(ctx context.Context, targetHeight int, resultCh chan<- error) {
 	currentHeight := s.readHeight()
 
@@ -288,7 +433,13 @@ func (s *DeskService) handleMoveTo(ctx context.Context, targetHeight int, result
 		slog.Int("to", targetHeight),
 	)
 
+	s.moving.Add(1)
+	defer s.moving.Add(-1)
+
+	s.emit(EventMoveStarted, currentHeight, targetHeight, nil)
+
 	if err := s.moveToTarget(currentHeight, targetHeight); err != nil {
+		s.emit(EventMoveFailed, currentHeight, targetHeight, err)
 		resultCh <- fmt.Errorf("moving desk to: %w", err)
 
 		return
@@ -316,12 +467,14 @@ func (s *DeskService) handleMoveTo(ctx context.Context, targetHeight int, result
 					slog.Int("targetHeight", targetHeight),
 				)
 
+				s.emit(EventTargetReached, currentHeight, targetHeight, nil)
 				resultCh <- nil
 
 				return
 			}
 
 			if err := s.moveToTarget(currentHeight, targetHeight); err != nil {
+				s.emit(EventMoveFailed, currentHeight, targetHeight, err)
 				resultCh <- fmt.Errorf("moving desk to target: %w", err)
 
 				return
@@ -332,12 +485,15 @@ func (s *DeskService) handleMoveTo(ctx context.Context, targetHeight int, result
 				switch {
 				case errors.Is(err, context.Canceled):
 					s.logger.DebugContext(ctx, "MoveTo command cancelled")
+					s.emit(EventMoveCancelled, s.readHeight(), targetHeight, ErrCancelled)
 					resultCh <- ErrCancelled
 				case errors.Is(err, context.DeadlineExceeded):
 					s.logger.DebugContext(ctx, "MoveTo command timed out")
+					s.emit(EventMoveTimedOut, s.readHeight(), targetHeight, ErrTimeout)
 					resultCh <- ErrTimeout
 				default:
 					s.logger.ErrorContext(ctx, "MoveTo command error", slog.String("error", err.Error()))
+					s.emit(EventMoveFailed, s.readHeight(), targetHeight, err)
 					resultCh <- fmt.Errorf("moveTo command error: %w", err)
 				}
 			} else {
@@ -384,9 +540,59 @@ func (s *DeskService) readIsRunning() bool {
 	return s.isRunning
 }
 
+// runDone returns the channel closed when the current run loop exits.
+func (s *DeskService) runDone() (<-chan struct{}, bool) {
+	s.isRunningMutex.RLock()
+	defer s.isRunningMutex.RUnlock()
+
+	return s.done, s.isRunning
+}
+
 func (s *DeskService) updateIsRunning(isRunning bool) {
 	s.isRunningMutex.Lock()
 	defer s.isRunningMutex.Unlock()
 
+	switch {
+	case isRunning && !s.isRunning:
+		s.done = make(chan struct{})
+	case !isRunning && s.isRunning:
+		close(s.done)
+	}
+
 	s.isRunning = isRunning
 }
+
+// DeskServiceOptionsWithMargin sets how far from the target height, in tenths of a millimetre, a move is done.
+func DeskServiceOptionsWithMargin(margin int) DeskServiceOption {
+	return func(o *DeskServiceOptions) {
+		o.margin = margin
+	}
+}
+
+// DeskServiceOptionsWithTimeout sets the maximum duration of a move.
+func DeskServiceOptionsWithTimeout(timeout time.Duration) DeskServiceOption {
+	return func(o *DeskServiceOptions) {
+		o.timeout = timeout
+	}
+}
+
+// DeskServiceOptionsWithPollInterval sets how often the height is checked while moving.
+func DeskServiceOptionsWithPollInterval(interval time.Duration) DeskServiceOption {
+	return func(o *DeskServiceOptions) {
+		o.pollInterval = interval
+	}
+}
+
+// DeskServiceOptionsWithHeightObserver adds a function called with every height reading of the desk.
+func DeskServiceOptionsWithHeightObserver(observer HeightObserver) DeskServiceOption {
+	return func(o *DeskServiceOptions) {
+		o.observers = append(o.observers, observer)
+	}
+}
+
+// DeskServiceOptionsWithEventObserver adds a function called with the move events of the desk.
+func DeskServiceOptionsWithEventObserver(observer EventObserver) DeskServiceOption {
+	return func(o *DeskServiceOptions) {
+		o.eventObservers = append(o.eventObservers, observer)
+	}
+}
@@ -0,0 +1,306 @@
+package idasen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidAddress is returned for desk addresses no bluetooth stack produces.
+var ErrInvalidAddress = errors.New("invalid desk address")
+
+const (
+	discoveryDefaultInterval    = time.Minute
+	discoveryDefaultExpireAfter = 5 * time.Minute
+	macAddressLength            = 6
+)
+
+type (
+	// DiscoveredDesk is a desk found by the discovery, as seen in its last advertisement.
+	DiscoveredDesk struct {
+		Addr           string    `json:"address"`
+		Name           string    `json:"name"`
+		RSSI           int       `json:"rssi"`
+		Connectable    bool      `json:"connectable"`
+		ServiceUUIDs   []string  `json:"service_uuids,omitempty"`
+		ManufacturerID *uint16   `json:"manufacturer_id,omitempty"`
+		Adapter        string    `json:"adapter,omitempty"`
+		FirstSeen      time.Time `json:"first_seen"`
+		LastSeen       time.Time `json:"last_seen"`
+	}
+	DiscoveryOptions struct {
+		interval    time.Duration
+		expireAfter time.Duration
+		connected   func(addr string) bool
+		observers   []EventObserver
+		now         func() time.Time
+	}
+	DiscoveryOption func(*DiscoveryOptions)
+	// Discovery scans for desks periodically, with a scanner per adapter, and keeps track of the ones in range. A desk
+	// that has not been seen for the expire duration is forgotten, unless it is connected, as desks stop advertising
+	// while connected.
+	Discovery struct {
+		scanners []*Scanner
+		options  *DiscoveryOptions
+		logger   *slog.Logger
+		mutex    sync.RWMutex
+		desks    map[string]*DiscoveredDesk
+		lastScan time.Time
+	}
+)
+
+// ValidateAddress checks that addr is a desk address as discovered by the bluetooth stacks: a UUID on macOS or a MAC
+// address on Linux.
+func ValidateAddress(addr string) error {
+	if _, err := uuid.Parse(addr); err == nil {
+		return nil
+	}
+
+	if mac, err := net.ParseMAC(addr); err == nil && len(mac) == macAddressLength {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q", ErrInvalidAddress, addr)
+}
+
+func NewDiscovery(scanners []*Scanner, logger *slog.Logger, opts ...DiscoveryOption) *Discovery {
+	options := &DiscoveryOptions{
+		interval:    discoveryDefaultInterval,
+		expireAfter: discoveryDefaultExpireAfter,
+		connected:   func(string) bool { return false },
+		observers:   nil,
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &Discovery{
+		scanners: scanners,
+		options:  options,
+		logger:   logger.With(slog.String("component", "idasen-discovery")),
+		mutex:    sync.RWMutex{},
+		desks:    map[string]*DiscoveredDesk{},
+		lastScan: time.Time{},
+	}
+}
+
+// Run scans right away and then every interval until ctx is done.
+func (d *Discovery) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.options.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Scan(ctx); err != nil {
+			d.logger.ErrorContext(ctx, "Error discovering desks", slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan runs a single scan with every scanner, updating the discovered desks and emitting EventAppeared and
+// EventDisappeared. A desk heard by several adapters is assigned to the one with the strongest signal. It only fails
+// when every scanner fails.
+func (d *Discovery) Scan(ctx context.Context) error {
+	advs, err := d.scanAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := d.options.now()
+
+	var events []Event
+
+	d.mutex.Lock()
+
+	for _, adv := range advs {
+		desk, ok := d.desks[adv.Addr]
+		if !ok {
+			desk = &DiscoveredDesk{FirstSeen: now} //nolint:exhaustruct // set below
+			d.desks[adv.Addr] = desk
+
+			events = append(events, discoveryEvent(EventAppeared, adv.Addr, now))
+		}
+
+		desk.update(adv, now)
+	}
+
+	for addr, desk := range d.desks {
+		if now.Sub(desk.LastSeen) < d.options.expireAfter || d.options.connected(addr) {
+			continue
+		}
+
+		delete(d.desks, addr)
+
+		events = append(events, discoveryEvent(EventDisappeared, addr, now))
+	}
+
+	d.lastScan = now
+
+	d.mutex.Unlock()
+
+	for _, event := range events {
+		d.logger.InfoContext(
+			ctx,
+			"Desk discovery",
+			slog.String("event", string(event.Type)),
+			slog.String("addr", event.Desk),
+		)
+
+		emit(d.options.observers, event)
+	}
+
+	return nil
+}
+
+// scanAll scans with every scanner at once and keeps the strongest advertisement of every desk.
+func (d *Discovery) scanAll(ctx context.Context) (map[string]Advertisement, error) {
+	results := make([][]Advertisement, len(d.scanners))
+	errs := make([]error, len(d.scanners))
+
+	var wg sync.WaitGroup
+
+	for i, scanner := range d.scanners {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i], errs[i] = scanner.ScanDesks(ctx)
+		}()
+	}
+
+	wg.Wait()
+
+	advs := map[string]Advertisement{}
+	failed := 0
+
+	for i, result := range results {
+		if errs[i] != nil {
+			failed++
+
+			d.logger.WarnContext(ctx, "Error scanning", slog.String("error", errs[i].Error()))
+
+			continue
+		}
+
+		for _, adv := range result {
+			if best, ok := advs[adv.Addr]; !ok || adv.RSSI > best.RSSI {
+				advs[adv.Addr] = adv
+			}
+		}
+	}
+
+	if failed == len(d.scanners) {
+		return nil, errors.Join(errs...)
+	}
+
+	return advs, nil
+}
+
+// Adapter returns the adapter the desk was heard best by, so it can be used as an AdapterSelector.
+func (d *Discovery) Adapter(addr string) (string, bool) {
+	desk, ok := d.Desk(addr)
+	if !ok || desk.Adapter == "" {
+		return "", false
+	}
+
+	return desk.Adapter, true
+}
+
+// Desks returns the desks in range, sorted by address, and the time of the last scan.
+func (d *Discovery) Desks() ([]DiscoveredDesk, time.Time) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	desks := make([]DiscoveredDesk, 0, len(d.desks))
+
+	for _, desk := range d.desks {
+		desks = append(desks, *desk)
+	}
+
+	slices.SortFunc(desks, func(a, b DiscoveredDesk) int { return strings.Compare(a.Addr, b.Addr) })
+
+	return desks, d.lastScan
+}
+
+// Desk returns the discovered desk with the given address.
+func (d *Discovery) Desk(addr string) (DiscoveredDesk, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	desk, ok := d.desks[addr]
+	if !ok {
+		return DiscoveredDesk{}, false //nolint:exhaustruct // not found
+	}
+
+	return *desk, true
+}
+
+func (d *DiscoveredDesk) update(adv Advertisement, now time.Time) {
+	d.Addr = adv.Addr
+	d.Name = adv.Name
+	d.RSSI = adv.RSSI
+	d.Connectable = adv.Connectable
+	d.ServiceUUIDs = adv.ServiceUUIDs
+	d.ManufacturerID = nil
+	d.Adapter = adv.Adapter
+	d.LastSeen = now
+
+	if id, ok := adv.ManufacturerID(); ok {
+		d.ManufacturerID = &id
+	}
+}
+
+func discoveryEvent(eventType EventType, addr string, now time.Time) Event {
+	return Event{Type: eventType, Desk: addr, Time: now, Height: 0, TargetHeight: 0, Err: nil}
+}
+
+// DiscoveryOptionsWithInterval sets how often the discovery scans.
+func DiscoveryOptionsWithInterval(interval time.Duration) DiscoveryOption {
+	return func(o *DiscoveryOptions) {
+		o.interval = interval
+	}
+}
+
+// DiscoveryOptionsWithExpireAfter sets how long a desk is kept after it was last seen.
+func DiscoveryOptionsWithExpireAfter(expireAfter time.Duration) DiscoveryOption {
+	return func(o *DiscoveryOptions) {
+		o.expireAfter = expireAfter
+	}
+}
+
+// DiscoveryOptionsWithConnected sets the function reporting whether a desk is connected, so it is not forgotten.
+func DiscoveryOptionsWithConnected(connected func(addr string) bool) DiscoveryOption {
+	return func(o *DiscoveryOptions) {
+		o.connected = connected
+	}
+}
+
+// DiscoveryOptionsWithEventObserver adds a function called when a desk appears or disappears.
+func DiscoveryOptionsWithEventObserver(observer EventObserver) DiscoveryOption {
+	return func(o *DiscoveryOptions) {
+		o.observers = append(o.observers, observer)
+	}
+}
+
+// DiscoveryOptionsWithClock sets the function used to get the current time.
+func DiscoveryOptionsWithClock(now func() time.Time) DiscoveryOption {
+	return func(o *DiscoveryOptions) {
+		o.now = now
+	}
+}
@@ -0,0 +1,194 @@
+package idasen_test
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeScanner returns the advertisements of the next batch selected by the filter on every scan.
+type fakeScanner struct {
+	scans [][]idasen.Advertisement
+}
+
+func (f *fakeScanner) Scan(
+	_ context.Context,
+	filter idasen.ScanFilter,
+	_ time.Duration,
+) ([]idasen.Advertisement, error) {
+	var advs []idasen.Advertisement
+
+	for _, adv := range f.scans[0] {
+		if filter.Matches(adv) {
+			advs = append(advs, adv)
+		}
+	}
+
+	f.scans = f.scans[1:]
+
+	return advs, nil
+}
+
+func newAdvertisement(name, addr string, rssi int, services ...string) idasen.Advertisement {
+	return idasen.Advertisement{
+		Name:             name,
+		Addr:             addr,
+		RSSI:             rssi,
+		Connectable:      true,
+		ServiceUUIDs:     services,
+		ManufacturerData: nil,
+		Adapter:          "",
+	}
+}
+
+func TestScanFilter(t *testing.T) {
+	t.Parallel()
+
+	filter := idasen.ScanFilter{
+		Name:            regexp.MustCompile("^Desk"),
+		ServiceUUIDs:    []string{"99FA0001-338A-1024-8A49-009C0215F78A"},
+		ManufacturerIDs: []uint16{0x0590},
+	}
+
+	linak := newAdvertisement("", "e8:5b:5b:24:22:e4", -60)
+	linak.ManufacturerData = []byte{0x90, 0x05, 0x01}
+
+	for name, test := range map[string]struct {
+		adv     idasen.Advertisement
+		matches bool
+	}{
+		"name": {adv: newAdvertisement("Desk 1234", "e8:5b:5b:24:22:e4", -60), matches: true},
+		"service": {
+			adv:     newAdvertisement("Office", "e8:5b:5b:24:22:e4", -60, idasen.LinakControlServiceUUID),
+			matches: true,
+		},
+		"manufacturer": {adv: linak, matches: true},
+		"other":        {adv: newAdvertisement("Headphones", "f0:99:b6:12:34:56", -40, "180f"), matches: false},
+	} {
+		require.Equal(t, test.matches, filter.Matches(test.adv), name)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	t.Parallel()
+
+	const (
+		office  = "e8:5b:5b:24:22:e4"
+		meeting = "c2:6d:2a:8b:3e:01"
+	)
+
+	scanner := &fakeScanner{scans: [][]idasen.Advertisement{
+		{newAdvertisement("Desk 1234", office, -60), newAdvertisement("Desk 5678", meeting, -80)},
+		{
+			newAdvertisement("Office desk", office, -55, idasen.LinakControlServiceUUID),
+			newAdvertisement("Headphones", "f0:99:b6:12:34:56", -40),
+		},
+		{},
+	}}
+
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	var events []idasen.Event
+
+	discovery := idasen.NewDiscovery(
+		[]*idasen.Scanner{idasen.NewScanner(scanner, slog.New(slog.DiscardHandler))},
+		slog.New(slog.DiscardHandler),
+		idasen.DiscoveryOptionsWithExpireAfter(5*time.Minute),
+		idasen.DiscoveryOptionsWithClock(func() time.Time { return now }),
+		idasen.DiscoveryOptionsWithConnected(func(addr string) bool { return addr == office }),
+		idasen.DiscoveryOptionsWithEventObserver(func(event idasen.Event) { events = append(events, event) }),
+	)
+
+	require.NoError(t, discovery.Scan(t.Context()))
+
+	desks, lastScan := discovery.Desks()
+	require.Len(t, desks, 2)
+	require.Equal(t, now, lastScan)
+
+	firstSeen := now
+	now = now.Add(6 * time.Minute)
+
+	require.NoError(t, discovery.Scan(t.Context()))
+
+	desks, _ = discovery.Desks()
+	require.Equal(t, []idasen.DiscoveredDesk{
+		{
+			Addr:           office,
+			Name:           "Office desk",
+			RSSI:           -55,
+			Connectable:    true,
+			ServiceUUIDs:   []string{idasen.LinakControlServiceUUID},
+			ManufacturerID: nil,
+			Adapter:        "",
+			FirstSeen:      firstSeen,
+			LastSeen:       now,
+		},
+	}, desks, "should forget desks not seen recently and find renamed desks by service")
+
+	now = now.Add(time.Hour)
+
+	require.NoError(t, discovery.Scan(t.Context()))
+
+	desks, _ = discovery.Desks()
+	require.Len(t, desks, 1, "should keep connected desks, which do not advertise")
+
+	types := make([]idasen.EventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+
+	require.ElementsMatch(t, []idasen.EventType{
+		idasen.EventAppeared,
+		idasen.EventAppeared,
+		idasen.EventDisappeared,
+	}, types)
+	require.Equal(t, meeting, events[2].Desk)
+}
+
+func TestDiscoveryPicksStrongestAdapter(t *testing.T) {
+	t.Parallel()
+
+	const (
+		office  = "e8:5b:5b:24:22:e4"
+		meeting = "c2:6d:2a:8b:3e:01"
+	)
+
+	logger := slog.New(slog.DiscardHandler)
+
+	discovery := idasen.NewDiscovery(
+		[]*idasen.Scanner{
+			idasen.NewScanner(
+				&fakeScanner{scans: [][]idasen.Advertisement{{
+					newAdvertisement("Desk 1234", office, -70),
+					newAdvertisement("Desk 5678", meeting, -50),
+				}}},
+				logger,
+				idasen.ScannerOptionsWithAdapter("hci0"),
+			),
+			idasen.NewScanner(
+				&fakeScanner{scans: [][]idasen.Advertisement{{newAdvertisement("Desk 1234", office, -45)}}},
+				logger,
+				idasen.ScannerOptionsWithAdapter("hci1"),
+			),
+		},
+		logger,
+	)
+
+	require.NoError(t, discovery.Scan(t.Context()))
+
+	adapter, ok := discovery.Adapter(office)
+	require.True(t, ok)
+	require.Equal(t, "hci1", adapter)
+
+	adapter, ok = discovery.Adapter(meeting)
+	require.True(t, ok)
+	require.Equal(t, "hci0", adapter)
+
+	_, ok = discovery.Adapter("f0:99:b6:12:34:56")
+	require.False(t, ok)
+}
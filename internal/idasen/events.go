@@ -0,0 +1,48 @@
+package idasen
+
+import "time"
+
+const (
+	EventMoveStarted   EventType = "move_started"
+	EventTargetReached EventType = "target_reached"
+	EventMoveFailed    EventType = "move_failed"
+	EventMoveTimedOut  EventType = "move_timed_out"
+	EventMoveCancelled EventType = "move_cancelled"
+	EventConnected     EventType = "desk_connected"
+	EventDisconnected  EventType = "desk_disconnected"
+	EventAppeared      EventType = "desk_appeared"
+	EventDisappeared   EventType = "desk_disappeared"
+)
+
+type (
+	EventType string
+	// Event is something that happened to a desk. Height is the height of the desk when it happened, and
+	// TargetHeight the target of the move it belongs to, if any.
+	Event struct {
+		Type         EventType
+		Desk         string
+		Time         time.Time
+		Height       int
+		TargetHeight int
+		Err          error
+	}
+	// EventObserver is called with every desk event, from the goroutines driving the desks, so it must not block.
+	EventObserver func(event Event)
+)
+
+func newEvent(eventType EventType, desk string, height, targetHeight int, err error) Event {
+	return Event{
+		Type:         eventType,
+		Desk:         desk,
+		Time:         time.Now(),
+		Height:       height,
+		TargetHeight: targetHeight,
+		Err:          err,
+	}
+}
+
+func emit(observers []EventObserver, event Event) {
+	for _, observer := range observers {
+		observer(event)
+	}
+}
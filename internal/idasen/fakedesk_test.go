@@ -0,0 +1,178 @@
+package idasen_test
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+)
+
+var errFakeClosed = errors.New("fake desk closed")
+
+// fakeDesk is an in-memory BTDesk. Height notifications are sent synchronously, like the BLE stack does. When step
+// is set, every move command changes the height by step and notifies it.
+type fakeDesk struct {
+	mutex     sync.Mutex
+	height    int
+	step      int
+	updateCh  chan<- int
+	moves     []string
+	closed    bool
+	stopCount int
+	name      string
+	memory    []int
+}
+
+var (
+	_ idasen.BTDesk         = (*fakeDesk)(nil)
+	_ idasen.BTDeskMetadata = (*fakeDesk)(nil)
+)
+
+func newFakeDesk(height int) *fakeDesk {
+	return &fakeDesk{
+		mutex:     sync.Mutex{},
+		height:    height,
+		step:      0,
+		updateCh:  nil,
+		moves:     nil,
+		closed:    false,
+		stopCount: 0,
+		name:      "Desk 1234",
+		memory:    []int{7200, 0, 0},
+	}
+}
+
+func (f *fakeDesk) ReadHeight() (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return 0, errFakeClosed
+	}
+
+	return f.height, nil
+}
+
+func (f *fakeDesk) MoveUp() error {
+	return f.move("up", 1)
+}
+
+func (f *fakeDesk) MoveDown() error {
+	return f.move("down", -1)
+}
+
+func (f *fakeDesk) Stop() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.stopCount++
+
+	return nil
+}
+
+func (f *fakeDesk) Subscribe(ch chan<- int) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.updateCh = ch
+
+	return nil
+}
+
+func (f *fakeDesk) Unsubscribe() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.updateCh = nil
+
+	return nil
+}
+
+func (f *fakeDesk) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.closed = true
+
+	return nil
+}
+
+func (f *fakeDesk) ReadName() (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.name, nil
+}
+
+func (f *fakeDesk) WriteName(name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.name = name
+
+	return nil
+}
+
+func (f *fakeDesk) ReadMemoryPositions() ([]int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return slices.Clone(f.memory), nil
+}
+
+func (f *fakeDesk) WriteMemoryPosition(slot, height int) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.memory[slot-1] = height
+
+	return nil
+}
+
+// notify simulates a height notification from the desk.
+func (f *fakeDesk) notify(height int) {
+	f.mutex.Lock()
+	f.height = height
+	ch := f.updateCh
+	f.mutex.Unlock()
+
+	if ch != nil {
+		ch <- height
+	}
+}
+
+func (f *fakeDesk) counts() (int, int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return len(f.moves), f.stopCount
+}
+
+func (f *fakeDesk) isClosed() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.closed
+}
+
+func (f *fakeDesk) move(move string, dir int) error {
+	f.mutex.Lock()
+
+	if f.closed {
+		f.mutex.Unlock()
+
+		return errFakeClosed
+	}
+
+	f.moves = append(f.moves, move)
+	height := f.height + dir*f.step
+	step := f.step
+	f.mutex.Unlock()
+
+	if step > 0 {
+		f.notify(height)
+	}
+
+	return nil
+}
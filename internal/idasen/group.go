@@ -0,0 +1,163 @@
+package idasen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var (
+	ErrStalled      = errors.New("desk stalled")
+	ErrGroupAborted = errors.New("group move aborted")
+)
+
+type (
+	// GroupMove moves the desk at Addr to Height as part of a group.
+	GroupMove struct {
+		Addr   string
+		Height int
+	}
+	// GroupMoveResult is the outcome of moving a desk of a group. Height is the height the desk reached, and Err is
+	// nil when it reached its target.
+	GroupMoveResult struct {
+		Addr   string
+		Height int
+		Err    error
+	}
+	GroupMoveOptions struct {
+		abortOnFailure bool
+		stallTimeout   time.Duration
+	}
+	GroupMoveOption func(*GroupMoveOptions)
+)
+
+// MoveGroup moves the desks concurrently and returns the result of every move, in the same order. With
+// abortOnFailure, the first desk failing or stalling stops the desks still moving, whose moves fail with
+// ErrGroupAborted.
+func (m *Manager) MoveGroup(ctx context.Context, moves []GroupMove, opts ...GroupMoveOption) []GroupMoveResult {
+	options := &GroupMoveOptions{
+		abortOnFailure: false,
+		stallTimeout:   0,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	groupCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+
+	var wg sync.WaitGroup
+
+	results := make([]GroupMoveResult, len(moves))
+
+	for i, move := range moves {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			height, err := m.moveGroupMember(groupCtx, move, options.stallTimeout)
+			if err != nil && !errors.Is(err, ErrGroupAborted) && options.abortOnFailure {
+				m.logger.WarnContext(
+					ctx,
+					"Aborting group move",
+					slog.String("address", move.Addr),
+					slog.String("error", err.Error()),
+				)
+				abort(fmt.Errorf("%w: desk %s failed", ErrGroupAborted, move.Addr))
+			}
+
+			results[i] = GroupMoveResult{Addr: move.Addr, Height: height, Err: err}
+		}()
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// moveGroupMember moves a desk of a group. Cancelling ctx stops the desk, and its move fails with the cause of the
+// cancellation when it is ErrGroupAborted.
+func (m *Manager) moveGroupMember(ctx context.Context, move GroupMove, stallTimeout time.Duration) (int, error) {
+	moveCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	if stallTimeout > 0 {
+		go m.watchStall(moveCtx, cancel, move.Addr, stallTimeout)
+	}
+
+	height, err := m.MoveTo(moveCtx, move.Addr, move.Height)
+	if err == nil {
+		return height, nil
+	}
+
+	if cause := context.Cause(moveCtx); errors.Is(cause, ErrStalled) || errors.Is(cause, ErrGroupAborted) {
+		err = fmt.Errorf("%w: %w", cause, err)
+	}
+
+	if deskService := m.connected(move.Addr); deskService != nil {
+		if reading, readErr := deskService.ReadHeight(); readErr == nil {
+			height = reading
+		}
+	}
+
+	return height, err
+}
+
+// watchStall cancels the move with ErrStalled when the desk is moving but its height did not change for timeout. It
+// does not connect to the desk.
+func (m *Manager) watchStall(ctx context.Context, cancel context.CancelCauseFunc, addr string, timeout time.Duration) {
+	ticker := time.NewTicker(timeout)
+	defer ticker.Stop()
+
+	last := -1
+
+	for {
+		select {
+		case <-ticker.C:
+			deskService := m.connected(addr)
+			if deskService == nil || !deskService.IsMoving() {
+				last = -1
+
+				continue
+			}
+
+			height, err := deskService.ReadHeight()
+			if err != nil {
+				last = -1
+
+				continue
+			}
+
+			if height == last {
+				m.logger.WarnContext(ctx, "Desk stalled", slog.String("address", addr), slog.Int("height", height))
+				cancel(fmt.Errorf("%w: height %d did not change for %s", ErrStalled, height, timeout))
+
+				return
+			}
+
+			last = height
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// GroupMoveOptionsWithAbortOnFailure stops every desk of the group as soon as one fails or stalls.
+func GroupMoveOptionsWithAbortOnFailure(abortOnFailure bool) GroupMoveOption {
+	return func(o *GroupMoveOptions) {
+		o.abortOnFailure = abortOnFailure
+	}
+}
+
+// GroupMoveOptionsWithStallTimeout fails the move of a desk whose height does not change for timeout while it moves.
+// 0 disables it.
+func GroupMoveOptionsWithStallTimeout(timeout time.Duration) GroupMoveOption {
+	return func(o *GroupMoveOptions) {
+		o.stallTimeout = timeout
+	}
+}
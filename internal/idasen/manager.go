@@ -2,39 +2,100 @@ package idasen
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+var (
+	ErrManagerClosed  = errors.New("manager is closed")
+	ErrShuttingDown   = errors.New("manager is shutting down")
+	ErrUnknownAdapter = errors.New("unknown bluetooth adapter")
+)
+
 type (
+	// Manager lazily connects to desks and keeps a DeskService per address. It is safe for concurrent use: each
+	// desk is initialized once, in the background, and callers only wait for the desk they asked for. Desks with an
+	// idle timeout are disconnected once unused, and reconnected on the next request.
 	Manager struct {
-		runCtx       context.Context
-		desks        map[string]*DeskService
-		initMutexMap map[string]*sync.Mutex
-		logger       *slog.Logger
-		newBTClient  NewBTClient
+		runCtx        context.Context
+		mutex         sync.Mutex
+		desks         map[string]*deskEntry
+		disconnecting map[string]chan struct{}
+		moves         map[int]context.CancelCauseFunc // moves started before draining, by id
+		nextMove      int
+		draining      bool
+		closed        bool
+		logger        *slog.Logger
+		newBTClient   NewBTClient
+		options       *ManagerOptions
+	}
+	ManagerOptions struct {
+		deskServiceOptions []DeskServiceOption
+		idleTimeout        time.Duration
+		deskIdleTimeouts   map[string]time.Duration
+		eventObservers     []EventObserver
+		adapters           map[string]NewBTClient
+		deskAdapters       map[string]string
+		adapterSelector    AdapterSelector
+	}
+	ManagerOption func(*ManagerOptions)
+	// AdapterSelector picks the adapter to connect to a desk through, for desks without an assigned adapter.
+	AdapterSelector func(addr string) (string, bool)
+	NewBTClient     func(context.Context, string) (BTDesk, error)
+	// deskEntry is the registry slot of a desk, guarded by the manager mutex. ready is closed once initialization
+	// finished, after which service and err are read-only.
+	deskEntry struct {
+		ready     chan struct{}
+		service   *DeskService
+		cancel    context.CancelFunc
+		err       error
+		active    int
+		lastUsed  time.Time
+		idleTimer *time.Timer
 	}
-	NewBTClient func(context.Context, string) (BTDesk, error)
 )
 
-func NewManager(runCtx context.Context, newBLEClient NewBTClient, logger *slog.Logger) *Manager {
+func NewManager(runCtx context.Context, newBLEClient NewBTClient, logger *slog.Logger, opts ...ManagerOption) *Manager {
+	options := &ManagerOptions{
+		deskServiceOptions: nil,
+		idleTimeout:        0,
+		deskIdleTimeouts:   map[string]time.Duration{},
+		eventObservers:     nil,
+		adapters:           map[string]NewBTClient{},
+		deskAdapters:       map[string]string{},
+		adapterSelector:    nil,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	return &Manager{
-		newBTClient:  newBLEClient,
-		runCtx:       runCtx,
-		desks:        make(map[string]*DeskService),
-		initMutexMap: make(map[string]*sync.Mutex),
-		logger:       logger.With("component", "idasen-manager"),
+		newBTClient:   newBLEClient,
+		runCtx:        runCtx,
+		mutex:         sync.Mutex{},
+		desks:         make(map[string]*deskEntry),
+		disconnecting: make(map[string]chan struct{}),
+		moves:         make(map[int]context.CancelCauseFunc),
+		nextMove:      0,
+		draining:      false,
+		closed:        false,
+		options:       options,
+		logger:        logger.With("component", "idasen-manager"),
 	}
 }
 
 func (m *Manager) ReadHeight(addr string) (int, error) {
-	deskService, err := m.getDesk(addr)
+	deskService, release, err := m.acquire(m.runCtx, addr)
 	if err != nil {
 		return 0, fmt.Errorf("desk not found: %w", err)
 	}
+	defer release()
 
 	reading, err := deskService.ReadHeight()
 	if err != nil {
@@ -45,19 +106,35 @@ func (m *Manager) ReadHeight(addr string) (int, error) {
 }
 
 func (m *Manager) MoveTo(ctx context.Context, addr string, targetHeight int) (int, error) {
-	deskService, err := m.getDesk(addr)
+	if m.isDraining() {
+		return 0, ErrShuttingDown
+	}
+
+	deskService, release, err := m.acquire(ctx, addr)
 	if err != nil {
 		return 0, fmt.Errorf("desk not found: %w", err)
 	}
+	defer release()
+
+	// Connecting may take a while, during which the manager may have started draining
+	moveCtx, done, err := m.startMove(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
 
 	errCh := make(chan error)
 	defer close(errCh)
 
-	go deskService.MoveTo(ctx, errCh, targetHeight)
+	go deskService.MoveTo(moveCtx, errCh, targetHeight)
 
 	err = <-errCh
 
 	if err != nil {
+		if cause := context.Cause(moveCtx); errors.Is(cause, ErrShuttingDown) {
+			err = fmt.Errorf("%w: %w", cause, err)
+		}
+
 		return 0, fmt.Errorf("moving desk to target height: %w", err)
 	}
 
@@ -69,13 +146,40 @@ func (m *Manager) MoveTo(ctx context.Context, addr string, targetHeight int) (in
 	return height, nil
 }
 
-func (m *Manager) Subscribe(addr string, ch chan<- int) (uuid.UUID, error) {
-	deskService, err := m.getDesk(addr)
+func (m *Manager) Stop(ctx context.Context, addr string) (int, error) {
+	deskService, release, err := m.acquire(ctx, addr)
+	if err != nil {
+		return 0, fmt.Errorf("desk not found: %w", err)
+	}
+	defer release()
+
+	errCh := make(chan error)
+	defer close(errCh)
+
+	go deskService.Stop(ctx, errCh)
+
+	if err = <-errCh; err != nil {
+		return 0, fmt.Errorf("stopping desk: %w", err)
+	}
+
+	height, err := deskService.ReadHeight()
+	if err != nil {
+		m.logger.ErrorContext(ctx, "Error reading height", slog.String("error", err.Error()))
+	}
+
+	return height, nil
+}
+
+// Subscribe registers ch for height updates of the desk. See DeskService.Subscribe for the ownership of ch. The
+// desk is kept connected while it has subscribers.
+func (m *Manager) Subscribe(addr string, ch chan<- int, opts ...SubscriptionOption) (uuid.UUID, error) {
+	deskService, release, err := m.acquire(m.runCtx, addr)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("desk not found: %w", err)
 	}
+	defer release()
 
-	subscriptionID := deskService.Subscribe(ch)
+	subscriptionID := deskService.Subscribe(ch, opts...)
 
 	m.logger.Info(
 		"Subscribed to desk service",
@@ -86,22 +190,138 @@ func (m *Manager) Subscribe(addr string, ch chan<- int) (uuid.UUID, error) {
 	return subscriptionID, nil
 }
 
+// Unsubscribe ends a subscription. It does not connect to the desk, as a disconnected desk has no subscribers.
 func (m *Manager) Unsubscribe(addr string, id uuid.UUID) error {
-	deskService, err := m.getDesk(addr)
-	if err != nil {
-		return fmt.Errorf("desk not found: %w", err)
+	if deskService := m.connected(addr); deskService != nil {
+		deskService.Unsubscribe(id)
+	}
+
+	return nil
+}
+
+// SubscriptionStats returns the stats of the subscribers of the desk, which has none when it is not connected.
+func (m *Manager) SubscriptionStats(addr string) ([]SubscriptionStats, error) {
+	deskService := m.connected(addr)
+	if deskService == nil {
+		return []SubscriptionStats{}, nil
+	}
+
+	return deskService.SubscriptionStats(), nil
+}
+
+// IsMoving reports whether the desk is running a moveTo command. It does not connect to the desk, as a disconnected
+// desk is not moving.
+func (m *Manager) IsMoving(addr string) bool {
+	deskService := m.connected(addr)
+
+	return deskService != nil && deskService.IsMoving()
+}
+
+// IsConnected reports whether the desk is connected, without connecting to it.
+func (m *Manager) IsConnected(addr string) bool {
+	return m.connected(addr) != nil
+}
+
+// Drain makes the manager reject new moves with ErrShuttingDown. Moves already started are cancelled, which stops
+// their desks even when their command is still waiting for the desk. Reads and stops are still served.
+func (m *Manager) Drain() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.draining = true
+
+	for _, cancel := range m.moves {
+		cancel(ErrShuttingDown)
+	}
+}
+
+// StopMoving sends a stop command to every connected desk that is moving, cancelling its moveTo command.
+func (m *Manager) StopMoving(ctx context.Context) error {
+	var errs []error
+
+	for addr, deskService := range m.connectedDesks() {
+		if !deskService.IsMoving() {
+			continue
+		}
+
+		errCh := make(chan error, 1)
+		deskService.Stop(ctx, errCh)
+
+		if err := <-errCh; err != nil {
+			errs = append(errs, fmt.Errorf("stopping desk %s: %w", addr, err))
+
+			continue
+		}
+
+		m.logger.InfoContext(ctx, "Stopped moving desk", slog.String("address", addr))
 	}
 
-	deskService.Unsubscribe(id)
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// UnsubscribeAll ends the subscriptions of every connected desk.
+func (m *Manager) UnsubscribeAll() {
+	for addr, deskService := range m.connectedDesks() {
+		if count := deskService.subscriberCount(); count > 0 {
+			deskService.closeSubscribers()
+
+			m.logger.Info("Unsubscribed desk subscribers", slog.String("address", addr), slog.Int("count", count))
+		}
+	}
+}
+
+// Close closes every initialized desk service. Desks still being initialized are closed as soon as they finish.
+// Closing an already closed manager does nothing.
 func (m *Manager) Close() error {
-	for addr, desk := range m.desks {
-		if err := desk.Close(); err != nil {
-			return fmt.Errorf("closing desk service for %s: %w", addr, err)
+	m.mutex.Lock()
+
+	if m.closed {
+		m.mutex.Unlock()
+
+		return nil
+	}
+
+	m.closed = true
+	entries := make(map[string]*deskEntry, len(m.desks))
+
+	for addr, entry := range m.desks {
+		entries[addr] = entry
+
+		if entry.idleTimer != nil {
+			entry.idleTimer.Stop()
+		}
+	}
+
+	disconnecting := make([]chan struct{}, 0, len(m.disconnecting))
+	for _, done := range m.disconnecting {
+		disconnecting = append(disconnecting, done)
+	}
+	m.mutex.Unlock()
+
+	var errs []error
+
+	for addr, entry := range entries {
+		<-entry.ready
+
+		if entry.err != nil {
+			continue
 		}
+
+		if err := m.disconnect(entry); err != nil {
+			errs = append(errs, fmt.Errorf("closing desk service for %s: %w", addr, err))
+		}
+	}
+
+	for _, done := range disconnecting {
+		<-done
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
 	}
 
 	m.logger.Info("All desk services closed")
@@ -109,47 +329,375 @@ func (m *Manager) Close() error {
 	return nil
 }
 
-func (m *Manager) getDesk(addr string) (*DeskService, error) {
-	if err := m.ensureDeskStarted(m.runCtx, addr); err != nil {
-		return nil, fmt.Errorf("desk initialization: %w", err)
+// acquire returns the desk service for addr, connecting to the desk if needed. It waits until the desk is ready or
+// ctx is done. The desk is not disconnected for being idle until release is called.
+func (m *Manager) acquire(ctx context.Context, addr string) (*DeskService, func(), error) {
+	m.mutex.Lock()
+
+	if m.closed {
+		m.mutex.Unlock()
+
+		return nil, nil, ErrManagerClosed
 	}
 
-	deskService, ok := m.desks[addr]
+	entry, ok := m.desks[addr]
 	if !ok {
-		return nil, fmt.Errorf("desk service not found for address %s", addr)
+		entry = &deskEntry{
+			ready:     make(chan struct{}),
+			service:   nil,
+			cancel:    nil,
+			err:       nil,
+			active:    0,
+			lastUsed:  time.Time{},
+			idleTimer: nil,
+		}
+		m.desks[addr] = entry
+
+		// A cancelled request must not abort the dial for other callers, so the desk runs with the run context
+		go m.initDesk(addr, entry, m.disconnecting[addr])
 	}
 
-	return deskService, nil
+	entry.active++
+	m.mutex.Unlock()
+
+	release := func() {
+		m.release(addr, entry)
+	}
+
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		release()
+
+		return nil, nil, fmt.Errorf("waiting for desk initialization: %w", ctx.Err())
+	}
+
+	if entry.err != nil {
+		release()
+
+		return nil, nil, fmt.Errorf("desk initialization: %w", entry.err)
+	}
+
+	return entry.service, release, nil
 }
 
-func (m *Manager) ensureDeskStarted(ctx context.Context, addr string) error {
-	deskMutex, ok := m.initMutexMap[addr]
-	if !ok {
-		deskMutex = &sync.Mutex{}
-		m.initMutexMap[addr] = deskMutex
+func (m *Manager) release(addr string, entry *deskEntry) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry.active--
+	entry.lastUsed = time.Now()
+
+	if m.desks[addr] == entry {
+		m.scheduleIdle(addr, entry)
 	}
+}
 
-	deskMutex.Lock()
-	defer deskMutex.Unlock()
+// connected returns the desk service for addr if the desk is connected, without connecting to it otherwise.
+func (m *Manager) connected(addr string) *DeskService {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
-	// Check if the desk is already initialized
-	if _, ok = m.desks[addr]; ok {
+	entry, ok := m.desks[addr]
+	if !ok {
 		return nil
 	}
 
-	bleClient, err := m.newBTClient(ctx, addr)
+	return entry.service
+}
+
+func (m *Manager) connectedDesks() map[string]*DeskService {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	desks := make(map[string]*DeskService, len(m.desks))
+
+	for addr, entry := range m.desks {
+		if entry.service != nil {
+			desks[addr] = entry.service
+		}
+	}
+
+	return desks
+}
+
+// startMove registers a move so Drain can cancel it, unless the manager is draining. done must be called once the
+// move finished.
+func (m *Manager) startMove(ctx context.Context) (context.Context, func(), error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.draining {
+		return nil, nil, ErrShuttingDown
+	}
+
+	moveCtx, cancel := context.WithCancelCause(ctx)
+	id := m.nextMove
+	m.nextMove++
+	m.moves[id] = cancel
+
+	return moveCtx, func() {
+		m.mutex.Lock()
+		delete(m.moves, id)
+		m.mutex.Unlock()
+
+		cancel(nil)
+	}, nil
+}
+
+func (m *Manager) isDraining() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.draining
+}
+
+// initDesk connects to the desk once the previous connection, if it is still being disconnected, is gone.
+func (m *Manager) initDesk(addr string, entry *deskEntry, previous <-chan struct{}) {
+	if previous != nil {
+		select {
+		case <-previous:
+		case <-m.runCtx.Done():
+		}
+	}
+
+	ctx, cancel := context.WithCancel(m.runCtx)
+
+	service, err := m.startDesk(ctx, addr)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	defer close(entry.ready)
+
 	if err != nil {
-		return fmt.Errorf("creating bluetooth client: %w", err)
+		cancel()
+
+		entry.err = err
+
+		m.logger.ErrorContext(
+			ctx,
+			"Error initializing desk service",
+			slog.String("address", addr),
+			slog.String("error", err.Error()),
+		)
+
+		// Forget the failed entry so the next request retries
+		if m.desks[addr] == entry {
+			delete(m.desks, addr)
+		}
+
+		return
 	}
 
-	deskService := NewDeskService(addr, bleClient, m.logger)
-	if err = deskService.Start(ctx); err != nil {
-		return fmt.Errorf("starting desk service: %w", err)
+	entry.service = service
+	entry.cancel = cancel
+	entry.lastUsed = time.Now()
+
+	if !m.closed {
+		m.scheduleIdle(addr, entry)
+	}
+}
+
+// scheduleIdle arms the idle timer of a connected desk nobody is using. The caller must hold the manager mutex.
+func (m *Manager) scheduleIdle(addr string, entry *deskEntry) {
+	idleTimeout := m.idleTimeout(addr)
+	if idleTimeout <= 0 || entry.active > 0 || entry.service == nil {
+		return
 	}
 
-	m.desks[addr] = deskService
+	if entry.idleTimer == nil {
+		entry.idleTimer = time.AfterFunc(idleTimeout, func() {
+			m.expire(addr, entry)
+		})
 
-	m.logger.InfoContext(ctx, "Desk service initialized", slog.String("address", addr))
+		return
+	}
+
+	entry.idleTimer.Reset(idleTimeout)
+}
+
+// expire disconnects the desk if it is still idle. The next request connects to it again.
+func (m *Manager) expire(addr string, entry *deskEntry) {
+	m.mutex.Lock()
+
+	if m.closed || m.desks[addr] != entry || entry.active > 0 {
+		m.mutex.Unlock()
+
+		return
+	}
+
+	idleTimeout := m.idleTimeout(addr)
+
+	if wait := idleTimeout - time.Since(entry.lastUsed); wait > 0 {
+		entry.idleTimer.Reset(wait)
+		m.mutex.Unlock()
+
+		return
+	}
+
+	if entry.service.subscriberCount() > 0 {
+		entry.idleTimer.Reset(idleTimeout)
+		m.mutex.Unlock()
+
+		return
+	}
+
+	delete(m.desks, addr)
+
+	disconnected := make(chan struct{})
+	m.disconnecting[addr] = disconnected
+	m.mutex.Unlock()
+
+	m.logger.InfoContext(
+		m.runCtx,
+		"Disconnecting idle desk",
+		slog.String("address", addr),
+		slog.Duration("idleTimeout", idleTimeout),
+	)
+
+	if err := m.disconnect(entry); err != nil {
+		m.logger.ErrorContext(
+			m.runCtx,
+			"Error disconnecting idle desk",
+			slog.String("address", addr),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	m.mutex.Lock()
+	if m.disconnecting[addr] == disconnected {
+		delete(m.disconnecting, addr)
+	}
+	m.mutex.Unlock()
+
+	close(disconnected)
+}
+
+// disconnect stops the run loop of the desk service and closes its bluetooth client.
+func (m *Manager) disconnect(entry *deskEntry) error {
+	done, isRunning := entry.service.runDone()
+
+	entry.cancel()
+
+	if isRunning {
+		<-done
+	}
+
+	err := entry.service.Close()
+
+	emit(m.options.eventObservers, newEvent(EventDisconnected, entry.service.uuid, entry.service.readHeight(), 0, err))
+
+	if err != nil {
+		return fmt.Errorf("closing desk service: %w", err)
+	}
 
 	return nil
 }
+
+func (m *Manager) idleTimeout(addr string) time.Duration {
+	if idleTimeout, ok := m.options.deskIdleTimeouts[addr]; ok {
+		return idleTimeout
+	}
+
+	return m.options.idleTimeout
+}
+
+// btClientFor returns the function connecting to the desk through its assigned adapter, the one picked by the
+// adapter selector, or the default one, in that order.
+func (m *Manager) btClientFor(addr string) (NewBTClient, string, error) {
+	adapter, ok := m.options.deskAdapters[addr]
+	if !ok && m.options.adapterSelector != nil {
+		adapter, ok = m.options.adapterSelector(addr)
+	}
+
+	if !ok || adapter == "" {
+		return m.newBTClient, "", nil
+	}
+
+	newBTClient, found := m.options.adapters[adapter]
+	if !found {
+		return nil, adapter, fmt.Errorf("%w: %s", ErrUnknownAdapter, adapter)
+	}
+
+	return newBTClient, adapter, nil
+}
+
+func (m *Manager) startDesk(ctx context.Context, addr string) (*DeskService, error) {
+	newBTClient, adapter, err := m.btClientFor(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	bleClient, err := newBTClient(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("creating bluetooth client: %w", err)
+	}
+
+	deskService := NewDeskService(addr, bleClient, m.logger, m.options.deskServiceOptions...)
+	if err = deskService.Start(ctx); err != nil {
+		if closeErr := bleClient.Close(); closeErr != nil {
+			m.logger.ErrorContext(ctx, "Error closing bluetooth client", slog.String("error", closeErr.Error()))
+		}
+
+		return nil, fmt.Errorf("starting desk service: %w", err)
+	}
+
+	m.logger.InfoContext(ctx, "Desk service initialized", slog.String("address", addr), slog.String("adapter", adapter))
+
+	emit(m.options.eventObservers, newEvent(EventConnected, addr, deskService.readHeight(), 0, nil))
+
+	return deskService, nil
+}
+
+// ManagerOptionsWithDeskServiceOptions sets the options used for every desk service created by the manager.
+func ManagerOptionsWithDeskServiceOptions(opts ...DeskServiceOption) ManagerOption {
+	return func(o *ManagerOptions) {
+		o.deskServiceOptions = append(o.deskServiceOptions, opts...)
+	}
+}
+
+// ManagerOptionsWithIdleTimeout sets how long a desk stays connected without requests or subscribers. Zero, the
+// default, keeps desks connected.
+func ManagerOptionsWithIdleTimeout(timeout time.Duration) ManagerOption {
+	return func(o *ManagerOptions) {
+		o.idleTimeout = timeout
+	}
+}
+
+// ManagerOptionsWithDeskIdleTimeout overrides the idle timeout of a single desk.
+func ManagerOptionsWithDeskIdleTimeout(addr string, timeout time.Duration) ManagerOption {
+	return func(o *ManagerOptions) {
+		o.deskIdleTimeouts[addr] = timeout
+	}
+}
+
+// ManagerOptionsWithEventObserver adds a function called with the events of every desk: moves, connections and
+// disconnections.
+func ManagerOptionsWithEventObserver(observer EventObserver) ManagerOption {
+	return func(o *ManagerOptions) {
+		o.eventObservers = append(o.eventObservers, observer)
+		o.deskServiceOptions = append(o.deskServiceOptions, DeskServiceOptionsWithEventObserver(observer))
+	}
+}
+
+// ManagerOptionsWithAdapter adds a named bluetooth adapter, connecting to desks with newBTClient.
+func ManagerOptionsWithAdapter(name string, newBTClient NewBTClient) ManagerOption {
+	return func(o *ManagerOptions) {
+		o.adapters[name] = newBTClient
+	}
+}
+
+// ManagerOptionsWithDeskAdapter connects to a single desk through the named adapter.
+func ManagerOptionsWithDeskAdapter(addr, adapter string) ManagerOption {
+	return func(o *ManagerOptions) {
+		o.deskAdapters[addr] = adapter
+	}
+}
+
+// ManagerOptionsWithAdapterSelector sets the function picking the adapter of desks without an assigned one. Desks
+// it picks no adapter for use the default one.
+func ManagerOptionsWithAdapterSelector(selector AdapterSelector) ManagerOption {
+	return func(o *ManagerOptions) {
+		o.adapterSelector = selector
+	}
+}
@@ -0,0 +1,497 @@
+package idasen_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errFakeDial = errors.New("fake dial failed")
+
+// fakeDialer creates fake desks on demand and counts the dials per address.
+type fakeDialer struct {
+	mutex sync.Mutex
+	desks map[string]*fakeDesk
+	dials map[string]int
+	step  int
+	// dial is called before a desk is created. It may block or fail the dial.
+	dial func(ctx context.Context, addr string, attempt int) error
+}
+
+func newFakeDialer(dial func(ctx context.Context, addr string, attempt int) error) *fakeDialer {
+	return &fakeDialer{
+		mutex: sync.Mutex{},
+		desks: map[string]*fakeDesk{},
+		dials: map[string]int{},
+		step:  100,
+		dial:  dial,
+	}
+}
+
+func (d *fakeDialer) newBTClient(ctx context.Context, addr string) (idasen.BTDesk, error) {
+	d.mutex.Lock()
+	d.dials[addr]++
+	attempt := d.dials[addr]
+	d.mutex.Unlock()
+
+	if d.dial != nil {
+		if err := d.dial(ctx, addr, attempt); err != nil {
+			return nil, err
+		}
+	}
+
+	desk := newFakeDesk(7000)
+	desk.step = d.step
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.desks[addr] = desk
+
+	return desk, nil
+}
+
+func (d *fakeDialer) dialCount(addr string) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.dials[addr]
+}
+
+func (d *fakeDialer) desk(addr string) *fakeDesk {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.desks[addr]
+}
+
+func newTestManager(t *testing.T, dialer *fakeDialer, opts ...idasen.ManagerOption) *idasen.Manager {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	return idasen.NewManager(
+		ctx,
+		dialer.newBTClient,
+		slog.New(slog.DiscardHandler),
+		append([]idasen.ManagerOption{
+			idasen.ManagerOptionsWithDeskServiceOptions(
+				idasen.DeskServiceOptionsWithPollInterval(time.Millisecond),
+				idasen.DeskServiceOptionsWithTimeout(5*time.Second),
+			),
+		}, opts...)...,
+	)
+}
+
+func TestManagerConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	dialer := newFakeDialer(func(_ context.Context, _ string, _ int) error {
+		time.Sleep(time.Duration(rand.IntN(20)) * time.Millisecond) //nolint:gosec // jitter for the test
+
+		return nil
+	})
+	manager := newTestManager(t, dialer)
+
+	addrs := make([]string, 5)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("desk-%d", i)
+	}
+
+	var wg sync.WaitGroup
+
+	for worker := range 40 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range 20 {
+				addr := addrs[(worker+i)%len(addrs)]
+
+				switch i % 4 {
+				case 0:
+					_, err := manager.ReadHeight(addr)
+					assert.NoError(t, err)
+				case 1:
+					// Concurrent moves of the same desk cancel each other
+					_, err := manager.MoveTo(context.Background(), addr, 7000+100*rand.IntN(10)) //nolint:gosec // test
+					if err != nil {
+						assert.True(t, errors.Is(err, idasen.ErrCancelled), err.Error())
+					}
+				case 2:
+					id, err := manager.Subscribe(addr, make(chan int, 1))
+					assert.NoError(t, err)
+					assert.NoError(t, manager.Unsubscribe(addr, id))
+				case 3:
+					_, err := manager.Stop(context.Background(), addr)
+					assert.NoError(t, err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, addr := range addrs {
+		require.Equal(t, 1, dialer.dialCount(addr), "desk %s should be initialized once", addr)
+	}
+
+	require.NoError(t, manager.Close())
+
+	for _, addr := range addrs {
+		require.True(t, dialer.desk(addr).isClosed())
+	}
+
+	_, err := manager.ReadHeight(addrs[0])
+	require.True(t, errors.Is(err, idasen.ErrManagerClosed))
+}
+
+func TestManagerRetriesFailedInitialization(t *testing.T) {
+	t.Parallel()
+
+	dialer := newFakeDialer(func(_ context.Context, _ string, attempt int) error {
+		if attempt == 1 {
+			return errFakeDial
+		}
+
+		return nil
+	})
+	manager := newTestManager(t, dialer)
+
+	_, err := manager.ReadHeight("desk")
+	require.True(t, errors.Is(err, errFakeDial))
+
+	height, err := manager.ReadHeight("desk")
+	require.NoError(t, err)
+	require.Equal(t, 7000, height)
+	require.Equal(t, 2, dialer.dialCount("desk"))
+}
+
+func TestManagerSlowDialDoesNotBlockOtherDesks(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	dialer := newFakeDialer(func(ctx context.Context, addr string, _ int) error {
+		if addr != "slow" {
+			return nil
+		}
+
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	manager := newTestManager(t, dialer)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := manager.MoveTo(ctx, "slow", 8000)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	height, err := manager.ReadHeight("fast")
+	require.NoError(t, err)
+	require.Equal(t, 7000, height)
+
+	close(release)
+
+	height, err = manager.MoveTo(context.Background(), "slow", 8000)
+	require.NoError(t, err)
+	require.Equal(t, 8000, height)
+	require.Equal(t, 1, dialer.dialCount("slow"), "the abandoned wait should not restart the dial")
+}
+
+func TestManagerIdleDisconnect(t *testing.T) {
+	t.Parallel()
+
+	dialer := newFakeDialer(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	manager := idasen.NewManager(
+		ctx,
+		dialer.newBTClient,
+		slog.New(slog.DiscardHandler),
+		idasen.ManagerOptionsWithIdleTimeout(20*time.Millisecond),
+		idasen.ManagerOptionsWithDeskIdleTimeout("pinned", 0),
+	)
+
+	_, err := manager.ReadHeight("desk")
+	require.NoError(t, err)
+
+	_, err = manager.ReadHeight("pinned")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return dialer.desk("desk").isClosed()
+	}, 5*time.Second, 5*time.Millisecond, "idle desk should be disconnected")
+
+	_, err = manager.ReadHeight("desk")
+	require.NoError(t, err)
+	require.Equal(t, 2, dialer.dialCount("desk"), "should reconnect on the next request")
+
+	ch := make(chan int)
+	id, err := manager.Subscribe("desk", ch)
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	require.False(t, dialer.desk("desk").isClosed(), "desk with subscribers should stay connected")
+	require.False(t, dialer.desk("pinned").isClosed(), "desk without idle timeout should stay connected")
+
+	require.NoError(t, manager.Unsubscribe("desk", id))
+
+	require.Eventually(t, func() bool {
+		return dialer.desk("desk").isClosed()
+	}, 5*time.Second, 5*time.Millisecond, "desk should be disconnected once unsubscribed")
+
+	require.NoError(t, manager.Close())
+}
+
+func TestManagerShutdown(t *testing.T) {
+	t.Parallel()
+
+	dialer := newFakeDialer(nil)
+	// Desks never reach the target, so moves last until stopped
+	dialer.step = 0
+	manager := newTestManager(t, dialer)
+
+	moveErr := make(chan error, 1)
+
+	go func() {
+		_, err := manager.MoveTo(context.Background(), "desk", 8000)
+		moveErr <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		desk := dialer.desk("desk")
+		if desk == nil {
+			return false
+		}
+
+		moves, _ := desk.counts()
+
+		return moves > 0
+	}, 5*time.Second, 5*time.Millisecond)
+
+	manager.Drain()
+
+	_, err := manager.MoveTo(context.Background(), "desk", 9000)
+	require.True(t, errors.Is(err, idasen.ErrShuttingDown))
+
+	require.NoError(t, manager.StopMoving(context.Background()))
+
+	select {
+	case err = <-moveErr:
+		require.True(t, errors.Is(err, idasen.ErrCancelled))
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight move was not stopped")
+	}
+
+	_, stops := dialer.desk("desk").counts()
+	require.Greater(t, stops, 0)
+
+	ch := make(chan int)
+	_, err = manager.Subscribe("desk", ch)
+	require.NoError(t, err)
+
+	manager.UnsubscribeAll()
+
+	_, ok := <-ch
+	require.False(t, ok, "subscriber channel should be closed")
+
+	require.NoError(t, manager.Close())
+	require.True(t, dialer.desk("desk").isClosed())
+	require.NoError(t, manager.Close(), "closing twice should be a no-op")
+}
+
+func TestManagerShutdownDuringDial(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	dialer := newFakeDialer(func(ctx context.Context, _ string, _ int) error {
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	manager := newTestManager(t, dialer)
+
+	moveErr := make(chan error, 1)
+
+	go func() {
+		_, err := manager.MoveTo(context.Background(), "desk", 8000)
+		moveErr <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		return dialer.dialCount("desk") == 1
+	}, 5*time.Second, time.Millisecond)
+
+	manager.Drain()
+	require.NoError(t, manager.StopMoving(context.Background()))
+
+	close(release)
+
+	select {
+	case err := <-moveErr:
+		require.ErrorIs(t, err, idasen.ErrShuttingDown)
+	case <-time.After(5 * time.Second):
+		t.Fatal("move waiting for the dial was not rejected")
+	}
+
+	moves, _ := dialer.desk("desk").counts()
+	require.Zero(t, moves, "the desk should not start moving once draining")
+	require.NoError(t, manager.Close())
+}
+
+func TestManagerEvents(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mutex  sync.Mutex
+		events []idasen.EventType
+	)
+
+	manager := newTestManager(t, newFakeDialer(nil), idasen.ManagerOptionsWithEventObserver(func(event idasen.Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		events = append(events, event.Type)
+	}))
+
+	_, err := manager.MoveTo(t.Context(), "desk-0", 7500)
+	require.NoError(t, err)
+
+	_, err = manager.MoveTo(t.Context(), "desk-0", 4000)
+	require.ErrorIs(t, err, idasen.ErrInvalidHeight)
+
+	require.NoError(t, manager.Close())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	require.Equal(t, []idasen.EventType{
+		idasen.EventConnected,
+		idasen.EventMoveStarted,
+		idasen.EventTargetReached,
+		idasen.EventDisconnected,
+	}, events)
+}
+
+func TestManagerRoutesDesksToAdapters(t *testing.T) {
+	t.Parallel()
+
+	defaultDialer := newFakeDialer(nil)
+	hci1 := newFakeDialer(nil)
+	hci2 := newFakeDialer(nil)
+
+	manager := newTestManager(
+		t,
+		defaultDialer,
+		idasen.ManagerOptionsWithAdapter("hci1", hci1.newBTClient),
+		idasen.ManagerOptionsWithAdapter("hci2", hci2.newBTClient),
+		idasen.ManagerOptionsWithDeskAdapter("assigned", "hci1"),
+		idasen.ManagerOptionsWithDeskAdapter("unknown", "hci9"),
+		idasen.ManagerOptionsWithAdapterSelector(func(addr string) (string, bool) {
+			return "hci2", addr == "selected" || addr == "assigned"
+		}),
+	)
+
+	for _, addr := range []string{"assigned", "selected", "other"} {
+		_, err := manager.ReadHeight(addr)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, 1, hci1.dialCount("assigned"), "should prefer the assigned adapter over the selector")
+	require.Equal(t, 1, hci2.dialCount("selected"))
+	require.Equal(t, 1, defaultDialer.dialCount("other"))
+	require.Equal(t, 0, defaultDialer.dialCount("assigned")+defaultDialer.dialCount("selected"))
+
+	_, err := manager.ReadHeight("unknown")
+	require.ErrorIs(t, err, idasen.ErrUnknownAdapter)
+}
+
+func TestManagerMetadata(t *testing.T) {
+	t.Parallel()
+
+	manager := newTestManager(t, newFakeDialer(nil))
+
+	require.NoError(t, manager.Rename(t.Context(), "desk", "Standing desk"))
+	require.NoError(t, manager.WriteMemoryPosition(t.Context(), "desk", 3, 11000))
+
+	metadata, err := manager.ReadMetadata(t.Context(), "desk")
+	require.NoError(t, err)
+	require.Equal(t, idasen.DeskMetadata{Name: "Standing desk", MemoryPositions: []int{7200, 0, 11000}}, metadata)
+
+	require.ErrorIs(t, manager.Rename(t.Context(), "desk", ""), idasen.ErrInvalidName)
+	require.ErrorIs(t, manager.WriteMemoryPosition(t.Context(), "desk", 4, 11000), idasen.ErrInvalidMemorySlot)
+	require.ErrorIs(t, manager.WriteMemoryPosition(t.Context(), "desk", 1, 20000), idasen.ErrInvalidHeight)
+}
+
+func TestManagerMoveGroup(t *testing.T) {
+	t.Parallel()
+
+	t.Run("moves every desk", func(t *testing.T) {
+		t.Parallel()
+
+		dialer := newFakeDialer(nil)
+		manager := newTestManager(t, dialer)
+
+		results := manager.MoveGroup(context.Background(), []idasen.GroupMove{
+			{Addr: "left", Height: 7500},
+			{Addr: "right", Height: 6500},
+		})
+
+		require.Equal(t, []idasen.GroupMoveResult{
+			{Addr: "left", Height: 7500, Err: nil},
+			{Addr: "right", Height: 6500, Err: nil},
+		}, results)
+	})
+
+	t.Run("aborts when a desk stalls", func(t *testing.T) {
+		t.Parallel()
+
+		dialer := newFakeDialer(nil)
+		dialer.step = 1
+		manager := newTestManager(t, dialer)
+
+		_, err := manager.ReadHeight("stuck")
+		require.NoError(t, err)
+
+		stuck := dialer.desk("stuck")
+		stuck.mutex.Lock()
+		stuck.step = 0
+		stuck.mutex.Unlock()
+
+		results := manager.MoveGroup(
+			context.Background(),
+			[]idasen.GroupMove{{Addr: "stuck", Height: 12000}, {Addr: "moving", Height: 12000}},
+			idasen.GroupMoveOptionsWithAbortOnFailure(true),
+			idasen.GroupMoveOptionsWithStallTimeout(20*time.Millisecond),
+		)
+
+		require.ErrorIs(t, results[0].Err, idasen.ErrStalled)
+		require.Equal(t, 7000, results[0].Height)
+		require.ErrorIs(t, results[1].Err, idasen.ErrGroupAborted, "should stop the other desks")
+		require.Less(t, results[1].Height, 12000)
+
+		_, stops := dialer.desk("moving").counts()
+		require.Positive(t, stops)
+	})
+}
@@ -0,0 +1,116 @@
+package idasen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	// GATTDeviceNameCharUUID is the standard characteristic holding the name a device advertises.
+	GATTDeviceNameCharUUID = "2a00"
+	// LinakDPGCharUUID is the characteristic Linak controllers take DPG commands on, such as the memory positions
+	// of the hand controller.
+	LinakDPGCharUUID = "99fa0011338a10248a49009c0215f78a"
+
+	// MaxDeskNameLength is the longest name, in bytes, that still fits in the advertisements of the desk.
+	MaxDeskNameLength = 31
+)
+
+var (
+	ErrMetadataUnsupported = errors.New("desk does not support metadata")
+	ErrInvalidName         = fmt.Errorf("invalid name, it must have 1 to %d bytes", MaxDeskNameLength)
+	ErrInvalidMemorySlot   = errors.New("invalid memory slot")
+)
+
+type (
+	// BTDeskMetadata is implemented by desks exposing the settings of the Linak controller. Memory positions are the
+	// heights stored in the hand controller, slot 1 first, with 0 for empty slots.
+	BTDeskMetadata interface {
+		ReadName() (string, error)
+		WriteName(name string) error
+		ReadMemoryPositions() ([]int, error)
+		WriteMemoryPosition(slot, height int) error
+	}
+	// DeskMetadata is the name a desk advertises and the memory positions of its hand controller.
+	DeskMetadata struct {
+		Name            string
+		MemoryPositions []int
+	}
+)
+
+// ReadMetadata reads the name and memory positions stored in the desk.
+func (m *Manager) ReadMetadata(ctx context.Context, addr string) (DeskMetadata, error) {
+	var metadata DeskMetadata
+
+	err := m.withMetadata(ctx, addr, func(desk BTDeskMetadata) error {
+		var err error
+
+		if metadata.Name, err = desk.ReadName(); err != nil {
+			return fmt.Errorf("reading name: %w", err)
+		}
+
+		if metadata.MemoryPositions, err = desk.ReadMemoryPositions(); err != nil {
+			return fmt.Errorf("reading memory positions: %w", err)
+		}
+
+		return nil
+	})
+
+	return metadata, err
+}
+
+// Rename changes the name the desk advertises.
+func (m *Manager) Rename(ctx context.Context, addr, name string) error {
+	if name == "" || len(name) > MaxDeskNameLength {
+		return ErrInvalidName
+	}
+
+	return m.withMetadata(ctx, addr, func(desk BTDeskMetadata) error {
+		if err := desk.WriteName(name); err != nil {
+			return fmt.Errorf("writing name: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// WriteMemoryPosition stores the height in a memory slot of the hand controller, so the physical button of the slot
+// moves the desk to it.
+func (m *Manager) WriteMemoryPosition(ctx context.Context, addr string, slot, height int) error {
+	if err := ValidateHeight(height); err != nil {
+		return err
+	}
+
+	return m.withMetadata(ctx, addr, func(desk BTDeskMetadata) error {
+		positions, err := desk.ReadMemoryPositions()
+		if err != nil {
+			return fmt.Errorf("reading memory positions: %w", err)
+		}
+
+		if slot < 1 || slot > len(positions) {
+			return fmt.Errorf("%w: %d, the desk has %d", ErrInvalidMemorySlot, slot, len(positions))
+		}
+
+		if err = desk.WriteMemoryPosition(slot, height); err != nil {
+			return fmt.Errorf("writing memory position %d: %w", slot, err)
+		}
+
+		return nil
+	})
+}
+
+func (m *Manager) withMetadata(ctx context.Context, addr string, fn func(BTDeskMetadata) error) error {
+	deskService, release, err := m.acquire(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("desk not found: %w", err)
+	}
+	defer release()
+
+	desk, ok := deskService.client.(BTDeskMetadata)
+	if !ok {
+		return ErrMetadataUnsupported
+	}
+
+	return fn(desk)
+}
@@ -2,23 +2,53 @@ package idasen
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 )
 
-const scannerDefaultTimeout = 10 * time.Second
+const (
+	// LinakControlServiceUUID is the GATT service every Linak desk controller advertises, whatever its name.
+	LinakControlServiceUUID = "99fa0001338a10248a49009c0215f78a"
+
+	scannerDefaultTimeout     = 10 * time.Second
+	scannerDefaultNamePattern = "^Desk"
+	manufacturerIDLength      = 2
+)
 
 type (
+	// Advertisement is what a device advertises. ServiceUUIDs are lowercase hex without dashes, and ManufacturerData
+	// starts with the little endian company identifier of the manufacturer. Adapter is the name of the adapter that
+	// received it, if the scanner has one.
 	Advertisement struct {
-		Name string
-		Addr string
+		Name             string
+		Addr             string
+		RSSI             int
+		Connectable      bool
+		ServiceUUIDs     []string
+		ManufacturerData []byte
+		Adapter          string
+	}
+	// ScanFilter selects the advertisements of desks. An advertisement matches when its name matches Name, it
+	// advertises one of ServiceUUIDs or it comes from one of ManufacturerIDs, so renamed desks are still found.
+	ScanFilter struct {
+		Name            *regexp.Regexp
+		ServiceUUIDs    []string
+		ManufacturerIDs []uint16
 	}
 	ScannerOptions struct {
-		Timeout time.Duration
+		Timeout         time.Duration
+		NamePattern     string
+		ServiceUUIDs    []string
+		ManufacturerIDs []uint16
+		Adapter         string
 	}
 	BTScanner interface {
-		ScanByName(ctx context.Context, name string, timeout time.Duration) ([]Advertisement, error)
+		Scan(ctx context.Context, filter ScanFilter, timeout time.Duration) ([]Advertisement, error)
 	}
 	ScannerOptionsFunc func(*ScannerOptions)
 	Scanner            struct {
@@ -30,7 +60,11 @@ type (
 
 func NewScanner(scanner BTScanner, logger *slog.Logger, opts ...ScannerOptionsFunc) *Scanner {
 	options := &ScannerOptions{
-		Timeout: scannerDefaultTimeout,
+		Timeout:         scannerDefaultTimeout,
+		NamePattern:     scannerDefaultNamePattern,
+		ServiceUUIDs:    []string{LinakControlServiceUUID},
+		ManufacturerIDs: nil,
+		Adapter:         "",
 	}
 
 	for _, opt := range opts {
@@ -47,18 +81,89 @@ func NewScanner(scanner BTScanner, logger *slog.Logger, opts ...ScannerOptionsFu
 func (s *Scanner) ScanDesks(ctx context.Context) ([]Advertisement, error) {
 	s.logger.DebugContext(ctx, "Scanning for desks")
 
-	advs, err := s.scanner.ScanByName(ctx, "^Desk", s.options.Timeout)
+	name, err := regexp.Compile(s.options.NamePattern)
+	if err != nil {
+		return nil, fmt.Errorf("compiling name pattern: %w", err)
+	}
+
+	advs, err := s.scanner.Scan(ctx, ScanFilter{
+		Name:            name,
+		ServiceUUIDs:    s.options.ServiceUUIDs,
+		ManufacturerIDs: s.options.ManufacturerIDs,
+	}, s.options.Timeout)
 	if err != nil {
-		return nil, fmt.Errorf("scanning by name: %w", err)
+		return nil, fmt.Errorf("scanning: %w", err)
+	}
+
+	for i := range advs {
+		advs[i].Adapter = s.options.Adapter
 	}
 
-	s.logger.DebugContext(ctx, "Found desks", slog.Int("count", len(advs)))
+	s.logger.DebugContext(ctx, "Found desks", slog.Int("count", len(advs)), slog.String("adapter", s.options.Adapter))
 
 	return advs, nil
 }
 
+// ManufacturerID returns the company identifier at the start of the manufacturer data, if any.
+func (a Advertisement) ManufacturerID() (uint16, bool) {
+	if len(a.ManufacturerData) < manufacturerIDLength {
+		return 0, false
+	}
+
+	return binary.LittleEndian.Uint16(a.ManufacturerData), true
+}
+
+// Matches reports whether the advertisement is selected by the filter.
+func (f ScanFilter) Matches(adv Advertisement) bool {
+	if f.Name != nil && adv.Name != "" && f.Name.MatchString(adv.Name) {
+		return true
+	}
+
+	for _, service := range adv.ServiceUUIDs {
+		if slices.ContainsFunc(f.ServiceUUIDs, func(uuid string) bool { return normalizeUUID(uuid) == service }) {
+			return true
+		}
+	}
+
+	id, ok := adv.ManufacturerID()
+
+	return ok && slices.Contains(f.ManufacturerIDs, id)
+}
+
+func normalizeUUID(uuid string) string {
+	return strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+}
+
 func ScannerOptionsWithTimeout(timeout time.Duration) ScannerOptionsFunc {
 	return func(o *ScannerOptions) {
 		o.Timeout = timeout
 	}
 }
+
+// ScannerOptionsWithNamePattern sets the regular expression the advertised names of the desks must match.
+func ScannerOptionsWithNamePattern(pattern string) ScannerOptionsFunc {
+	return func(o *ScannerOptions) {
+		o.NamePattern = pattern
+	}
+}
+
+// ScannerOptionsWithServiceUUIDs replaces the services advertised by desks, LinakControlServiceUUID by default.
+func ScannerOptionsWithServiceUUIDs(uuids ...string) ScannerOptionsFunc {
+	return func(o *ScannerOptions) {
+		o.ServiceUUIDs = uuids
+	}
+}
+
+// ScannerOptionsWithManufacturerIDs sets the company identifiers found in the manufacturer data of desks.
+func ScannerOptionsWithManufacturerIDs(ids ...uint16) ScannerOptionsFunc {
+	return func(o *ScannerOptions) {
+		o.ManufacturerIDs = ids
+	}
+}
+
+// ScannerOptionsWithAdapter sets the name of the adapter the scanner listens with.
+func ScannerOptionsWithAdapter(name string) ScannerOptionsFunc {
+	return func(o *ScannerOptions) {
+		o.Adapter = name
+	}
+}
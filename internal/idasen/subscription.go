@@ -0,0 +1,197 @@
+package idasen
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultSubscriptionBufferSize = 16
+
+const (
+	// OverflowDropOldest discards the oldest buffered update to make room for the new one.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowCoalesce keeps only the latest update, replacing any undelivered one.
+	OverflowCoalesce
+	// OverflowDisconnect ends the subscription when its buffer is full.
+	OverflowDisconnect
+)
+
+type (
+	OverflowPolicy      int
+	SubscriptionOption  func(*SubscriptionOptions)
+	SubscriptionOptions struct {
+		bufferSize int
+		policy     OverflowPolicy
+	}
+	// SubscriptionStats reports how well a subscriber keeps up with height updates.
+	SubscriptionStats struct {
+		ID        string        `json:"id"`
+		Pending   int           `json:"pending"`
+		Delivered uint64        `json:"delivered"`
+		Dropped   uint64        `json:"dropped"`
+		Coalesced uint64        `json:"coalesced"`
+		LastLag   time.Duration `json:"last_lag"`
+		MaxLag    time.Duration `json:"max_lag"`
+	}
+	// Subscription buffers height updates for a single subscriber and delivers them from its own goroutine, so a
+	// slow consumer never blocks the desk service.
+	Subscription struct {
+		id        string
+		ch        chan<- int
+		options   SubscriptionOptions
+		mutex     sync.Mutex
+		buffer    []pendingUpdate
+		stats     SubscriptionStats
+		notify    chan struct{}
+		done      chan struct{}
+		closeOnce sync.Once
+	}
+	pendingUpdate struct {
+		height int
+		at     time.Time
+	}
+)
+
+func newSubscription(id string, ch chan<- int, opts ...SubscriptionOption) *Subscription {
+	options := SubscriptionOptions{
+		bufferSize: defaultSubscriptionBufferSize,
+		policy:     OverflowDropOldest,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.policy == OverflowCoalesce {
+		options.bufferSize = 1
+	}
+
+	sub := &Subscription{
+		id:        id,
+		ch:        ch,
+		options:   options,
+		mutex:     sync.Mutex{},
+		buffer:    make([]pendingUpdate, 0, options.bufferSize),
+		stats:     SubscriptionStats{ID: id}, //nolint:exhaustruct // counters start at zero
+		notify:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		closeOnce: sync.Once{},
+	}
+
+	go sub.deliver()
+
+	return sub
+}
+
+// push buffers an update. It returns false when the subscriber must be disconnected.
+func (s *Subscription) push(height int) bool {
+	s.mutex.Lock()
+
+	update := pendingUpdate{height: height, at: time.Now()}
+
+	if len(s.buffer) >= s.options.bufferSize {
+		switch s.options.policy {
+		case OverflowDropOldest:
+			s.buffer = append(s.buffer[:0], s.buffer[1:]...)
+			s.stats.Dropped++
+		case OverflowCoalesce:
+			s.buffer = s.buffer[:0]
+			s.stats.Coalesced++
+		case OverflowDisconnect:
+			s.mutex.Unlock()
+
+			return false
+		}
+	}
+
+	s.buffer = append(s.buffer, update)
+	s.mutex.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// deliver forwards buffered updates to the subscriber channel, which it closes when the subscription ends.
+func (s *Subscription) deliver() {
+	defer close(s.ch)
+
+	for {
+		select {
+		case <-s.notify:
+			for {
+				update, ok := s.pop()
+				if !ok {
+					break
+				}
+
+				select {
+				case s.ch <- update.height:
+					s.delivered(update)
+				case <-s.done:
+					return
+				}
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Subscription) pop() (pendingUpdate, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.buffer) == 0 {
+		return pendingUpdate{}, false
+	}
+
+	update := s.buffer[0]
+	s.buffer = append(s.buffer[:0], s.buffer[1:]...)
+
+	return update, true
+}
+
+func (s *Subscription) delivered(update pendingUpdate) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lag := time.Since(update.at)
+
+	s.stats.Delivered++
+	s.stats.LastLag = lag
+	s.stats.MaxLag = max(s.stats.MaxLag, lag)
+}
+
+func (s *Subscription) Stats() SubscriptionStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := s.stats
+	stats.Pending = len(s.buffer)
+
+	return stats
+}
+
+func (s *Subscription) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// SubscriptionOptionsWithBufferSize sets how many undelivered updates are kept per subscriber.
+func SubscriptionOptionsWithBufferSize(size int) SubscriptionOption {
+	return func(o *SubscriptionOptions) {
+		o.bufferSize = max(size, 1)
+	}
+}
+
+// SubscriptionOptionsWithOverflowPolicy sets what happens to updates when the buffer of a subscriber is full.
+func SubscriptionOptionsWithOverflowPolicy(policy OverflowPolicy) SubscriptionOption {
+	return func(o *SubscriptionOptions) {
+		o.policy = policy
+	}
+}
@@ -0,0 +1,184 @@
+package idasen_test
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/stretchr/testify/require"
+)
+
+const testDeskID = "6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10"
+
+func startDeskService(t *testing.T, desk *fakeDesk) *idasen.DeskService {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	service := idasen.NewDeskService(testDeskID, desk, slog.New(slog.DiscardHandler))
+	require.NoError(t, service.Start(ctx))
+
+	return service
+}
+
+func drain(ch <-chan int) []int {
+	values := []int{}
+
+	for {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return values
+			}
+
+			values = append(values, value)
+		case <-time.After(50 * time.Millisecond):
+			return values
+		}
+	}
+}
+
+func TestSlowSubscriberDoesNotBlockUpdates(t *testing.T) {
+	t.Parallel()
+
+	desk := newFakeDesk(7000)
+	service := startDeskService(t, desk)
+
+	// Never read from this channel
+	service.Subscribe(make(chan int), idasen.SubscriptionOptionsWithBufferSize(2))
+
+	done := make(chan struct{})
+
+	go func() {
+		for height := 7001; height <= 7100; height++ {
+			desk.notify(height)
+		}
+
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("height updates blocked by a slow subscriber")
+	}
+
+	require.Eventually(t, func() bool {
+		height, err := service.ReadHeight()
+
+		return err == nil && height == 7100
+	}, 5*time.Second, 5*time.Millisecond)
+
+	stats := service.SubscriptionStats()
+	require.Len(t, stats, 1)
+	require.Greater(t, stats[0].Dropped, uint64(0))
+	require.LessOrEqual(t, stats[0].Pending, 2, "should never buffer more than its size")
+}
+
+func TestSubscriptionOverflowPolicies(t *testing.T) {
+	t.Parallel()
+
+	t.Run("drop oldest keeps the latest updates", func(t *testing.T) {
+		t.Parallel()
+
+		desk := newFakeDesk(7000)
+		service := startDeskService(t, desk)
+
+		ch := make(chan int)
+		service.Subscribe(ch, idasen.SubscriptionOptionsWithBufferSize(3))
+
+		for height := 7001; height <= 7010; height++ {
+			desk.notify(height)
+		}
+
+		values := drain(ch)
+		require.NotEmpty(t, values)
+		require.Equal(t, 7010, values[len(values)-1])
+		require.LessOrEqual(t, len(values), 4, "should keep at most the buffer and the one in flight")
+	})
+
+	t.Run("coalesce delivers the latest update", func(t *testing.T) {
+		t.Parallel()
+
+		desk := newFakeDesk(7000)
+		service := startDeskService(t, desk)
+
+		ch := make(chan int)
+		service.Subscribe(ch, idasen.SubscriptionOptionsWithOverflowPolicy(idasen.OverflowCoalesce))
+
+		for height := 7001; height <= 7010; height++ {
+			desk.notify(height)
+		}
+
+		values := drain(ch)
+		require.NotEmpty(t, values)
+		require.LessOrEqual(t, len(values), 2)
+		require.Equal(t, 7010, values[len(values)-1])
+	})
+
+	t.Run("disconnect closes the subscriber channel", func(t *testing.T) {
+		t.Parallel()
+
+		desk := newFakeDesk(7000)
+		service := startDeskService(t, desk)
+
+		ch := make(chan int)
+		service.Subscribe(
+			ch,
+			idasen.SubscriptionOptionsWithBufferSize(1),
+			idasen.SubscriptionOptionsWithOverflowPolicy(idasen.OverflowDisconnect),
+		)
+
+		for height := 7001; height <= 7005; height++ {
+			desk.notify(height)
+		}
+
+		require.Eventually(t, func() bool {
+			return len(service.SubscriptionStats()) == 0
+		}, 5*time.Second, 5*time.Millisecond)
+
+		require.Eventually(t, func() bool {
+			select {
+			case _, ok := <-ch:
+				return !ok
+			default:
+				return false
+			}
+		}, 5*time.Second, 5*time.Millisecond)
+	})
+}
+
+func TestConcurrentSubscribeUnsubscribe(t *testing.T) {
+	t.Parallel()
+
+	desk := newFakeDesk(7000)
+	service := startDeskService(t, desk)
+
+	var wg sync.WaitGroup
+
+	for range 20 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range 50 {
+				ch := make(chan int, 1)
+				id := service.Subscribe(ch)
+				service.Unsubscribe(id)
+			}
+		}()
+	}
+
+	for height := 7001; height <= 7200; height++ {
+		desk.notify(height)
+	}
+
+	wg.Wait()
+
+	require.Empty(t, service.SubscriptionStats())
+}
@@ -0,0 +1,206 @@
+package lease
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+)
+
+var (
+	ErrLeaseHeld       = errors.New("desk is leased")
+	ErrNoLease         = errors.New("desk is not leased")
+	ErrInvalidDuration = errors.New("invalid lease duration")
+)
+
+type (
+	// Lease reserves a desk for Holder, the subject of the caller that acquired it, until ExpiresAt.
+	Lease struct {
+		Desk       string    `json:"desk"`
+		Holder     string    `json:"holder"`
+		AcquiredAt time.Time `json:"acquired_at"`
+		ExpiresAt  time.Time `json:"expires_at"`
+	}
+	// Store keeps the leases of the desks in memory. Expired leases are dropped when looked up. A nil *Store holds no
+	// leases, so every move is allowed.
+	Store struct {
+		defaultDuration time.Duration
+		maxDuration     time.Duration
+		now             func() time.Time
+		mutex           sync.Mutex
+		leases          map[string]Lease
+	}
+	StoreOptions struct {
+		now func() time.Time
+	}
+	StoreOption func(*StoreOptions)
+)
+
+func NewStore(cfg config.LeasesConfig, opts ...StoreOption) *Store {
+	options := &StoreOptions{
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &Store{
+		defaultDuration: cfg.DefaultDuration,
+		maxDuration:     cfg.MaxDuration,
+		now:             options.now,
+		mutex:           sync.Mutex{},
+		leases:          map[string]Lease{},
+	}
+}
+
+// Acquire leases the desk to holder for duration, or the default duration when 0. Acquiring a desk already leased
+// to holder renews its lease.
+func (s *Store) Acquire(desk, holder string, duration time.Duration) (Lease, error) {
+	duration, err := s.duration(duration)
+	if err != nil {
+		return Lease{}, err //nolint:exhaustruct // no lease
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+
+	lease, ok := s.active(desk, now)
+	if ok && lease.Holder != holder {
+		return lease, heldError(lease)
+	}
+
+	if !ok {
+		lease = Lease{Desk: desk, Holder: holder, AcquiredAt: now, ExpiresAt: now}
+	}
+
+	lease.ExpiresAt = now.Add(duration)
+	s.leases[desk] = lease
+
+	return lease, nil
+}
+
+// Renew extends the lease of holder on the desk to duration from now, or the default duration when 0.
+func (s *Store) Renew(desk, holder string, duration time.Duration) (Lease, error) {
+	duration, err := s.duration(duration)
+	if err != nil {
+		return Lease{}, err //nolint:exhaustruct // no lease
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+
+	lease, ok := s.active(desk, now)
+
+	switch {
+	case !ok:
+		return lease, ErrNoLease
+	case lease.Holder != holder:
+		return lease, heldError(lease)
+	}
+
+	lease.ExpiresAt = now.Add(duration)
+	s.leases[desk] = lease
+
+	return lease, nil
+}
+
+// Release ends the lease of holder on the desk.
+func (s *Store) Release(desk, holder string) (Lease, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lease, ok := s.active(desk, s.now())
+
+	switch {
+	case !ok:
+		return lease, ErrNoLease
+	case lease.Holder != holder:
+		return lease, heldError(lease)
+	}
+
+	delete(s.leases, desk)
+
+	return lease, nil
+}
+
+// Break ends the lease on the desk, whoever holds it.
+func (s *Store) Break(desk string) (Lease, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lease, ok := s.active(desk, s.now())
+	if !ok {
+		return lease, ErrNoLease
+	}
+
+	delete(s.leases, desk)
+
+	return lease, nil
+}
+
+// Get returns the lease on the desk, if any.
+func (s *Store) Get(desk string) (Lease, bool) {
+	if s == nil {
+		return Lease{}, false //nolint:exhaustruct // no lease
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.active(desk, s.now())
+}
+
+// CheckMove returns an error matching ErrLeaseHeld when the desk is leased to someone else than caller.
+func (s *Store) CheckMove(desk, caller string) error {
+	lease, ok := s.Get(desk)
+	if ok && lease.Holder != caller {
+		return heldError(lease)
+	}
+
+	return nil
+}
+
+func (s *Store) duration(duration time.Duration) (time.Duration, error) {
+	if duration == 0 {
+		return s.defaultDuration, nil
+	}
+
+	if duration < 0 || duration > s.maxDuration {
+		return 0, fmt.Errorf("%w: it must be positive and at most %s", ErrInvalidDuration, s.maxDuration)
+	}
+
+	return duration, nil
+}
+
+// active returns the lease on the desk unless it expired, in which case it is dropped. The mutex must be held.
+func (s *Store) active(desk string, now time.Time) (Lease, bool) {
+	lease, ok := s.leases[desk]
+	if !ok {
+		return Lease{}, false //nolint:exhaustruct // no lease
+	}
+
+	if !now.Before(lease.ExpiresAt) {
+		delete(s.leases, desk)
+
+		return Lease{}, false //nolint:exhaustruct // no lease
+	}
+
+	return lease, true
+}
+
+func heldError(lease Lease) error {
+	return fmt.Errorf("%w by %s until %s", ErrLeaseHeld, lease.Holder, lease.ExpiresAt.Format(time.RFC3339))
+}
+
+func StoreOptionsWithClock(now func() time.Time) StoreOption {
+	return func(o *StoreOptions) {
+		o.now = now
+	}
+}
@@ -0,0 +1,77 @@
+package lease_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/stretchr/testify/require"
+)
+
+const desk = "6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10"
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	store := lease.NewStore(
+		config.LeasesConfig{DefaultDuration: 15 * time.Minute, MaxDuration: time.Hour},
+		lease.StoreOptionsWithClock(func() time.Time { return now }),
+	)
+
+	acquired, err := store.Acquire(desk, "alice", 0)
+	require.NoError(t, err)
+	require.Equal(t, lease.Lease{
+		Desk:       desk,
+		Holder:     "alice",
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(15 * time.Minute),
+	}, acquired, "should use the default duration")
+
+	_, err = store.Acquire(desk, "bob", 0)
+	require.ErrorIs(t, err, lease.ErrLeaseHeld)
+	require.ErrorIs(t, store.CheckMove(desk, "bob"), lease.ErrLeaseHeld)
+	require.NoError(t, store.CheckMove(desk, "alice"), "should let the holder move the desk")
+	require.NoError(t, store.CheckMove("other", "bob"), "should let anyone move desks without lease")
+
+	_, err = store.Renew(desk, "bob", 0)
+	require.ErrorIs(t, err, lease.ErrLeaseHeld)
+	_, err = store.Release(desk, "bob")
+	require.ErrorIs(t, err, lease.ErrLeaseHeld)
+	_, err = store.Renew(desk, "alice", 2*time.Hour)
+	require.ErrorIs(t, err, lease.ErrInvalidDuration)
+
+	now = now.Add(10 * time.Minute)
+
+	renewed, err := store.Renew(desk, "alice", 30*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, acquired.AcquiredAt, renewed.AcquiredAt)
+	require.Equal(t, now.Add(30*time.Minute), renewed.ExpiresAt)
+
+	broken, err := store.Break(desk)
+	require.NoError(t, err)
+	require.Equal(t, renewed, broken)
+
+	_, err = store.Release(desk, "alice")
+	require.ErrorIs(t, err, lease.ErrNoLease)
+
+	_, err = store.Acquire(desk, "bob", time.Minute)
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+
+	_, ok := store.Get(desk)
+	require.False(t, ok, "should drop expired leases")
+	require.NoError(t, store.CheckMove(desk, "alice"))
+}
+
+func TestNilStore(t *testing.T) {
+	t.Parallel()
+
+	var store *lease.Store
+
+	_, ok := store.Get(desk)
+	require.False(t, ok)
+	require.NoError(t, store.CheckMove(desk, "alice"))
+}
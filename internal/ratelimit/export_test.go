@@ -0,0 +1,11 @@
+package ratelimit
+
+import "time"
+
+func (l *Limiter) SetNow(now func() time.Time) {
+	l.now = now
+}
+
+func (c *Cooldown) SetNow(now func() time.Time) {
+	c.now = now
+}
@@ -0,0 +1,249 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+)
+
+const (
+	secondsPerMinute = 60
+	// pruneThreshold is the number of buckets after which idle ones are dropped.
+	pruneThreshold = 1024
+)
+
+var (
+	ErrRateLimited = errors.New("rate limit exceeded")
+	ErrCoolingDown = errors.New("desk is cooling down")
+)
+
+type (
+	// Limiter keeps a token bucket per key.
+	Limiter struct {
+		rate    float64 // tokens per second
+		burst   float64
+		now     func() time.Time
+		mutex   sync.Mutex
+		buckets map[string]*bucket
+	}
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+	// Cooldown enforces a minimum delay after an operation completes on a key.
+	Cooldown struct {
+		duration time.Duration
+		now      func() time.Time
+		mutex    sync.Mutex
+		until    map[string]time.Time
+	}
+	// MoveLimiter combines the per caller and per desk limits applied to move requests. A nil *MoveLimiter allows
+	// everything.
+	MoveLimiter struct {
+		mutex    sync.Mutex // checking and taking the tokens of a request is atomic
+		callers  *Limiter
+		desks    *Limiter
+		cooldown *Cooldown
+	}
+)
+
+func NewLimiter(cfg config.BucketConfig) *Limiter {
+	burst := max(cfg.Burst, 1)
+
+	return &Limiter{
+		rate:    cfg.RequestsPerMinute / secondsPerMinute,
+		burst:   float64(burst),
+		now:     time.Now,
+		mutex:   sync.Mutex{},
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the bucket of key. When none is available it returns how long until one will be.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b := l.bucket(key, l.now())
+	if b.tokens >= 1 {
+		b.tokens--
+
+		return true, 0
+	}
+
+	return false, l.retryAfter(b)
+}
+
+// Check reports whether the bucket of key has a token, like Allow, without taking it.
+func (l *Limiter) Check(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b := l.bucket(key, l.now())
+	if b.tokens >= 1 {
+		return true, 0
+	}
+
+	return false, l.retryAfter(b)
+}
+
+// bucket returns the bucket of key refilled up to now, creating it when missing. The mutex must be held.
+func (l *Limiter) bucket(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= pruneThreshold {
+			l.prune(now)
+		}
+
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	return b
+}
+
+func (l *Limiter) retryAfter(b *bucket) time.Duration {
+	if l.rate <= 0 {
+		// The bucket never refills
+		return time.Hour
+	}
+
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// prune drops the buckets that have refilled completely, as they are equivalent to new ones.
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func NewCooldown(duration time.Duration) *Cooldown {
+	return &Cooldown{
+		duration: duration,
+		now:      time.Now,
+		mutex:    sync.Mutex{},
+		until:    map[string]time.Time{},
+	}
+}
+
+// Remaining returns how long key is still cooling down.
+func (c *Cooldown) Remaining(key string) time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+
+	until, ok := c.until[key]
+	if !ok {
+		return 0
+	}
+
+	if !now.Before(until) {
+		delete(c.until, key)
+
+		return 0
+	}
+
+	return until.Sub(now)
+}
+
+// Start begins the cool-down period of key.
+func (c *Cooldown) Start(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.until[key] = c.now().Add(c.duration)
+}
+
+func NewMoveLimiter(cfg config.RateLimitConfig) *MoveLimiter {
+	limiter := &MoveLimiter{
+		mutex:    sync.Mutex{},
+		callers:  nil,
+		desks:    nil,
+		cooldown: nil,
+	}
+
+	if cfg.Token != nil {
+		limiter.callers = NewLimiter(*cfg.Token)
+	}
+
+	if cfg.Desk != nil {
+		limiter.desks = NewLimiter(*cfg.Desk)
+	}
+
+	if cfg.MoveCooldown > 0 {
+		limiter.cooldown = NewCooldown(cfg.MoveCooldown)
+	}
+
+	return limiter
+}
+
+// Allow checks whether caller may move the desks now, charging the caller a single token for all of them. Every limit
+// of every desk is checked before any token is taken, so a rejected request consumes nothing. On rejection it returns
+// the time to wait before retrying.
+func (m *MoveLimiter) Allow(caller string, desks ...string) (time.Duration, error) {
+	if m == nil {
+		return 0, nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if retryAfter, err := m.check(caller, desks); err != nil {
+		return retryAfter, err
+	}
+
+	if m.desks != nil {
+		for _, desk := range desks {
+			m.desks.Allow(desk)
+		}
+	}
+
+	if m.callers != nil {
+		m.callers.Allow(caller)
+	}
+
+	return 0, nil
+}
+
+// Completed starts the cool-down of desk after a move finished.
+func (m *MoveLimiter) Completed(desk string) {
+	if m == nil || m.cooldown == nil {
+		return
+	}
+
+	m.cooldown.Start(desk)
+}
+
+func (m *MoveLimiter) check(caller string, desks []string) (time.Duration, error) {
+	for _, desk := range desks {
+		if m.cooldown != nil {
+			if remaining := m.cooldown.Remaining(desk); remaining > 0 {
+				return remaining, ErrCoolingDown
+			}
+		}
+
+		if m.desks != nil {
+			if ok, retryAfter := m.desks.Check(desk); !ok {
+				return retryAfter, ErrRateLimited
+			}
+		}
+	}
+
+	if m.callers != nil {
+		if ok, retryAfter := m.callers.Check(caller); !ok {
+			return retryAfter, ErrRateLimited
+		}
+	}
+
+	return 0, nil
+}
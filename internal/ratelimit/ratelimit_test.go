@@ -0,0 +1,127 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	limiter := ratelimit.NewLimiter(config.BucketConfig{RequestsPerMinute: 6, Burst: 2})
+	limiter.SetNow(clock.Now)
+
+	ok, _ := limiter.Allow("alice")
+	require.True(t, ok)
+
+	ok, _ = limiter.Allow("alice")
+	require.True(t, ok)
+
+	ok, retryAfter := limiter.Allow("alice")
+	require.False(t, ok, "should exhaust the burst")
+	require.Equal(t, 10*time.Second, retryAfter)
+
+	ok, _ = limiter.Allow("bob")
+	require.True(t, ok, "should keep a bucket per key")
+
+	clock.now = clock.now.Add(10 * time.Second)
+
+	ok, _ = limiter.Allow("alice")
+	require.True(t, ok, "should refill over time")
+}
+
+func TestCooldown(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	cooldown := ratelimit.NewCooldown(5 * time.Second)
+	cooldown.SetNow(clock.Now)
+
+	require.Zero(t, cooldown.Remaining("desk"))
+
+	cooldown.Start("desk")
+	clock.now = clock.now.Add(2 * time.Second)
+
+	require.Equal(t, 3*time.Second, cooldown.Remaining("desk"))
+
+	clock.now = clock.now.Add(3 * time.Second)
+
+	require.Zero(t, cooldown.Remaining("desk"))
+}
+
+func TestMoveLimiter(t *testing.T) {
+	t.Parallel()
+
+	limiter := ratelimit.NewMoveLimiter(config.RateLimitConfig{
+		Token:        &config.BucketConfig{RequestsPerMinute: 60, Burst: 1},
+		Desk:         nil,
+		MoveCooldown: time.Minute,
+	})
+
+	_, err := limiter.Allow("alice", "desk-1")
+	require.NoError(t, err)
+
+	_, err = limiter.Allow("alice", "desk-2")
+	require.Equal(t, ratelimit.ErrRateLimited, err)
+
+	limiter.Completed("desk-1")
+
+	retryAfter, err := limiter.Allow("bob", "desk-1")
+	require.Equal(t, ratelimit.ErrCoolingDown, err)
+	require.Greater(t, int64(retryAfter), int64(0))
+
+	limiter = ratelimit.NewMoveLimiter(config.RateLimitConfig{
+		Token:        &config.BucketConfig{RequestsPerMinute: 60, Burst: 1},
+		Desk:         &config.BucketConfig{RequestsPerMinute: 60, Burst: 2},
+		MoveCooldown: 0,
+	})
+
+	_, err = limiter.Allow("alice", "desk-1")
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err = limiter.Allow("alice", "desk-1")
+		require.Equal(t, ratelimit.ErrRateLimited, err)
+	}
+
+	_, err = limiter.Allow("bob", "desk-1")
+	require.NoError(t, err, "rejected requests should not drain the desk bucket")
+
+	limiter = ratelimit.NewMoveLimiter(config.RateLimitConfig{
+		Token:        &config.BucketConfig{RequestsPerMinute: 60, Burst: 1},
+		Desk:         &config.BucketConfig{RequestsPerMinute: 60, Burst: 1},
+		MoveCooldown: time.Minute,
+	})
+
+	_, err = limiter.Allow("alice", "desk-1", "desk-2")
+	require.NoError(t, err, "should charge the caller a single token for several desks")
+
+	limiter.Completed("desk-2")
+
+	_, err = limiter.Allow("bob", "desk-3", "desk-2")
+	require.Equal(t, ratelimit.ErrCoolingDown, err)
+
+	_, err = limiter.Allow("bob", "desk-3")
+	require.NoError(t, err, "rejected requests should not drain the buckets of the other desks")
+
+	var disabled *ratelimit.MoveLimiter
+
+	_, err = disabled.Allow("alice", "desk-1")
+	require.NoError(t, err)
+	disabled.Completed("desk-1")
+}
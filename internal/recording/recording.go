@@ -0,0 +1,381 @@
+package recording
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+)
+
+const (
+	OpRead        Op = "read"
+	OpWrite       Op = "write"
+	OpNotify      Op = "notify"
+	OpSubscribe   Op = "subscribe"
+	OpUnsubscribe Op = "unsubscribe"
+	OpClose       Op = "close"
+
+	CommandUp   = "up"
+	CommandDown = "down"
+	CommandStop = "stop"
+
+	fileMode      = 0o600
+	fileTimestamp = "20060102T150405.000Z0700"
+)
+
+var (
+	_ idasen.BTDesk         = (*Recorder)(nil)
+	_ idasen.BTDeskMetadata = (*Recorder)(nil)
+)
+
+type (
+	// Op is the kind of GATT operation of an entry.
+	Op string
+	// Entry is a GATT operation on a desk. Operations are ordered by Seq, given when they start, as an operation may
+	// be written after notifications received while it ran. Reads and notifications carry the height of the desk,
+	// and writes the command written to the control characteristic. Name, Slot and Positions are the values read or
+	// written on the metadata characteristics. Error is the error the operation failed with.
+	Entry struct {
+		Seq            uint64    `json:"seq"`
+		Time           time.Time `json:"time"`
+		Op             Op        `json:"op"`
+		Characteristic string    `json:"characteristic,omitempty"`
+		Height         int       `json:"height,omitempty"`
+		Command        string    `json:"command,omitempty"`
+		Name           string    `json:"name,omitempty"`
+		Slot           int       `json:"slot,omitempty"`
+		Positions      []int     `json:"positions,omitempty"`
+		Error          string    `json:"error,omitempty"`
+	}
+	RecorderOptions struct {
+		now func() time.Time
+	}
+	RecorderOption func(*RecorderOptions)
+	// Recorder is a BTDesk that writes every operation on the desk it wraps to w, one JSON entry per line, so it can
+	// be attached to bug reports and replayed with a Replayer. It supports metadata when the wrapped desk does.
+	Recorder struct {
+		desk    idasen.BTDesk
+		options *RecorderOptions
+		logger  *slog.Logger
+		seq     atomic.Uint64
+		mutex   sync.Mutex
+		encoder *json.Encoder
+		writer  io.Writer
+		stopped bool
+		done    chan struct{}
+		close   sync.Once
+	}
+)
+
+func NewRecorder(desk idasen.BTDesk, w io.Writer, logger *slog.Logger, opts ...RecorderOption) *Recorder {
+	options := &RecorderOptions{
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &Recorder{
+		desk:    desk,
+		options: options,
+		logger:  logger.With(slog.String("component", "recording")),
+		seq:     atomic.Uint64{},
+		mutex:   sync.Mutex{},
+		encoder: json.NewEncoder(w),
+		writer:  w,
+		stopped: false,
+		done:    make(chan struct{}),
+		close:   sync.Once{},
+	}
+}
+
+// NewBTClientFunc wraps newBTClient so every connection is recorded to its own file in dir, named after the address
+// of the desk and the time of the connection. Desks are still connected to when their recording cannot be created.
+func NewBTClientFunc(newBTClient idasen.NewBTClient, dir string, logger *slog.Logger) idasen.NewBTClient {
+	return func(ctx context.Context, addr string) (idasen.BTDesk, error) {
+		desk, err := newBTClient(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		name := fmt.Sprintf(
+			"%s-%s.jsonl",
+			strings.ReplaceAll(addr, ":", ""),
+			time.Now().UTC().Format(fileTimestamp),
+		)
+
+		file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileMode)
+		if err != nil {
+			logger.ErrorContext(
+				ctx,
+				"Error creating recording, desk not recorded",
+				slog.String("address", addr),
+				slog.String("error", err.Error()),
+			)
+
+			return desk, nil
+		}
+
+		logger.InfoContext(ctx, "Recording desk", slog.String("address", addr), slog.String("file", file.Name()))
+
+		return NewRecorder(desk, file, logger), nil
+	}
+}
+
+// Load reads a recording written by a Recorder, in sequence order.
+func Load(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("decoding entry at line %d: %w", line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading recording: %w", err)
+	}
+
+	slices.SortStableFunc(entries, func(a, b Entry) int { return cmp.Compare(a.Seq, b.Seq) })
+
+	return entries, nil
+}
+
+// LoadFile reads a recording file written by a Recorder.
+func LoadFile(file string) ([]Entry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening recording: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read only
+
+	return Load(f)
+}
+
+func (r *Recorder) ReadHeight() (int, error) {
+	entry := r.start(OpRead, idasen.LinakHeightCharUUID)
+
+	height, err := r.desk.ReadHeight()
+	entry.Height = height
+	r.record(entry, err)
+
+	return height, err //nolint:wrapcheck // errors of the wrapped desk are returned as is
+}
+
+func (r *Recorder) MoveUp() error {
+	return r.write(CommandUp, r.desk.MoveUp)
+}
+
+func (r *Recorder) MoveDown() error {
+	return r.write(CommandDown, r.desk.MoveDown)
+}
+
+func (r *Recorder) Stop() error {
+	return r.write(CommandStop, r.desk.Stop)
+}
+
+// Subscribe records the notifications on their way to ch. A notification received while another operation runs is
+// sequenced after it, so a replay delivers it after that operation.
+func (r *Recorder) Subscribe(ch chan<- int) error {
+	// Not closed, the BLE stack may still deliver a notification after unsubscribing
+	notifications := make(chan int)
+
+	go func() {
+		for {
+			select {
+			case height := <-notifications:
+				entry := r.start(OpNotify, idasen.LinakHeightCharUUID)
+				entry.Height = height
+				r.record(entry, nil)
+
+				select {
+				case ch <- height:
+				case <-r.done:
+					return
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+
+	entry := r.start(OpSubscribe, idasen.LinakHeightCharUUID)
+
+	err := r.desk.Subscribe(notifications)
+	r.record(entry, err)
+
+	return err //nolint:wrapcheck // errors of the wrapped desk are returned as is
+}
+
+func (r *Recorder) Unsubscribe() error {
+	entry := r.start(OpUnsubscribe, idasen.LinakHeightCharUUID)
+
+	err := r.desk.Unsubscribe()
+	r.record(entry, err)
+
+	return err //nolint:wrapcheck // errors of the wrapped desk are returned as is
+}
+
+// Close closes the desk and stops recording. The writer is closed as well when it is an io.Closer.
+func (r *Recorder) Close() error {
+	entry := r.start(OpClose, "")
+
+	err := r.desk.Close()
+	r.record(entry, err)
+
+	r.close.Do(func() {
+		close(r.done)
+
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		// Nothing is recorded after closing, such as notifications delivered late
+		r.stopped = true
+
+		if closer, ok := r.writer.(io.Closer); ok {
+			if closeErr := closer.Close(); closeErr != nil {
+				r.logger.Error("Error closing recording", slog.String("error", closeErr.Error()))
+			}
+		}
+	})
+
+	return err //nolint:wrapcheck // errors of the wrapped desk are returned as is
+}
+
+func (r *Recorder) ReadName() (string, error) {
+	entry := r.start(OpRead, idasen.GATTDeviceNameCharUUID)
+
+	desk, err := r.metadata()
+	if err == nil {
+		entry.Name, err = desk.ReadName()
+	}
+
+	r.record(entry, err)
+
+	return entry.Name, err
+}
+
+func (r *Recorder) WriteName(name string) error {
+	entry := r.start(OpWrite, idasen.GATTDeviceNameCharUUID)
+	entry.Name = name
+
+	desk, err := r.metadata()
+	if err == nil {
+		err = desk.WriteName(name)
+	}
+
+	r.record(entry, err)
+
+	return err
+}
+
+func (r *Recorder) ReadMemoryPositions() ([]int, error) {
+	entry := r.start(OpRead, idasen.LinakDPGCharUUID)
+
+	desk, err := r.metadata()
+	if err == nil {
+		entry.Positions, err = desk.ReadMemoryPositions()
+	}
+
+	r.record(entry, err)
+
+	return entry.Positions, err
+}
+
+func (r *Recorder) WriteMemoryPosition(slot, height int) error {
+	entry := r.start(OpWrite, idasen.LinakDPGCharUUID)
+	entry.Slot = slot
+	entry.Height = height
+
+	desk, err := r.metadata()
+	if err == nil {
+		err = desk.WriteMemoryPosition(slot, height)
+	}
+
+	r.record(entry, err)
+
+	return err
+}
+
+func (r *Recorder) metadata() (idasen.BTDeskMetadata, error) { //nolint:ireturn // the wrapped desk
+	desk, ok := r.desk.(idasen.BTDeskMetadata)
+	if !ok {
+		return nil, idasen.ErrMetadataUnsupported
+	}
+
+	return desk, nil
+}
+
+func (r *Recorder) write(command string, operation func() error) error {
+	entry := r.start(OpWrite, idasen.LinakControlCharUUID)
+	entry.Command = command
+
+	err := operation()
+	r.record(entry, err)
+
+	return err
+}
+
+// start returns the entry of an operation starting now.
+func (r *Recorder) start(op Op, characteristic string) Entry {
+	return Entry{
+		Seq:            r.seq.Add(1),
+		Time:           r.options.now(),
+		Op:             op,
+		Characteristic: characteristic,
+		Height:         0,
+		Command:        "",
+		Name:           "",
+		Slot:           0,
+		Positions:      nil,
+		Error:          "",
+	}
+}
+
+// record writes the entry. Write errors are logged once and never reach the desk service.
+func (r *Recorder) record(entry Entry, err error) {
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.stopped {
+		return
+	}
+
+	if encodeErr := r.encoder.Encode(entry); encodeErr != nil {
+		r.stopped = true
+
+		r.logger.Error("Error recording, recording stopped", slog.String("error", encodeErr.Error()))
+	}
+}
+
+// RecorderOptionsWithClock sets the function used to timestamp the entries.
+func RecorderOptionsWithClock(now func() time.Time) RecorderOption {
+	return func(o *RecorderOptions) {
+		o.now = now
+	}
+}
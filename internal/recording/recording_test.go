@@ -0,0 +1,200 @@
+package recording_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/recording"
+	"github.com/stretchr/testify/require"
+)
+
+var errStubRead = errors.New("read failed")
+
+// stubDesk moves 100 per move command and notifies the new height right away, like a desk close to its target.
+type stubDesk struct {
+	mutex    sync.Mutex
+	height   int
+	updateCh chan<- int
+	failRead bool
+}
+
+func (s *stubDesk) ReadHeight() (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.failRead {
+		return 0, errStubRead
+	}
+
+	return s.height, nil
+}
+
+func (s *stubDesk) MoveUp() error   { return s.move(100) }
+func (s *stubDesk) MoveDown() error { return s.move(-100) }
+func (s *stubDesk) Stop() error     { return nil }
+func (s *stubDesk) Close() error    { return nil }
+
+func (s *stubDesk) Subscribe(ch chan<- int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.updateCh = ch
+
+	return nil
+}
+
+func (s *stubDesk) Unsubscribe() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.updateCh = nil
+
+	return nil
+}
+
+func (s *stubDesk) move(step int) error {
+	s.mutex.Lock()
+	s.height += step
+	height, ch := s.height, s.updateCh
+	s.mutex.Unlock()
+
+	if ch != nil {
+		ch <- height
+	}
+
+	return nil
+}
+
+// moveDesk runs a desk service on the desk, moves it to 7100 and stops the service.
+func moveDesk(t *testing.T, desk idasen.BTDesk) []int {
+	t.Helper()
+
+	var (
+		mutex   sync.Mutex
+		heights []int
+	)
+
+	service := idasen.NewDeskService(
+		"desk",
+		desk,
+		slog.New(slog.DiscardHandler),
+		idasen.DeskServiceOptionsWithPollInterval(20*time.Millisecond),
+		idasen.DeskServiceOptionsWithHeightObserver(func(_ string, height int) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			heights = append(heights, height)
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	require.NoError(t, service.Start(ctx))
+
+	resultCh := make(chan error, 1)
+	service.MoveTo(t.Context(), resultCh, 7100)
+	require.NoError(t, <-resultCh)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, err := service.ReadHeight()
+
+		return errors.Is(err, idasen.ErrNotRunning)
+	}, time.Second, time.Millisecond)
+	require.NoError(t, service.Close())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return heights
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	recorder := recording.NewRecorder(
+		&stubDesk{mutex: sync.Mutex{}, height: 7000, updateCh: nil, failRead: false},
+		&buf,
+		slog.New(slog.DiscardHandler),
+		recording.RecorderOptionsWithClock(func() time.Time { return now }),
+	)
+
+	recorded := moveDesk(t, recorder)
+	require.Equal(t, []int{7000, 7100}, recorded)
+
+	entries, err := recording.Load(&buf)
+	require.NoError(t, err)
+
+	type step struct {
+		Op      recording.Op
+		Height  int
+		Command string
+	}
+
+	steps := make([]step, 0, len(entries))
+	for _, entry := range entries {
+		steps = append(steps, step{Op: entry.Op, Height: entry.Height, Command: entry.Command})
+	}
+
+	require.Equal(t, []step{
+		{Op: recording.OpRead, Height: 7000, Command: ""},
+		{Op: recording.OpSubscribe, Height: 0, Command: ""},
+		{Op: recording.OpWrite, Height: 0, Command: recording.CommandUp},
+		{Op: recording.OpNotify, Height: 7100, Command: ""},
+		{Op: recording.OpWrite, Height: 0, Command: recording.CommandStop},
+		{Op: recording.OpUnsubscribe, Height: 0, Command: ""},
+		{Op: recording.OpClose, Height: 0, Command: ""},
+	}, steps)
+	require.Equal(t, idasen.LinakControlCharUUID, entries[2].Characteristic)
+	require.Equal(t, now, entries[0].Time)
+
+	replayer := recording.NewReplayer(entries)
+
+	require.Equal(t, recorded, moveDesk(t, replayer), "should replay the heights of the recording")
+	require.NoError(t, replayer.Err())
+	require.Zero(t, replayer.Remaining())
+}
+
+func TestReplayer(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	recorder := recording.NewRecorder(
+		&stubDesk{mutex: sync.Mutex{}, height: 7000, updateCh: nil, failRead: true},
+		&buf,
+		slog.New(slog.DiscardHandler),
+	)
+
+	_, err := recorder.ReadHeight()
+	require.ErrorIs(t, err, errStubRead)
+	require.NoError(t, recorder.MoveUp())
+	require.NoError(t, recorder.Close())
+
+	entries, err := recording.Load(&buf)
+	require.NoError(t, err)
+
+	replayer := recording.NewReplayer(entries)
+
+	_, err = replayer.ReadHeight()
+	require.ErrorIs(t, err, recording.ErrRecordedError, "should replay recorded errors")
+	require.ErrorContains(t, err, errStubRead.Error())
+
+	err = replayer.MoveDown()
+	require.ErrorIs(t, err, recording.ErrUnexpectedCall)
+	require.ErrorContains(t, err, "got write "+idasen.LinakControlCharUUID+" down")
+
+	require.NoError(t, replayer.MoveUp())
+	require.NoError(t, replayer.Close())
+	require.ErrorIs(t, replayer.Close(), recording.ErrUnexpectedCall, "should fail after the end of the recording")
+	require.ErrorIs(t, replayer.Err(), recording.ErrUnexpectedCall)
+	require.Zero(t, replayer.Remaining())
+}
@@ -0,0 +1,289 @@
+package recording
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+)
+
+var (
+	ErrUnexpectedCall = errors.New("unexpected call")
+	ErrRecordedError  = errors.New("recorded error")
+
+	_ idasen.BTDesk         = (*Replayer)(nil)
+	_ idasen.BTDeskMetadata = (*Replayer)(nil)
+)
+
+type (
+	// Replayer is a BTDesk that plays a recording back. Every call must match the next operation of the recording, and
+	// returns its recorded height or error. Notifications are delivered in order, once the operations recorded before
+	// them have been replayed, so a replay does not depend on the timing of the recording.
+	Replayer struct {
+		calls         []Entry
+		notifications []notification
+		mutex         sync.Mutex
+		replayed      int
+		delivered     int
+		advanced      chan struct{} // closed and replaced whenever an operation is replayed
+		updateCh      chan<- int
+		err           error
+		done          chan struct{}
+		close         sync.Once
+	}
+	// call is an operation made on the replayer, with the values it writes.
+	call struct {
+		op             Op
+		characteristic string
+		command        string
+		name           string
+		slot           int
+		height         int
+	}
+	// notification is a recorded notification, delivered once after operations have been replayed.
+	notification struct {
+		entry Entry
+		after int
+	}
+)
+
+func NewReplayer(entries []Entry) *Replayer {
+	var (
+		calls         []Entry
+		notifications []notification
+	)
+
+	for _, entry := range entries {
+		if entry.Op == OpNotify {
+			notifications = append(notifications, notification{entry: entry, after: len(calls)})
+		} else {
+			calls = append(calls, entry)
+		}
+	}
+
+	return &Replayer{
+		calls:         calls,
+		notifications: notifications,
+		mutex:         sync.Mutex{},
+		replayed:      0,
+		delivered:     0,
+		advanced:      make(chan struct{}),
+		updateCh:      nil,
+		err:           nil,
+		done:          make(chan struct{}),
+		close:         sync.Once{},
+	}
+}
+
+func (r *Replayer) ReadHeight() (int, error) {
+	entry, err := r.replay(newCall(OpRead, idasen.LinakHeightCharUUID))
+	if err != nil {
+		return 0, err
+	}
+
+	return entry.Height, nil
+}
+
+func (r *Replayer) MoveUp() error {
+	return r.write(CommandUp)
+}
+
+func (r *Replayer) MoveDown() error {
+	return r.write(CommandDown)
+}
+
+func (r *Replayer) Stop() error {
+	return r.write(CommandStop)
+}
+
+func (r *Replayer) Subscribe(ch chan<- int) error {
+	if _, err := r.replay(newCall(OpSubscribe, idasen.LinakHeightCharUUID)); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	subscribed := r.updateCh != nil
+	r.updateCh = ch
+	r.mutex.Unlock()
+
+	if !subscribed {
+		go r.deliver()
+	}
+
+	return nil
+}
+
+func (r *Replayer) Unsubscribe() error {
+	_, err := r.replay(newCall(OpUnsubscribe, idasen.LinakHeightCharUUID))
+
+	return err
+}
+
+// Close replays the closing of the desk and stops delivering notifications.
+func (r *Replayer) Close() error {
+	_, err := r.replay(newCall(OpClose, ""))
+
+	r.close.Do(func() { close(r.done) })
+
+	return err
+}
+
+func (r *Replayer) ReadName() (string, error) {
+	entry, err := r.replay(newCall(OpRead, idasen.GATTDeviceNameCharUUID))
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Name, nil
+}
+
+func (r *Replayer) WriteName(name string) error {
+	call := newCall(OpWrite, idasen.GATTDeviceNameCharUUID)
+	call.name = name
+
+	_, err := r.replay(call)
+
+	return err
+}
+
+func (r *Replayer) ReadMemoryPositions() ([]int, error) {
+	entry, err := r.replay(newCall(OpRead, idasen.LinakDPGCharUUID))
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.Positions, nil
+}
+
+func (r *Replayer) WriteMemoryPosition(slot, height int) error {
+	call := newCall(OpWrite, idasen.LinakDPGCharUUID)
+	call.slot = slot
+	call.height = height
+
+	_, err := r.replay(call)
+
+	return err
+}
+
+// Err returns the first call that did not match the recording, if any.
+func (r *Replayer) Err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.err
+}
+
+// Remaining returns the number of operations and notifications not replayed yet.
+func (r *Replayer) Remaining() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return len(r.calls) - r.replayed + len(r.notifications) - r.delivered
+}
+
+func (r *Replayer) write(command string) error {
+	call := newCall(OpWrite, idasen.LinakControlCharUUID)
+	call.command = command
+
+	_, err := r.replay(call)
+
+	return err
+}
+
+// replay returns the next operation of the recording if it matches the call. Writes must write the recorded values.
+func (r *Replayer) replay(c call) (Entry, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var err error
+
+	switch {
+	case r.replayed >= len(r.calls):
+		err = fmt.Errorf("%w: %s after the end of the recording", ErrUnexpectedCall, c)
+	case callOf(r.calls[r.replayed]) != c:
+		err = fmt.Errorf("%w: expected %s, got %s", ErrUnexpectedCall, callOf(r.calls[r.replayed]), c)
+	}
+
+	if err != nil {
+		if r.err == nil {
+			r.err = err
+		}
+
+		return Entry{}, err //nolint:exhaustruct // no entry
+	}
+
+	entry := r.calls[r.replayed]
+
+	r.replayed++
+	close(r.advanced)
+	r.advanced = make(chan struct{})
+
+	if entry.Error != "" {
+		return entry, fmt.Errorf("%w: %s", ErrRecordedError, entry.Error)
+	}
+
+	return entry, nil
+}
+
+// deliver sends the notifications to the subscriber, each once the operations recorded before it were replayed.
+func (r *Replayer) deliver() {
+	for _, n := range r.notifications {
+		for {
+			r.mutex.Lock()
+			ready, advanced, ch := r.replayed >= n.after, r.advanced, r.updateCh
+			r.mutex.Unlock()
+
+			if ready {
+				select {
+				case ch <- n.entry.Height:
+				case <-r.done:
+					return
+				}
+
+				break
+			}
+
+			select {
+			case <-advanced:
+			case <-r.done:
+				return
+			}
+		}
+
+		r.mutex.Lock()
+		r.delivered++
+		r.mutex.Unlock()
+	}
+}
+
+func newCall(op Op, characteristic string) call {
+	return call{op: op, characteristic: characteristic, command: "", name: "", slot: 0, height: 0}
+}
+
+// callOf returns the call of a recorded operation, leaving out the values read.
+func callOf(entry Entry) call {
+	c := newCall(entry.Op, entry.Characteristic)
+
+	if entry.Op == OpWrite {
+		c.command, c.name, c.slot, c.height = entry.Command, entry.Name, entry.Slot, entry.Height
+	}
+
+	return c
+}
+
+func (c call) String() string {
+	s := fmt.Sprintf("%s %s", c.op, c.characteristic)
+
+	switch {
+	case c.command != "":
+		s += " " + c.command
+	case c.name != "":
+		s += fmt.Sprintf(" %q", c.name)
+	case c.slot != 0:
+		s += fmt.Sprintf(" slot %d height %d", c.slot, c.height)
+	}
+
+	return strings.TrimSpace(s)
+}
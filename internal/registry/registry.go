@@ -0,0 +1,250 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+)
+
+const filePermissions = 0o600
+
+var (
+	ErrInvalidDesk        = errors.New("invalid desk")
+	ErrAlreadyAdopted     = errors.New("desk is already adopted")
+	ErrVerificationFailed = errors.New("desk verification failed")
+)
+
+type (
+	// Desk is a desk adopted through the API. Name is the name it advertised when it was adopted, and Alias the one
+	// given by whoever adopted it.
+	Desk struct {
+		ID        string    `json:"id"`
+		Alias     string    `json:"alias,omitempty"`
+		Owner     string    `json:"owner,omitempty"`
+		Name      string    `json:"name,omitempty"`
+		AdoptedAt time.Time `json:"adopted_at"`
+		AdoptedBy string    `json:"adopted_by,omitempty"`
+	}
+	// Verifier connects to a desk, which fails when the desk lacks the Linak control or height characteristics.
+	Verifier interface {
+		ReadHeight(addr string) (int, error)
+	}
+	RegistryOptions struct {
+		now func() time.Time
+	}
+	RegistryOption func(*RegistryOptions)
+	// Registry keeps the desks adopted through the API in a file, next to the ones in the config file. Adopted
+	// desks can be used right away, as DesksConfig returns them with the configured ones.
+	Registry struct {
+		file       string
+		configured config.DesksConfig
+		verifier   Verifier
+		options    *RegistryOptions
+		logger     *slog.Logger
+		mutex      sync.Mutex
+		desks      []Desk
+	}
+	state struct {
+		Desks []Desk `json:"desks"`
+	}
+)
+
+func NewRegistry(
+	cfg config.RegistryConfig,
+	configured config.DesksConfig,
+	verifier Verifier,
+	logger *slog.Logger,
+	opts ...RegistryOption,
+) (*Registry, error) {
+	options := &RegistryOptions{
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	desks, err := load(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Registry{
+		file:       cfg.File,
+		configured: configured,
+		verifier:   verifier,
+		options:    options,
+		logger:     logger.With(slog.String("component", "registry")),
+		mutex:      sync.Mutex{},
+		desks:      desks,
+	}, nil
+}
+
+// Desks returns the adopted desks, in adoption order.
+func (r *Registry) Desks() []Desk {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return slices.Clone(r.desks)
+}
+
+// Devices returns the adopted desks as desk settings, named after their alias or their advertised name.
+func (r *Registry) Devices() []config.DeskConfig {
+	desks := r.Desks()
+	devices := make([]config.DeskConfig, 0, len(desks))
+
+	for _, desk := range desks {
+		name := desk.Alias
+		if name == "" {
+			name = desk.Name
+		}
+
+		devices = append(devices, config.DeskConfig{
+			ID:             desk.ID,
+			Name:           name,
+			IdleTimeout:    nil,
+			StandThreshold: 0,
+			SittingGoal:    0,
+			Presets:        nil,
+			Adapter:        "",
+		})
+	}
+
+	return devices
+}
+
+// DesksConfig returns the desk settings of the config file with the adopted desks added to its devices.
+func (r *Registry) DesksConfig() config.DesksConfig {
+	desks := r.configured
+	desks.Devices = slices.Concat(r.configured.Devices, r.Devices())
+
+	return desks
+}
+
+// Adopt checks that the desk is a Linak desk by connecting to it and saves it.
+func (r *Registry) Adopt(ctx context.Context, desk Desk) (Desk, error) {
+	if desk.ID == "" {
+		return desk, fmt.Errorf("%w: missing id", ErrInvalidDesk)
+	}
+
+	if err := idasen.ValidateAddress(desk.ID); err != nil {
+		return desk, fmt.Errorf("%w: %w", ErrInvalidDesk, err)
+	}
+
+	if r.isAdopted(desk.ID) {
+		return desk, fmt.Errorf("%w: %s", ErrAlreadyAdopted, desk.ID)
+	}
+
+	if _, err := r.verifier.ReadHeight(desk.ID); err != nil {
+		return desk, fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+	}
+
+	desk.AdoptedAt = r.options.now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Another request may have adopted the desk while this one was connecting to it
+	if r.isAdoptedLocked(desk.ID) {
+		return desk, fmt.Errorf("%w: %s", ErrAlreadyAdopted, desk.ID)
+	}
+
+	desks := append(slices.Clone(r.desks), desk)
+
+	if err := save(r.file, desks); err != nil {
+		return desk, err
+	}
+
+	r.desks = desks
+
+	r.logger.InfoContext(ctx, "Desk adopted", slog.String("desk", desk.ID))
+
+	return desk, nil
+}
+
+func (r *Registry) isAdopted(id string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.isAdoptedLocked(id)
+}
+
+func (r *Registry) isAdoptedLocked(id string) bool {
+	if _, ok := r.configured.Device(id); ok {
+		return true
+	}
+
+	return slices.ContainsFunc(r.desks, func(desk Desk) bool { return desk.ID == id })
+}
+
+func load(file string) ([]Desk, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Desk{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("reading registry: %w", err)
+	}
+
+	var loaded state
+	if err = json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("decoding registry: %w", err)
+	}
+
+	if loaded.Desks == nil {
+		loaded.Desks = []Desk{}
+	}
+
+	return loaded.Desks, nil
+}
+
+// save writes the desks to a temporary file first, so a crash never leaves a truncated file behind.
+func save(file string, desks []Desk) error {
+	data, err := json.MarshalIndent(state{Desks: desks}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding registry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating registry file: %w", err)
+	}
+
+	defer os.Remove(tmp.Name()) //nolint:errcheck // already renamed on success
+
+	if err = tmp.Chmod(filePermissions); err == nil {
+		_, err = tmp.Write(data)
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("writing registry: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("replacing registry file: %w", err)
+	}
+
+	return nil
+}
+
+// RegistryOptionsWithClock sets the function used to get the current time.
+func RegistryOptionsWithClock(now func() time.Time) RegistryOption {
+	return func(o *RegistryOptions) {
+		o.now = now
+	}
+}
@@ -0,0 +1,145 @@
+package registry_test
+
+import (
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/registry"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	officeDesk = "6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10"
+	newDesk    = "0b9c7c1e-3c4f-4d8a-9a55-7a1f0e2d3c4b"
+	linuxDesk  = "E8:5B:5B:24:3A:11"
+	headphones = "AC:80:0A:4F:21:9D"
+)
+
+var errNotADesk = errors.New("control characteristic not found")
+
+// fakeVerifier accepts every desk but the ones in invalid.
+type fakeVerifier struct {
+	invalid map[string]bool
+}
+
+func (f *fakeVerifier) ReadHeight(addr string) (int, error) {
+	if f.invalid[addr] {
+		return 0, errNotADesk
+	}
+
+	return 7000, nil
+}
+
+func newTestRegistry(t *testing.T, file string, opts ...registry.RegistryOption) *registry.Registry {
+	t.Helper()
+
+	reg, err := registry.NewRegistry(
+		config.RegistryConfig{File: file},
+		config.DesksConfig{
+			IdleTimeout:    0,
+			StandThreshold: config.DefaultStandThreshold,
+			Presets:        nil,
+			Devices: []config.DeskConfig{
+				{ID: officeDesk, Name: "office", IdleTimeout: nil, StandThreshold: 0, SittingGoal: 0, Presets: nil, Adapter: ""},
+			},
+			Groups: nil,
+		},
+		&fakeVerifier{invalid: map[string]bool{headphones: true}},
+		slog.New(slog.DiscardHandler),
+		opts...,
+	)
+	require.NoError(t, err)
+
+	return reg
+}
+
+func newRequest(id string) registry.Desk {
+	return registry.Desk{
+		ID:        id,
+		Alias:     "standing",
+		Owner:     "alice",
+		Name:      "Desk 5678",
+		AdoptedAt: time.Time{},
+		AdoptedBy: "admin",
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	clock := registry.RegistryOptionsWithClock(func() time.Time { return now })
+
+	t.Run("adopts desks and keeps them across restarts", func(t *testing.T) {
+		t.Parallel()
+
+		file := filepath.Join(t.TempDir(), "desks.json")
+		reg := newTestRegistry(t, file, clock)
+
+		adopted, err := reg.Adopt(t.Context(), newRequest(newDesk))
+		require.NoError(t, err)
+		require.Equal(t, now, adopted.AdoptedAt)
+
+		_, configured := reg.DesksConfig().Device(newDesk)
+		require.True(t, configured, "should configure adopted desks right away")
+		_, configured = reg.DesksConfig().Device(officeDesk)
+		require.True(t, configured, "should keep the desks of the config file")
+
+		restarted := newTestRegistry(t, file)
+		require.Equal(t, []registry.Desk{adopted}, restarted.Desks())
+		require.Equal(t, []config.DeskConfig{
+			{ID: newDesk, Name: "standing", IdleTimeout: nil, StandThreshold: 0, SittingGoal: 0, Presets: nil, Adapter: ""},
+		}, restarted.Devices())
+
+		_, err = restarted.Adopt(t.Context(), newRequest(newDesk))
+		require.ErrorIs(t, err, registry.ErrAlreadyAdopted)
+	})
+
+	t.Run("rejects configured desks", func(t *testing.T) {
+		t.Parallel()
+
+		reg := newTestRegistry(t, filepath.Join(t.TempDir(), "desks.json"))
+
+		_, err := reg.Adopt(t.Context(), newRequest(officeDesk))
+		require.ErrorIs(t, err, registry.ErrAlreadyAdopted)
+	})
+
+	t.Run("rejects devices that are not desks", func(t *testing.T) {
+		t.Parallel()
+
+		reg := newTestRegistry(t, filepath.Join(t.TempDir(), "desks.json"))
+
+		_, err := reg.Adopt(t.Context(), newRequest(headphones))
+		require.ErrorIs(t, err, registry.ErrVerificationFailed)
+		require.ErrorIs(t, err, errNotADesk)
+		require.Empty(t, reg.Desks())
+	})
+
+	t.Run("adopts desks by MAC address", func(t *testing.T) {
+		t.Parallel()
+
+		reg := newTestRegistry(t, filepath.Join(t.TempDir(), "desks.json"))
+
+		_, err := reg.Adopt(t.Context(), newRequest(linuxDesk))
+		require.NoError(t, err)
+
+		_, ok := reg.DesksConfig().Device(linuxDesk)
+		require.True(t, ok)
+	})
+
+	t.Run("rejects invalid addresses", func(t *testing.T) {
+		t.Parallel()
+
+		reg := newTestRegistry(t, filepath.Join(t.TempDir(), "desks.json"))
+
+		_, err := reg.Adopt(t.Context(), newRequest("office desk"))
+		require.ErrorIs(t, err, registry.ErrInvalidDesk)
+		require.ErrorIs(t, err, idasen.ErrInvalidAddress)
+		require.Empty(t, reg.Desks())
+	})
+}
@@ -0,0 +1,423 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/stats"
+)
+
+const (
+	// StandPreset is the preset the desk moves to when auto stand is enabled.
+	StandPreset = "stand"
+
+	EventSittingReminder EventType = "sitting_reminder"
+	EventAutoStand       EventType = "auto_stand"
+	EventAutoStandFailed EventType = "auto_stand_failed"
+
+	defaultCheckInterval = 15 * time.Second
+	// autoStandSubject checks the leases of the desks to auto stand, which it never holds.
+	autoStandSubject = "reminders:auto-stand"
+)
+
+var ErrUnknownDesk = errors.New("no height readings for desk")
+
+type (
+	EventType string
+	// Event is a notification delivered to the sinks.
+	Event struct {
+		Type           EventType  `json:"type"`
+		Desk           string     `json:"desk"`
+		Time           time.Time  `json:"time"`
+		SittingSeconds int64      `json:"sitting_seconds"`
+		GoalSeconds    int64      `json:"goal_seconds"`
+		AutoStandAt    *time.Time `json:"auto_stand_at,omitempty"`
+		Height         int        `json:"height,omitempty"`
+		Error          string     `json:"error,omitempty"`
+	}
+	// Mover moves desks. It is implemented by idasen.Manager.
+	Mover interface {
+		MoveTo(ctx context.Context, addr string, targetHeight int) (int, error)
+	}
+	// State is the reminder state of a desk.
+	State struct {
+		Desk           string         `json:"desk"`
+		Position       stats.Position `json:"position"`
+		Since          time.Time      `json:"since"`
+		GoalSeconds    int64          `json:"goal_seconds"`
+		NextReminderAt *time.Time     `json:"next_reminder_at,omitempty"`
+		SnoozedUntil   *time.Time     `json:"snoozed_until,omitempty"`
+		AutoStandAt    *time.Time     `json:"auto_stand_at,omitempty"`
+	}
+	// Engine tracks the sit/stand position of every desk and fires reminders when a desk stays in sitting position
+	// for longer than its goal. A reminder is only repeated when the height of the desk changed since the previous
+	// one, and desks whose height did not change within their goal are not moved, so unattended desks are left alone.
+	// Disconnected desks are forgotten until their next height reading.
+	Engine struct {
+		cfg     config.RemindersConfig
+		desks   func() config.DesksConfig
+		mover   Mover
+		sinks   []Sink
+		logger  *slog.Logger
+		options *EngineOptions
+		mutex   sync.Mutex
+		states  map[string]*deskState
+	}
+	EngineOptions struct {
+		checkInterval time.Duration
+		now           func() time.Time
+		leases        *lease.Store
+	}
+	deskState struct {
+		position     stats.Position
+		since        time.Time
+		activeAt     time.Time // last height reading
+		remindAt     time.Time
+		remindedAt   time.Time
+		snoozedUntil time.Time
+		standAt      time.Time
+	}
+	autoStand struct {
+		desk   string
+		height int
+		event  Event
+	}
+	EngineOption func(*EngineOptions)
+)
+
+// NewEngine creates an engine reading the settings of the desks from desks on every use, so it applies to desks
+// adopted while it runs.
+func NewEngine(
+	cfg config.RemindersConfig,
+	desks func() config.DesksConfig,
+	mover Mover,
+	sinks []Sink,
+	logger *slog.Logger,
+	opts ...EngineOption,
+) *Engine {
+	options := &EngineOptions{
+		checkInterval: defaultCheckInterval,
+		now:           time.Now,
+		leases:        nil,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &Engine{
+		cfg:     cfg,
+		desks:   desks,
+		mover:   mover,
+		sinks:   sinks,
+		logger:  logger.With("component", "reminders"),
+		options: options,
+		mutex:   sync.Mutex{},
+		states:  map[string]*deskState{},
+	}
+}
+
+// Observe takes a height reading of a desk. It does not block, so it can be used as a height observer.
+func (e *Engine) Observe(desk string, height int) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	now := e.options.now()
+	position := stats.Classify(height, e.desks().StandThresholdFor(desk))
+
+	state, ok := e.states[desk]
+	if ok {
+		state.activeAt = now
+	}
+
+	if ok && state.position == position {
+		return
+	}
+
+	if !ok {
+		state = &deskState{
+			position:     position,
+			since:        now,
+			activeAt:     now,
+			remindAt:     time.Time{},
+			remindedAt:   time.Time{},
+			snoozedUntil: time.Time{},
+			standAt:      time.Time{},
+		}
+		e.states[desk] = state
+	}
+
+	state.position = position
+	state.since = now
+	state.remindAt = now.Add(e.goal(desk))
+	state.remindedAt = time.Time{}
+	state.standAt = time.Time{}
+}
+
+// HandleEvent forgets the state of disconnected desks, as their height is no longer known. It can be used as an event
+// observer.
+func (e *Engine) HandleEvent(event idasen.Event) {
+	if event.Type != idasen.EventDisconnected {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	delete(e.states, event.Desk)
+}
+
+// Run checks the desks periodically until ctx is done.
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.options.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.Check(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check fires the reminders that are due and starts the pending auto stand moves.
+func (e *Engine) Check(ctx context.Context) {
+	e.mutex.Lock()
+
+	now := e.options.now()
+
+	var (
+		events []Event
+		moves  []autoStand
+	)
+
+	for desk, state := range e.states {
+		if state.position != stats.PositionSitting || now.Before(state.snoozedUntil) {
+			continue
+		}
+
+		event := Event{
+			Type:           EventSittingReminder,
+			Desk:           desk,
+			Time:           now,
+			SittingSeconds: int64(now.Sub(state.since).Seconds()),
+			GoalSeconds:    int64(e.goal(desk).Seconds()),
+			AutoStandAt:    nil,
+			Height:         0,
+			Error:          "",
+		}
+
+		if !state.standAt.IsZero() && !now.Before(state.standAt) {
+			state.standAt = time.Time{}
+
+			if now.Sub(state.activeAt) > e.goal(desk) {
+				e.logger.InfoContext(ctx, "Skipping auto stand of unattended desk", slog.String("desk", desk))
+
+				continue
+			}
+
+			if height, ok := e.desks().PresetFor(desk, StandPreset); ok {
+				event.Type = EventAutoStand
+				event.Height = height
+				moves = append(moves, autoStand{desk: desk, height: height, event: event})
+			}
+
+			continue
+		}
+
+		if now.Before(state.remindAt) || paused(state) {
+			continue
+		}
+
+		state.remindAt = now.Add(e.goal(desk))
+		state.remindedAt = now
+
+		if e.cfg.AutoStand && state.standAt.IsZero() {
+			if _, ok := e.desks().PresetFor(desk, StandPreset); ok {
+				standAt := now.Add(e.cfg.GracePeriod)
+				state.standAt = standAt
+				event.AutoStandAt = &standAt
+			}
+		}
+
+		events = append(events, event)
+	}
+
+	e.mutex.Unlock()
+
+	for _, event := range events {
+		e.notify(ctx, event)
+	}
+
+	for _, move := range moves {
+		go e.autoStand(ctx, move)
+	}
+}
+
+// Snooze postpones the reminders and the pending auto stand of a desk.
+func (e *Engine) Snooze(desk string, duration time.Duration) (State, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	state, ok := e.states[desk]
+	if !ok {
+		return State{}, ErrUnknownDesk //nolint:exhaustruct // not found
+	}
+
+	state.snoozedUntil = e.options.now().Add(duration)
+	state.standAt = time.Time{}
+
+	return e.state(desk, state), nil
+}
+
+func (e *Engine) State(desk string) (State, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	state, ok := e.states[desk]
+	if !ok {
+		return State{}, ErrUnknownDesk //nolint:exhaustruct // not found
+	}
+
+	return e.state(desk, state), nil
+}
+
+// Close closes the sinks.
+func (e *Engine) Close() error {
+	var errs []error
+
+	for _, sink := range e.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s sink: %w", sink.Name(), err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// state builds the State of a desk. The caller must hold the mutex.
+func (e *Engine) state(desk string, state *deskState) State {
+	now := e.options.now()
+
+	result := State{
+		Desk:           desk,
+		Position:       state.position,
+		Since:          state.since,
+		GoalSeconds:    int64(e.goal(desk).Seconds()),
+		NextReminderAt: nil,
+		SnoozedUntil:   nil,
+		AutoStandAt:    nil,
+	}
+
+	if state.position == stats.PositionSitting && !paused(state) {
+		next := state.remindAt
+		if next.Before(state.snoozedUntil) {
+			next = state.snoozedUntil
+		}
+
+		result.NextReminderAt = &next
+	}
+
+	if now.Before(state.snoozedUntil) {
+		snoozedUntil := state.snoozedUntil
+		result.SnoozedUntil = &snoozedUntil
+	}
+
+	if !state.standAt.IsZero() {
+		standAt := state.standAt
+		result.AutoStandAt = &standAt
+	}
+
+	return result
+}
+
+// paused reports whether the reminders of the desk wait for a height reading, as none arrived since the last one.
+func paused(state *deskState) bool {
+	return !state.remindedAt.IsZero() && state.activeAt.Before(state.remindedAt)
+}
+
+func (e *Engine) goal(desk string) time.Duration {
+	if device, ok := e.desks().Device(desk); ok && device.SittingGoal > 0 {
+		return device.SittingGoal
+	}
+
+	return e.cfg.SittingGoal
+}
+
+func (e *Engine) autoStand(ctx context.Context, move autoStand) {
+	event := move.event
+
+	if err := e.options.leases.CheckMove(move.desk, autoStandSubject); err != nil {
+		e.logger.InfoContext(ctx, "Skipping auto stand of leased desk", slog.String("desk", move.desk))
+
+		event.Type = EventAutoStandFailed
+		event.Error = err.Error()
+		e.notify(ctx, event)
+
+		return
+	}
+
+	e.logger.InfoContext(
+		ctx,
+		"Moving desk to stand preset",
+		slog.String("desk", move.desk),
+		slog.Int("height", move.height),
+	)
+
+	if _, err := e.mover.MoveTo(ctx, move.desk, move.height); err != nil {
+		e.logger.ErrorContext(ctx, "Error moving desk to stand preset", slog.String("error", err.Error()))
+
+		event.Type = EventAutoStandFailed
+		event.Error = err.Error()
+	}
+
+	e.notify(ctx, event)
+}
+
+func (e *Engine) notify(ctx context.Context, event Event) {
+	for _, sink := range e.sinks {
+		if err := sink.Notify(ctx, event); err != nil {
+			e.logger.ErrorContext(
+				ctx,
+				"Error notifying reminder",
+				slog.String("sink", sink.Name()),
+				slog.String("desk", event.Desk),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// EngineOptionsWithCheckInterval sets how often the desks are checked for due reminders.
+func EngineOptionsWithCheckInterval(interval time.Duration) EngineOption {
+	return func(o *EngineOptions) {
+		o.checkInterval = interval
+	}
+}
+
+// EngineOptionsWithLeases skips the auto stand of desks leased to someone, reporting it as a failed auto stand.
+func EngineOptionsWithLeases(leases *lease.Store) EngineOption {
+	return func(o *EngineOptions) {
+		o.leases = leases
+	}
+}
+
+// EngineOptionsWithClock sets the function returning the current time.
+func EngineOptionsWithClock(now func() time.Time) EngineOption {
+	return func(o *EngineOptions) {
+		o.now = now
+	}
+}
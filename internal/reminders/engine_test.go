@@ -0,0 +1,375 @@
+package reminders_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/reminders"
+	"github.com/stretchr/testify/require"
+)
+
+const testDesk = "6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10"
+
+var errMove = errors.New("move failed")
+
+type (
+	fakeClock struct {
+		mutex sync.Mutex
+		now   time.Time
+	}
+	fakeSink struct {
+		mutex  sync.Mutex
+		events []reminders.Event
+	}
+	fakeMover struct {
+		mutex sync.Mutex
+		moves []int
+		err   error
+	}
+)
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func (s *fakeSink) Name() string { return "fake" }
+
+func (s *fakeSink) Notify(_ context.Context, event reminders.Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.events = append(s.events, event)
+
+	return nil
+}
+
+func (s *fakeSink) Close() error { return nil }
+
+func (s *fakeSink) Types() []reminders.EventType {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	types := make([]reminders.EventType, 0, len(s.events))
+	for _, event := range s.events {
+		types = append(types, event.Type)
+	}
+
+	return types
+}
+
+func (m *fakeMover) MoveTo(_ context.Context, _ string, targetHeight int) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.moves = append(m.moves, targetHeight)
+
+	return targetHeight, m.err
+}
+
+func (m *fakeMover) Moves() []int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]int(nil), m.moves...)
+}
+
+func newTestEngine(
+	t *testing.T,
+	autoStand bool,
+	mover *fakeMover,
+	opts ...reminders.EngineOption,
+) (*reminders.Engine, *fakeClock, *fakeSink) {
+	t.Helper()
+
+	clock := &fakeClock{mutex: sync.Mutex{}, now: time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)}
+	sink := &fakeSink{mutex: sync.Mutex{}, events: nil}
+
+	engine := reminders.NewEngine(
+		config.RemindersConfig{
+			SittingGoal: 45 * time.Minute,
+			AutoStand:   autoStand,
+			GracePeriod: 5 * time.Minute,
+			Webhook:     nil,
+			MQTT:        nil,
+			SSE:         false,
+		},
+		func() config.DesksConfig {
+			return config.DesksConfig{
+				IdleTimeout:    0,
+				StandThreshold: config.DefaultStandThreshold,
+				Presets:        map[string]int{reminders.StandPreset: 11500},
+				Devices:        nil,
+				Groups:         nil,
+			}
+		},
+		mover,
+		[]reminders.Sink{sink},
+		slog.New(slog.DiscardHandler),
+		append(opts, reminders.EngineOptionsWithClock(clock.Now))...,
+	)
+
+	return engine, clock, sink
+}
+
+func TestEngine(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reminds when sitting longer than the goal", func(t *testing.T) {
+		t.Parallel()
+
+		engine, clock, sink := newTestEngine(t, false, &fakeMover{})
+
+		engine.Observe(testDesk, 7000)
+
+		clock.Advance(44 * time.Minute)
+		engine.Check(t.Context())
+		require.Empty(t, sink.Types(), "should not remind before the goal")
+
+		clock.Advance(time.Minute)
+		engine.Check(t.Context())
+		require.Equal(t, []reminders.EventType{reminders.EventSittingReminder}, sink.Types())
+
+		engine.Check(t.Context())
+		require.Len(t, sink.Types(), 1, "should not repeat the reminder until the goal elapses again")
+
+		clock.Advance(30 * time.Minute)
+		engine.Observe(testDesk, 7100)
+		clock.Advance(15 * time.Minute)
+		engine.Check(t.Context())
+		require.Len(t, sink.Types(), 2, "should repeat the reminder")
+	})
+
+	t.Run("pauses reminders of unattended desks", func(t *testing.T) {
+		t.Parallel()
+
+		engine, clock, sink := newTestEngine(t, false, &fakeMover{})
+
+		engine.Observe(testDesk, 7000)
+
+		clock.Advance(45 * time.Minute)
+		engine.Check(t.Context())
+		clock.Advance(45 * time.Minute)
+		engine.Check(t.Context())
+		require.Len(t, sink.Types(), 1, "should not repeat the reminder without activity")
+
+		state, err := engine.State(testDesk)
+		require.NoError(t, err)
+		require.Nil(t, state.NextReminderAt)
+
+		engine.Observe(testDesk, 7000)
+		engine.Check(t.Context())
+		require.Len(t, sink.Types(), 2, "should resume the reminders on activity")
+	})
+
+	t.Run("forgets disconnected desks", func(t *testing.T) {
+		t.Parallel()
+
+		engine, clock, sink := newTestEngine(t, false, &fakeMover{})
+
+		engine.Observe(testDesk, 7000)
+		engine.HandleEvent(idasen.Event{Type: idasen.EventDisconnected, Desk: testDesk}) //nolint:exhaustruct // test event
+
+		_, err := engine.State(testDesk)
+		require.ErrorIs(t, err, reminders.ErrUnknownDesk)
+
+		clock.Advance(45 * time.Minute)
+		engine.Check(t.Context())
+		require.Empty(t, sink.Types())
+	})
+
+	t.Run("standing resets the timer", func(t *testing.T) {
+		t.Parallel()
+
+		engine, clock, sink := newTestEngine(t, false, &fakeMover{})
+
+		engine.Observe(testDesk, 7000)
+		clock.Advance(30 * time.Minute)
+		engine.Observe(testDesk, 11000)
+		clock.Advance(30 * time.Minute)
+		engine.Observe(testDesk, 7000)
+		clock.Advance(30 * time.Minute)
+		engine.Check(t.Context())
+
+		require.Empty(t, sink.Types())
+
+		state, err := engine.State(testDesk)
+		require.NoError(t, err)
+		require.Equal(t, clock.Now().Add(15*time.Minute), *state.NextReminderAt)
+	})
+
+	t.Run("snooze postpones reminders", func(t *testing.T) {
+		t.Parallel()
+
+		engine, clock, sink := newTestEngine(t, false, &fakeMover{})
+
+		engine.Observe(testDesk, 7000)
+
+		state, err := engine.Snooze(testDesk, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, clock.Now().Add(time.Hour), *state.SnoozedUntil)
+
+		clock.Advance(50 * time.Minute)
+		engine.Check(t.Context())
+		require.Empty(t, sink.Types(), "should not remind while snoozed")
+
+		clock.Advance(10 * time.Minute)
+		engine.Check(t.Context())
+		require.Equal(t, []reminders.EventType{reminders.EventSittingReminder}, sink.Types())
+	})
+
+	t.Run("unknown desk", func(t *testing.T) {
+		t.Parallel()
+
+		engine, _, _ := newTestEngine(t, false, &fakeMover{})
+
+		_, err := engine.Snooze(testDesk, time.Hour)
+		require.ErrorIs(t, err, reminders.ErrUnknownDesk)
+	})
+
+	t.Run("auto stands after the grace period", func(t *testing.T) {
+		t.Parallel()
+
+		mover := &fakeMover{}
+		engine, clock, sink := newTestEngine(t, true, mover)
+
+		engine.Observe(testDesk, 7000)
+
+		clock.Advance(45 * time.Minute)
+		engine.Check(t.Context())
+
+		state, err := engine.State(testDesk)
+		require.NoError(t, err)
+		require.Equal(t, clock.Now().Add(5*time.Minute), *state.AutoStandAt)
+
+		engine.Observe(testDesk, 7000)
+		clock.Advance(5 * time.Minute)
+		engine.Check(t.Context())
+
+		require.Eventually(t, func() bool {
+			return len(sink.Types()) == 2
+		}, time.Second, time.Millisecond)
+		require.Equal(t, []reminders.EventType{reminders.EventSittingReminder, reminders.EventAutoStand}, sink.Types())
+		require.Equal(t, []int{11500}, mover.Moves())
+	})
+
+	t.Run("does not auto stand unattended desks", func(t *testing.T) {
+		t.Parallel()
+
+		mover := &fakeMover{}
+		engine, clock, sink := newTestEngine(t, true, mover)
+
+		engine.Observe(testDesk, 7000)
+
+		clock.Advance(45 * time.Minute)
+		engine.Check(t.Context())
+		clock.Advance(5 * time.Minute)
+		engine.Check(t.Context())
+
+		require.Empty(t, mover.Moves())
+		require.Equal(t, []reminders.EventType{reminders.EventSittingReminder}, sink.Types())
+	})
+
+	t.Run("does not auto stand leased desks", func(t *testing.T) {
+		t.Parallel()
+
+		leases := lease.NewStore(config.LeasesConfig{DefaultDuration: time.Hour, MaxDuration: time.Hour})
+		_, err := leases.Acquire(testDesk, "alice", 0)
+		require.NoError(t, err)
+
+		mover := &fakeMover{}
+		engine, clock, sink := newTestEngine(t, true, mover, reminders.EngineOptionsWithLeases(leases))
+
+		engine.Observe(testDesk, 7000)
+
+		clock.Advance(45 * time.Minute)
+		engine.Check(t.Context())
+		engine.Observe(testDesk, 7000)
+		clock.Advance(5 * time.Minute)
+		engine.Check(t.Context())
+
+		require.Eventually(t, func() bool {
+			return len(sink.Types()) == 2
+		}, time.Second, time.Millisecond)
+		require.Equal(t, reminders.EventAutoStandFailed, sink.Types()[1])
+		require.Empty(t, mover.Moves())
+	})
+
+	t.Run("snooze cancels the auto stand", func(t *testing.T) {
+		t.Parallel()
+
+		mover := &fakeMover{}
+		engine, clock, _ := newTestEngine(t, true, mover)
+
+		engine.Observe(testDesk, 7000)
+
+		clock.Advance(45 * time.Minute)
+		engine.Check(t.Context())
+
+		_, err := engine.Snooze(testDesk, 10*time.Minute)
+		require.NoError(t, err)
+
+		clock.Advance(5 * time.Minute)
+		engine.Check(t.Context())
+		require.Empty(t, mover.Moves())
+	})
+
+	t.Run("reports failed auto stand", func(t *testing.T) {
+		t.Parallel()
+
+		mover := &fakeMover{err: errMove}
+		engine, clock, sink := newTestEngine(t, true, mover)
+
+		engine.Observe(testDesk, 7000)
+
+		clock.Advance(45 * time.Minute)
+		engine.Check(t.Context())
+		engine.Observe(testDesk, 7000)
+		clock.Advance(5 * time.Minute)
+		engine.Check(t.Context())
+
+		require.Eventually(t, func() bool {
+			return len(sink.Types()) == 2
+		}, time.Second, time.Millisecond)
+		require.Equal(t, reminders.EventAutoStandFailed, sink.Types()[1])
+	})
+}
+
+func TestBroker(t *testing.T) {
+	t.Parallel()
+
+	broker := reminders.NewBroker()
+
+	id, events := broker.Subscribe()
+
+	event := reminders.Event{Type: reminders.EventSittingReminder, Desk: testDesk} //nolint:exhaustruct // test event
+	require.NoError(t, broker.Notify(t.Context(), event))
+	require.Equal(t, event, <-events)
+
+	broker.Unsubscribe(id)
+
+	_, open := <-events
+	require.False(t, open, "should close the stream on unsubscribe")
+
+	_, events = broker.Subscribe()
+	require.NoError(t, broker.Close())
+
+	_, open = <-events
+	require.False(t, open, "should close the streams on close")
+}
@@ -0,0 +1,232 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+const (
+	mqttTimeout     = 10 * time.Second
+	mqttQoS         = 1
+	brokerQueueSize = 16
+)
+
+var (
+	ErrWebhookStatus = errors.New("webhook returned an error status")
+	ErrMQTTTimeout   = errors.New("mqtt operation timed out")
+)
+
+type (
+	// Sink delivers reminder events.
+	Sink interface {
+		Name() string
+		Notify(ctx context.Context, event Event) error
+		Close() error
+	}
+	// WebhookSink posts events as JSON to a URL.
+	WebhookSink struct {
+		url     string
+		headers map[string]string
+		client  *http.Client
+	}
+	// MQTTSink publishes events to a topic per desk.
+	MQTTSink struct {
+		client mqtt.Client
+		topic  string
+	}
+	// Broker fans events out to the server-sent event streams. Slow streams miss events rather than blocking.
+	Broker struct {
+		mutex       sync.RWMutex
+		subscribers map[string]chan Event
+		closed      bool
+	}
+)
+
+var (
+	_ Sink = (*WebhookSink)(nil)
+	_ Sink = (*MQTTSink)(nil)
+	_ Sink = (*Broker)(nil)
+)
+
+func NewWebhookSink(cfg config.ReminderWebhookConfig) *WebhookSink {
+	return &WebhookSink{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: cfg.Timeout}, //nolint:exhaustruct // defaults
+	}
+}
+
+func (w *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (w *WebhookSink) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%w: %s", ErrWebhookStatus, resp.Status)
+	}
+
+	return nil
+}
+
+func (w *WebhookSink) Close() error {
+	return nil
+}
+
+// NewMQTTSink connects to the broker. The client reconnects on its own if the connection drops later on.
+func NewMQTTSink(cfg config.MQTTConfig) (*MQTTSink, error) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetConnectTimeout(mqttTimeout).
+		SetAutoReconnect(true)
+
+	client := mqtt.NewClient(opts)
+
+	if err := waitToken(client.Connect()); err != nil {
+		return nil, fmt.Errorf("connecting to mqtt broker: %w", err)
+	}
+
+	return &MQTTSink{
+		client: client,
+		topic:  cfg.Topic,
+	}, nil
+}
+
+func (m *MQTTSink) Name() string {
+	return "mqtt"
+}
+
+func (m *MQTTSink) Notify(_ context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+
+	if err = waitToken(m.client.Publish(m.topic+"/"+event.Desk, mqttQoS, false, payload)); err != nil {
+		return fmt.Errorf("publishing event: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MQTTSink) Close() error {
+	m.client.Disconnect(uint(mqttTimeout.Milliseconds()))
+
+	return nil
+}
+
+func waitToken(token mqtt.Token) error {
+	if !token.WaitTimeout(mqttTimeout) {
+		return ErrMQTTTimeout
+	}
+
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("mqtt: %w", err)
+	}
+
+	return nil
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		mutex:       sync.RWMutex{},
+		subscribers: map[string]chan Event{},
+		closed:      false,
+	}
+}
+
+func (b *Broker) Name() string {
+	return "sse"
+}
+
+func (b *Broker) Notify(_ context.Context, event Event) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Subscribe returns a channel receiving the events until Unsubscribe or Close is called, which close it.
+func (b *Broker) Subscribe() (string, <-chan Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	id := uuid.NewString()
+	ch := make(chan Event, brokerQueueSize)
+
+	if b.closed {
+		close(ch)
+
+		return id, ch
+	}
+
+	b.subscribers[id] = ch
+
+	return id, ch
+}
+
+func (b *Broker) Unsubscribe(id string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if ch, ok := b.subscribers[id]; ok {
+		close(ch)
+		delete(b.subscribers, id)
+	}
+}
+
+// Close ends every stream, which lets the server shut down without waiting for them.
+func (b *Broker) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+
+	for id, ch := range b.subscribers {
+		close(ch)
+		delete(b.subscribers, id)
+	}
+
+	return nil
+}
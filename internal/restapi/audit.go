@@ -0,0 +1,106 @@
+package restapi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
+	"github.com/go-chi/render"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type AuditResponse struct {
+	Entries []audit.Entry `json:"entries"`
+}
+
+var _ render.Renderer = (*AuditResponse)(nil)
+
+func handleGetAudit(auditLog *audit.Log, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			filter, err := parseAuditFilter(r)
+			if err != nil {
+				return nil, api.NewErrorResponse(
+					err,
+					http.StatusBadRequest,
+					http.StatusText(http.StatusBadRequest),
+					"Invalid query",
+					nil,
+				)
+			}
+
+			entries, err := auditLog.Query(filter)
+			if err != nil {
+				return nil, api.NewErrorResponse(
+					err,
+					http.StatusInternalServerError,
+					http.StatusText(http.StatusInternalServerError),
+					"Failed to read audit log",
+					nil,
+				)
+			}
+
+			return &AuditResponse{Entries: entries}, nil
+		},
+		logger,
+	)
+}
+
+func (a *AuditResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
+
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+
+	filter := audit.Filter{
+		Desk:    query.Get("desk"),
+		Subject: query.Get("subject"),
+		Action:  audit.Action(query.Get("action")),
+		From:    time.Time{},
+		To:      time.Time{},
+		Limit:   defaultAuditLimit,
+	}
+
+	var err error
+
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, fmt.Errorf("parsing from: %w", err)
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, fmt.Errorf("parsing to: %w", err)
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 {
+			return filter, fmt.Errorf("invalid limit %q", limit)
+		}
+
+		filter.Limit = min(filter.Limit, maxAuditLimit)
+	}
+
+	return filter, nil
+}
+
+// recordAudit writes the entry, logging instead of failing the request when the audit log is unavailable.
+func recordAudit(ctx context.Context, auditLog *audit.Log, entry *audit.Entry, logger *slog.Logger) {
+	if err := auditLog.Record(entry); err != nil {
+		logger.ErrorContext(ctx, "Error recording audit entry", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,149 @@
+package restapi
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/registry"
+	"github.com/go-chi/render"
+)
+
+var (
+	ErrRegistryDisabled = errors.New("desk adoption is not enabled")
+	ErrMissingAddress   = errors.New("missing address")
+	ErrNotDiscovered    = errors.New("desk has not been discovered")
+)
+
+type (
+	// AdoptDeskRequest adopts the desk with the given address.
+	AdoptDeskRequest struct {
+		Address string `json:"address"`
+		Alias   string `json:"alias"`
+		Owner   string `json:"owner"`
+	}
+	AdoptedDeskResponse struct {
+		registry.Desk
+	}
+)
+
+var (
+	_ render.Binder   = (*AdoptDeskRequest)(nil)
+	_ render.Renderer = (*AdoptedDeskResponse)(nil)
+)
+
+// handleAdoptDesk adopts a desk. When discovery is enabled, only discovered desks can be adopted. Adopting does not pair
+// with the desk, as go-ble cannot bond with devices: desks that require bonding have to be paired with the host
+// beforehand, for example with bluetoothctl.
+func handleAdoptDesk(
+	desks *registry.Registry,
+	discovery *idasen.Discovery,
+	auditLog *audit.Log,
+	logger *slog.Logger,
+) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			if desks == nil {
+				return nil, api.NewErrorResponse(
+					ErrRegistryDisabled,
+					http.StatusNotFound,
+					http.StatusText(http.StatusNotFound),
+					"Desk adoption not enabled",
+					nil,
+				)
+			}
+
+			var req AdoptDeskRequest
+			if err := render.Bind(r, &req); err != nil {
+				return nil, api.NewErrorResponse(
+					err,
+					http.StatusBadRequest,
+					http.StatusText(http.StatusBadRequest),
+					"Invalid request",
+					nil,
+				)
+			}
+
+			desk := registry.Desk{
+				ID:        req.Address,
+				Alias:     req.Alias,
+				Owner:     req.Owner,
+				Name:      "",
+				AdoptedAt: time.Time{},
+				AdoptedBy: "",
+			}
+
+			if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+				desk.AdoptedBy = identity.Subject
+			}
+
+			if discovery != nil {
+				discovered, ok := discovery.Desk(req.Address)
+				if !ok {
+					return nil, api.NewErrorResponse(
+						ErrNotDiscovered,
+						http.StatusNotFound,
+						http.StatusText(http.StatusNotFound),
+						"Desk not discovered",
+						nil,
+					)
+				}
+
+				desk.Name = discovered.Name
+			}
+
+			entry := audit.NewEntry(r.Context(), audit.ActionConfigChange, req.Address)
+			entry.Details = map[string]any{"operation": "adopt_desk"}
+
+			adopted, err := desks.Adopt(r.Context(), desk)
+			recordAudit(r.Context(), auditLog, entry.Done(err), logger)
+
+			if err != nil {
+				logger.ErrorContext(r.Context(), "Error adopting desk", slog.String("error", err.Error()))
+
+				return nil, adoptErrorResponse(err)
+			}
+
+			return &AdoptedDeskResponse{Desk: adopted}, nil
+		},
+		logger,
+	)
+}
+
+func adoptErrorResponse(err error) *api.ErrRepsonse {
+	status, msg := http.StatusInternalServerError, "Failed to adopt desk"
+
+	switch {
+	case errors.Is(err, registry.ErrInvalidDesk):
+		status, msg = http.StatusBadRequest, "Invalid desk"
+	case errors.Is(err, registry.ErrAlreadyAdopted):
+		status, msg = http.StatusConflict, "Desk already adopted"
+	case errors.Is(err, registry.ErrVerificationFailed):
+		status, msg = http.StatusBadGateway, "Desk could not be verified"
+	}
+
+	return api.NewErrorResponse(err, status, http.StatusText(status), msg, nil)
+}
+
+func (a *AdoptDeskRequest) Bind(_ *http.Request) error {
+	if a.Address == "" {
+		return ErrMissingAddress
+	}
+
+	if err := idasen.ValidateAddress(a.Address); err != nil {
+		return err //nolint:wrapcheck // the error is the response
+	}
+
+	return nil
+}
+
+func (a *AdoptedDeskResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusCreated)
+
+	return nil
+}
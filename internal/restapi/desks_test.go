@@ -0,0 +1,63 @@
+package restapi_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/registry"
+	"github.com/stretchr/testify/require"
+)
+
+// linuxDesk is a desk as discovered on Linux, where bluetooth addresses are MAC addresses.
+const linuxDesk = "E8:5B:5B:24:3A:11"
+
+// stillDesk is a desk that never moves.
+type stillDesk struct{}
+
+func (stillDesk) ReadHeight() (int, error)   { return 7000, nil }
+func (stillDesk) MoveUp() error              { return nil }
+func (stillDesk) MoveDown() error            { return nil }
+func (stillDesk) Stop() error                { return nil }
+func (stillDesk) Subscribe(chan<- int) error { return nil }
+func (stillDesk) Unsubscribe() error         { return nil }
+func (stillDesk) Close() error               { return nil }
+
+func TestAdoptedDesksCanBeUsed(t *testing.T) {
+	t.Parallel()
+
+	services := newTestServices(t)
+	services.Manager = idasen.NewManager(
+		t.Context(),
+		func(context.Context, string) (idasen.BTDesk, error) { return stillDesk{}, nil },
+		slog.New(slog.DiscardHandler),
+	)
+
+	desks, err := registry.NewRegistry(
+		config.RegistryConfig{File: filepath.Join(t.TempDir(), "desks.json")},
+		config.DesksConfig{}, //nolint:exhaustruct // no configured desks
+		services.Manager,
+		slog.New(slog.DiscardHandler),
+	)
+	require.NoError(t, err)
+
+	services.Registry = desks
+	services.Desks = desks.DesksConfig
+	handler := newTestHandler(services)
+
+	require.Equal(
+		t,
+		http.StatusBadRequest,
+		serve(t, handler, http.MethodPost, "/v1/desks", "token-a", `{"address": "office desk"}`),
+	)
+	require.Equal(
+		t,
+		http.StatusCreated,
+		serve(t, handler, http.MethodPost, "/v1/desks", "token-a", `{"address": "`+linuxDesk+`"}`),
+	)
+	require.Equal(t, http.StatusOK, serve(t, handler, http.MethodGet, "/v1/desk/"+linuxDesk, "token-a", ""))
+}
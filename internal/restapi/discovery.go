@@ -0,0 +1,73 @@
+package restapi
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/go-chi/render"
+)
+
+var ErrDiscoveryDisabled = errors.New("discovery is not enabled")
+
+type (
+	// DiscoveredDeskResponse is a desk in range. Desks that are not Configured yet can be adopted into the config.
+	DiscoveredDeskResponse struct {
+		idasen.DiscoveredDesk
+		Configured bool `json:"configured"`
+	}
+	DiscoveryResponse struct {
+		Desks    []DiscoveredDeskResponse `json:"desks"`
+		LastScan time.Time                `json:"last_scan,omitzero"`
+	}
+)
+
+var _ render.Renderer = (*DiscoveryResponse)(nil)
+
+func handleGetDiscovery(
+	discovery *idasen.Discovery,
+	desks func() config.DesksConfig,
+	logger *slog.Logger,
+) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, _ *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			if discovery == nil {
+				return nil, api.NewErrorResponse(
+					ErrDiscoveryDisabled,
+					http.StatusNotFound,
+					http.StatusText(http.StatusNotFound),
+					"Discovery not enabled",
+					nil,
+				)
+			}
+
+			discovered, lastScan := discovery.Desks()
+
+			response := &DiscoveryResponse{
+				Desks:    make([]DiscoveredDeskResponse, 0, len(discovered)),
+				LastScan: lastScan,
+			}
+
+			settings := desks()
+
+			for _, desk := range discovered {
+				_, configured := settings.Device(desk.Addr)
+
+				response.Desks = append(response.Desks, DiscoveredDeskResponse{DiscoveredDesk: desk, Configured: configured})
+			}
+
+			return response, nil
+		},
+		logger,
+	)
+}
+
+func (d *DiscoveryResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
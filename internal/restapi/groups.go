@@ -0,0 +1,260 @@
+package restapi
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/ratelimit"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+const (
+	GroupDeskReached = "reached"
+	GroupDeskFailed  = "failed"
+	GroupDeskStalled = "stalled"
+	GroupDeskAborted = "aborted"
+)
+
+var ErrUnknownGroup = errors.New("unknown group")
+
+type (
+	// MoveGroupRequest moves every desk of a group to Height or to its own height for the named Preset.
+	// AbortOnFailure overrides the setting of the group.
+	MoveGroupRequest struct {
+		Height         int    `json:"height"`
+		Preset         string `json:"preset"`
+		AbortOnFailure *bool  `json:"abort_on_failure"`
+	}
+	// MoveGroupResponse lists the outcome of every desk of the group, which is one of GroupDeskReached,
+	// GroupDeskFailed, GroupDeskStalled or GroupDeskAborted.
+	MoveGroupResponse struct {
+		Group string              `json:"group"`
+		Desks []GroupDeskResponse `json:"desks"`
+	}
+	GroupDeskResponse struct {
+		Desk         string `json:"desk"`
+		TargetHeight int    `json:"target_height"`
+		Height       int    `json:"height"`
+		Status       string `json:"status"`
+		Error        string `json:"error,omitempty"`
+	}
+)
+
+var (
+	_ render.Binder   = (*MoveGroupRequest)(nil)
+	_ render.Renderer = (*MoveGroupResponse)(nil)
+)
+
+// handleMoveGroup moves the desks of a group concurrently. It answers 200 when every desk reached its target and 207
+// with the outcome of each desk otherwise. The caller must be allowed to move every desk of the group, and no desk may
+// be leased to someone else. The request costs the caller a single token, and is rejected unless every desk is within
+// its own limits.
+func handleMoveGroup(
+	manager *idasen.Manager,
+	desks func() config.DesksConfig,
+	limiter *ratelimit.MoveLimiter,
+	leases *lease.Store,
+	auditLog *audit.Log,
+	logger *slog.Logger,
+) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(w http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			name := chi.URLParam(r, "name")
+			settings := desks()
+
+			group, found := settings.Group(name)
+			if !found {
+				return nil, api.NewErrorResponse(
+					fmt.Errorf("%w: %s", ErrUnknownGroup, name),
+					http.StatusNotFound,
+					http.StatusText(http.StatusNotFound),
+					"Group not found",
+					nil,
+				)
+			}
+
+			identity, ok := auth.IdentityFromContext(r.Context())
+			if !ok || !canAccessDesks(identity, group.Desks) {
+				return nil, api.NewErrorResponse(
+					auth.ErrForbidden,
+					http.StatusForbidden,
+					http.StatusText(http.StatusForbidden),
+					"Desk not allowed",
+					nil,
+				)
+			}
+
+			var req MoveGroupRequest
+			if err := render.Bind(r, &req); err != nil {
+				return nil, api.NewErrorResponse(
+					err,
+					http.StatusBadRequest,
+					http.StatusText(http.StatusBadRequest),
+					"Invalid request",
+					nil,
+				)
+			}
+
+			moves, errResp := groupMoves(group, settings, req)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			for _, id := range group.Desks {
+				if err := leases.CheckMove(id, identity.Subject); err != nil {
+					return nil, leaseErrorResponse(err)
+				}
+			}
+
+			if retryAfter, err := limiter.Allow(identity.Subject, group.Desks...); err != nil {
+				return nil, rateLimitedResponse(w, retryAfter, err)
+			}
+
+			abortOnFailure := group.AbortOnFailure
+			if req.AbortOnFailure != nil {
+				abortOnFailure = *req.AbortOnFailure
+			}
+
+			results := manager.MoveGroup(
+				r.Context(),
+				moves,
+				idasen.GroupMoveOptionsWithAbortOnFailure(abortOnFailure),
+				idasen.GroupMoveOptionsWithStallTimeout(group.StallTimeout),
+			)
+
+			resp := &MoveGroupResponse{Group: group.Name, Desks: make([]GroupDeskResponse, 0, len(results))}
+
+			for i, result := range results {
+				entry := audit.NewEntry(r.Context(), audit.ActionMove, result.Addr)
+				entry.ToHeight = &moves[i].Height
+				entry.Details = map[string]any{"group": group.Name, "preset": req.Preset}
+				recordAudit(r.Context(), auditLog, entry.Done(result.Err), logger)
+
+				if motorRan(result.Err) {
+					limiter.Completed(result.Addr)
+				}
+
+				resp.Desks = append(resp.Desks, newGroupDeskResponse(moves[i], result))
+
+				if result.Err != nil {
+					logger.ErrorContext(
+						r.Context(),
+						"Error moving desk of group",
+						slog.String("group", group.Name),
+						slog.String("desk", result.Addr),
+						slog.String("error", result.Err.Error()),
+					)
+				}
+			}
+
+			return resp, nil
+		},
+		logger,
+	)
+}
+
+func canAccessDesks(identity *auth.Identity, ids []string) bool {
+	for _, id := range ids {
+		if !identity.CanAccessDesk(id) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// groupMoves returns the target height of every desk of the group, which must be one the desks can move to.
+func groupMoves(
+	group config.GroupConfig,
+	desks config.DesksConfig,
+	req MoveGroupRequest,
+) ([]idasen.GroupMove, *api.ErrRepsonse) {
+	moves := make([]idasen.GroupMove, 0, len(group.Desks))
+
+	for _, id := range group.Desks {
+		height := req.Height
+
+		if req.Preset != "" {
+			var found bool
+			if height, found = desks.PresetFor(id, req.Preset); !found {
+				return nil, api.NewErrorResponse(
+					fmt.Errorf("%w: %s for desk %s", ErrUnknownPreset, req.Preset, id),
+					http.StatusBadRequest,
+					http.StatusText(http.StatusBadRequest),
+					"Unknown preset",
+					nil,
+				)
+			}
+		}
+
+		if err := idasen.ValidateHeight(height); err != nil {
+			return nil, api.NewErrorResponse(
+				fmt.Errorf("%w for desk %s", err, id),
+				http.StatusBadRequest,
+				http.StatusText(http.StatusBadRequest),
+				"Invalid height",
+				nil,
+			)
+		}
+
+		moves = append(moves, idasen.GroupMove{Addr: id, Height: height})
+	}
+
+	return moves, nil
+}
+
+func newGroupDeskResponse(move idasen.GroupMove, result idasen.GroupMoveResult) GroupDeskResponse {
+	resp := GroupDeskResponse{
+		Desk:         result.Addr,
+		TargetHeight: move.Height,
+		Height:       result.Height,
+		Status:       GroupDeskReached,
+		Error:        "",
+	}
+
+	switch {
+	case result.Err == nil:
+		return resp
+	case errors.Is(result.Err, idasen.ErrStalled):
+		resp.Status = GroupDeskStalled
+	case errors.Is(result.Err, idasen.ErrGroupAborted):
+		resp.Status = GroupDeskAborted
+	default:
+		resp.Status = GroupDeskFailed
+	}
+
+	resp.Error = result.Err.Error()
+
+	return resp
+}
+
+func (m *MoveGroupRequest) Bind(_ *http.Request) error {
+	if (m.Height == 0) == (m.Preset == "") {
+		return ErrHeightOrPreset
+	}
+
+	return nil
+}
+
+func (m *MoveGroupResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	status := http.StatusOK
+
+	for _, desk := range m.Desks {
+		if desk.Status != GroupDeskReached {
+			status = http.StatusMultiStatus
+		}
+	}
+
+	render.Status(r, status)
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package restapi
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/history"
+	"github.com/go-chi/render"
+)
+
+const (
+	defaultHistoryWindow = 24 * time.Hour
+	minHistoryResolution = time.Second
+)
+
+type HistoryResponse struct {
+	From       time.Time        `json:"from"`
+	To         time.Time        `json:"to"`
+	Resolution string           `json:"resolution,omitempty"`
+	Samples    []history.Sample `json:"samples"`
+}
+
+var _ render.Renderer = (*HistoryResponse)(nil)
+
+func handleGetHistory(store *history.Store, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			query, err := parseHistoryQuery(r, id)
+			if err != nil {
+				return nil, api.NewErrorResponse(
+					err,
+					http.StatusBadRequest,
+					http.StatusText(http.StatusBadRequest),
+					"Invalid query",
+					nil,
+				)
+			}
+
+			samples, err := store.Query(query)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "Error reading history", slog.String("error", err.Error()))
+
+				return nil, api.NewErrorResponse(
+					err,
+					http.StatusInternalServerError,
+					http.StatusText(http.StatusInternalServerError),
+					"Failed to read history",
+					nil,
+				)
+			}
+
+			resolution := ""
+			if query.Resolution > 0 {
+				resolution = query.Resolution.String()
+			}
+
+			return &HistoryResponse{
+				From:       query.From,
+				To:         query.To,
+				Resolution: resolution,
+				Samples:    samples,
+			}, nil
+		},
+		logger,
+	)
+}
+
+func (h *HistoryResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
+
+// parseHistoryQuery reads from and to as RFC 3339 timestamps, defaulting to the last day, and resolution as a
+// duration such as 15m. Without resolution the raw samples are returned.
+func parseHistoryQuery(r *http.Request, desk string) (history.Query, error) {
+	query := r.URL.Query()
+
+	historyQuery := history.Query{
+		Desk:       desk,
+		From:       time.Time{},
+		To:         time.Now().UTC(),
+		Resolution: 0,
+	}
+
+	var err error
+
+	if to := query.Get("to"); to != "" {
+		if historyQuery.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return historyQuery, fmt.Errorf("parsing to: %w", err)
+		}
+	}
+
+	historyQuery.From = historyQuery.To.Add(-defaultHistoryWindow)
+
+	if from := query.Get("from"); from != "" {
+		if historyQuery.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return historyQuery, fmt.Errorf("parsing from: %w", err)
+		}
+	}
+
+	if !historyQuery.To.After(historyQuery.From) {
+		return historyQuery, fmt.Errorf("from %s is not before to %s", historyQuery.From, historyQuery.To)
+	}
+
+	if resolution := query.Get("resolution"); resolution != "" {
+		if historyQuery.Resolution, err = time.ParseDuration(resolution); err != nil {
+			return historyQuery, fmt.Errorf("parsing resolution: %w", err)
+		}
+
+		if historyQuery.Resolution < minHistoryResolution {
+			return historyQuery, fmt.Errorf("resolution must be at least %s", minHistoryResolution)
+		}
+	}
+
+	return historyQuery, nil
+}
@@ -0,0 +1,251 @@
+package restapi
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+var ErrLeasesDisabled = errors.New("leases are not enabled")
+
+type (
+	// LeaseRequest asks for a lease lasting Duration, such as 30m, or the default duration when empty.
+	LeaseRequest struct {
+		Duration string `json:"duration"`
+
+		duration time.Duration
+	}
+	LeaseResponse struct {
+		lease.Lease
+	}
+)
+
+var (
+	_ render.Binder   = (*LeaseRequest)(nil)
+	_ render.Renderer = (*LeaseResponse)(nil)
+)
+
+// requireLease rejects move requests with 409 while the desk is leased to someone else than the caller.
+func requireLease(store *lease.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := store.CheckMove(chi.URLParam(r, "id"), callerSubject(r))
+			if err == nil {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			if renderErr := render.Render(w, r, leaseErrorResponse(err)); renderErr != nil {
+				render.Render(w, r, api.RenderErrorResponse(renderErr)) //nolint: errcheck,gosec // ignore error
+			}
+		})
+	}
+}
+
+func handleGetLease(store *lease.Store, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			if store == nil {
+				return nil, leasesDisabledResponse()
+			}
+
+			current, ok := store.Get(id)
+			if !ok {
+				return nil, leaseErrorResponse(lease.ErrNoLease)
+			}
+
+			return &LeaseResponse{Lease: current}, nil
+		},
+		logger,
+	)
+}
+
+// handleAcquireLease leases the desk to the caller. Acquiring a desk the caller already holds renews the lease.
+func handleAcquireLease(store *lease.Store, auditLog *audit.Log, logger *slog.Logger) http.HandlerFunc {
+	return handleLeaseChange(store, auditLog, "acquire", store.Acquire, logger)
+}
+
+func handleRenewLease(store *lease.Store, auditLog *audit.Log, logger *slog.Logger) http.HandlerFunc {
+	return handleLeaseChange(store, auditLog, "renew", store.Renew, logger)
+}
+
+// handleReleaseLease ends the lease of the caller on the desk. Admins end any lease, breaking the leases of others.
+func handleReleaseLease(store *lease.Store, auditLog *audit.Log, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			if store == nil {
+				return nil, leasesDisabledResponse()
+			}
+
+			caller := callerSubject(r)
+			operation := "release"
+
+			if current, ok := store.Get(id); ok && current.Holder != caller && isAdmin(r) {
+				operation = "break"
+			}
+
+			entry := audit.NewEntry(r.Context(), audit.ActionLease, id)
+			entry.Details = map[string]any{"operation": operation}
+
+			var (
+				released lease.Lease
+				err      error
+			)
+
+			if operation == "break" {
+				released, err = store.Break(id)
+			} else {
+				released, err = store.Release(id, caller)
+			}
+
+			if err == nil {
+				entry.Details["holder"] = released.Holder
+			}
+
+			recordAudit(r.Context(), auditLog, entry.Done(err), logger)
+
+			if err != nil {
+				return nil, leaseErrorResponse(err)
+			}
+
+			logger.InfoContext(
+				r.Context(),
+				"Ended lease",
+				slog.String("desk", id),
+				slog.String("holder", released.Holder),
+				slog.String("operation", operation),
+			)
+
+			return NewOkResponse(), nil
+		},
+		logger,
+	)
+}
+
+// handleLeaseChange acquires or renews the lease of the caller on the desk with change.
+func handleLeaseChange(
+	store *lease.Store,
+	auditLog *audit.Log,
+	operation string,
+	change func(desk, holder string, duration time.Duration) (lease.Lease, error),
+	logger *slog.Logger,
+) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			if store == nil {
+				return nil, leasesDisabledResponse()
+			}
+
+			var req LeaseRequest
+			if r.ContentLength != 0 {
+				if err := render.Bind(r, &req); err != nil {
+					return nil, api.NewErrorResponse(
+						err,
+						http.StatusBadRequest,
+						http.StatusText(http.StatusBadRequest),
+						"Invalid request",
+						nil,
+					)
+				}
+			}
+
+			entry := audit.NewEntry(r.Context(), audit.ActionLease, id)
+			entry.Details = map[string]any{"operation": operation, "duration": req.Duration}
+
+			changed, err := change(id, callerSubject(r), req.duration)
+			recordAudit(r.Context(), auditLog, entry.Done(err), logger)
+
+			if err != nil {
+				return nil, leaseErrorResponse(err)
+			}
+
+			return &LeaseResponse{Lease: changed}, nil
+		},
+		logger,
+	)
+}
+
+func callerSubject(r *http.Request) string {
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+		return identity.Subject
+	}
+
+	return ""
+}
+
+func isAdmin(r *http.Request) bool {
+	identity, ok := auth.IdentityFromContext(r.Context())
+
+	return ok && identity.HasScope(auth.ScopeAdmin)
+}
+
+func leasesDisabledResponse() *api.ErrRepsonse {
+	return api.NewErrorResponse(
+		ErrLeasesDisabled,
+		http.StatusNotFound,
+		http.StatusText(http.StatusNotFound),
+		"Leases not enabled",
+		nil,
+	)
+}
+
+func leaseErrorResponse(err error) *api.ErrRepsonse {
+	status, msg := http.StatusInternalServerError, "Lease error"
+
+	switch {
+	case errors.Is(err, lease.ErrLeaseHeld):
+		status, msg = http.StatusConflict, "Desk is leased"
+	case errors.Is(err, lease.ErrNoLease):
+		status, msg = http.StatusNotFound, "Desk is not leased"
+	case errors.Is(err, lease.ErrInvalidDuration):
+		status, msg = http.StatusBadRequest, "Invalid lease duration"
+	}
+
+	return api.NewErrorResponse(err, status, http.StatusText(status), msg, nil)
+}
+
+func (l *LeaseRequest) Bind(_ *http.Request) error {
+	if l.Duration == "" {
+		return nil
+	}
+
+	duration, err := time.ParseDuration(l.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %w", err)
+	}
+
+	l.duration = duration
+
+	return nil
+}
+
+func (l *LeaseResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package restapi_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeases(t *testing.T) {
+	t.Parallel()
+
+	handler := newTestHandler(newTestServices(t))
+
+	require.Equal(t, http.StatusOK, serve(t, handler, http.MethodPost, "/v1/desk/"+desk+"/lease", "token-a", ""))
+
+	require.Equal(
+		t,
+		http.StatusConflict,
+		serve(t, handler, http.MethodPatch, "/v1/desk/"+desk, "token-b", `{"height": 7000}`),
+		"should reject moves by others while the lease is held",
+	)
+	require.Equal(t, http.StatusConflict, serve(t, handler, http.MethodPost, "/v1/desk/"+desk+"/stop", "token-b", ""))
+	require.Equal(t, http.StatusConflict, serve(t, handler, http.MethodPost, "/v1/desk/"+desk+"/lease", "token-b", ""))
+
+	// Moves that get past the lease fail to connect to the desk, as there is no bluetooth
+	require.Equal(
+		t,
+		http.StatusInternalServerError,
+		serve(t, handler, http.MethodPatch, "/v1/desk/"+desk, "token-a", `{"height": 7000}`),
+		"should let the holder move the desk",
+	)
+
+	require.Equal(t, http.StatusOK, serve(t, handler, http.MethodDelete, "/v1/desk/"+desk+"/lease", "token-a", ""))
+	require.Equal(
+		t,
+		http.StatusInternalServerError,
+		serve(t, handler, http.MethodPatch, "/v1/desk/"+desk, "token-b", `{"height": 7000}`),
+		"should let anyone move the desk once released",
+	)
+}
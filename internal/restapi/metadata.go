@@ -0,0 +1,247 @@
+package restapi
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+var (
+	ErrMissingName      = errors.New("missing name")
+	ErrHeightOrPreset   = errors.New("either height or preset is required")
+	ErrUnknownPreset    = errors.New("unknown preset")
+	ErrInvalidSlotParam = errors.New("invalid memory slot")
+)
+
+type (
+	// MetadataResponse is the name a desk advertises and the memory positions of its hand controller. Empty slots
+	// have no height.
+	MetadataResponse struct {
+		Name            string                   `json:"name"`
+		MemoryPositions []MemoryPositionResponse `json:"memory_positions"`
+	}
+	MemoryPositionResponse struct {
+		Slot   int  `json:"slot"`
+		Height *int `json:"height"`
+	}
+	RenameDeskRequest struct {
+		Name string `json:"name"`
+	}
+	NameResponse struct {
+		Name string `json:"name"`
+	}
+	// MemoryPositionRequest sets a memory position to Height or to the height of the named Preset of the desk.
+	MemoryPositionRequest struct {
+		Height int    `json:"height"`
+		Preset string `json:"preset"`
+	}
+)
+
+var (
+	_ render.Renderer = (*MetadataResponse)(nil)
+	_ render.Renderer = (*MemoryPositionResponse)(nil)
+	_ render.Renderer = (*NameResponse)(nil)
+	_ render.Binder   = (*RenameDeskRequest)(nil)
+	_ render.Binder   = (*MemoryPositionRequest)(nil)
+)
+
+func handleGetMetadata(manager *idasen.Manager, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			metadata, err := manager.ReadMetadata(r.Context(), id)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "Error reading metadata", slog.String("error", err.Error()))
+
+				return nil, metadataErrorResponse(err, "Failed to read metadata")
+			}
+
+			resp := &MetadataResponse{
+				Name:            metadata.Name,
+				MemoryPositions: make([]MemoryPositionResponse, 0, len(metadata.MemoryPositions)),
+			}
+
+			for i, height := range metadata.MemoryPositions {
+				position := MemoryPositionResponse{Slot: i + 1, Height: nil}
+				if height != 0 {
+					position.Height = &height
+				}
+
+				resp.MemoryPositions = append(resp.MemoryPositions, position)
+			}
+
+			return resp, nil
+		},
+		logger,
+	)
+}
+
+// handleRenameDesk changes the name the desk advertises, which is also the name shown by the Linak apps.
+func handleRenameDesk(manager *idasen.Manager, auditLog *audit.Log, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			var req RenameDeskRequest
+			if err := render.Bind(r, &req); err != nil {
+				return nil, api.NewErrorResponse(
+					err,
+					http.StatusBadRequest,
+					http.StatusText(http.StatusBadRequest),
+					"Invalid request",
+					nil,
+				)
+			}
+
+			entry := audit.NewEntry(r.Context(), audit.ActionConfigChange, id)
+			entry.Details = map[string]any{"operation": "rename_desk", "name": req.Name}
+
+			err := manager.Rename(r.Context(), id, req.Name)
+			recordAudit(r.Context(), auditLog, entry.Done(err), logger)
+
+			if err != nil {
+				logger.ErrorContext(r.Context(), "Error renaming desk", slog.String("error", err.Error()))
+
+				return nil, metadataErrorResponse(err, "Failed to rename desk")
+			}
+
+			return &NameResponse{Name: req.Name}, nil
+		},
+		logger,
+	)
+}
+
+// handleSetMemoryPosition stores a height in a memory slot of the hand controller, so its physical button moves the
+// desk there.
+func handleSetMemoryPosition(
+	manager *idasen.Manager,
+	desks func() config.DesksConfig,
+	auditLog *audit.Log,
+	logger *slog.Logger,
+) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			slot, err := strconv.Atoi(chi.URLParam(r, "slot"))
+			if err != nil {
+				return nil, api.NewErrorResponse(
+					fmt.Errorf("%w: %w", ErrInvalidSlotParam, err),
+					http.StatusBadRequest,
+					http.StatusText(http.StatusBadRequest),
+					"Invalid memory slot",
+					nil,
+				)
+			}
+
+			var req MemoryPositionRequest
+			if err = render.Bind(r, &req); err != nil {
+				return nil, api.NewErrorResponse(
+					err,
+					http.StatusBadRequest,
+					http.StatusText(http.StatusBadRequest),
+					"Invalid request",
+					nil,
+				)
+			}
+
+			height := req.Height
+			if req.Preset != "" {
+				var found bool
+				if height, found = desks().PresetFor(id, req.Preset); !found {
+					return nil, api.NewErrorResponse(
+						fmt.Errorf("%w: %s", ErrUnknownPreset, req.Preset),
+						http.StatusBadRequest,
+						http.StatusText(http.StatusBadRequest),
+						"Unknown preset",
+						nil,
+					)
+				}
+			}
+
+			entry := audit.NewEntry(r.Context(), audit.ActionPresetChange, id)
+			entry.ToHeight = &height
+			entry.Details = map[string]any{"operation": "set_memory_position", "slot": slot, "preset": req.Preset}
+
+			err = manager.WriteMemoryPosition(r.Context(), id, slot, height)
+			recordAudit(r.Context(), auditLog, entry.Done(err), logger)
+
+			if err != nil {
+				logger.ErrorContext(r.Context(), "Error setting memory position", slog.String("error", err.Error()))
+
+				return nil, metadataErrorResponse(err, "Failed to set memory position")
+			}
+
+			return &MemoryPositionResponse{Slot: slot, Height: &height}, nil
+		},
+		logger,
+	)
+}
+
+func metadataErrorResponse(err error, msg string) *api.ErrRepsonse {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, idasen.ErrMetadataUnsupported):
+		status, msg = http.StatusNotImplemented, "Desk does not support metadata"
+	case errors.Is(err, idasen.ErrInvalidName),
+		errors.Is(err, idasen.ErrInvalidMemorySlot),
+		errors.Is(err, idasen.ErrInvalidHeight):
+		status = http.StatusBadRequest
+	}
+
+	return api.NewErrorResponse(err, status, http.StatusText(status), msg, nil)
+}
+
+func (m *MetadataResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
+
+func (m *MemoryPositionResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
+
+func (n *NameResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
+
+func (r *RenameDeskRequest) Bind(_ *http.Request) error {
+	if r.Name == "" {
+		return ErrMissingName
+	}
+
+	return nil
+}
+
+func (m *MemoryPositionRequest) Bind(_ *http.Request) error {
+	if (m.Height == 0) == (m.Preset == "") {
+		return ErrHeightOrPreset
+	}
+
+	return nil
+}
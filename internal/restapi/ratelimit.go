@@ -0,0 +1,23 @@
+package restapi
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+)
+
+// rateLimitedResponse answers 429, telling the caller with the Retry-After header when to retry.
+func rateLimitedResponse(w http.ResponseWriter, retryAfter time.Duration, err error) *api.ErrRepsonse {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	return api.NewErrorResponse(
+		err,
+		http.StatusTooManyRequests,
+		http.StatusText(http.StatusTooManyRequests),
+		err.Error(),
+		nil,
+	)
+}
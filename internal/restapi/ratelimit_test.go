@@ -0,0 +1,39 @@
+package restapi_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMovesAreRateLimited(t *testing.T) {
+	t.Parallel()
+
+	services := newTestServices(t)
+	services.MoveLimiter = ratelimit.NewMoveLimiter(config.RateLimitConfig{
+		Token:        &config.BucketConfig{RequestsPerMinute: 1, Burst: 1},
+		Desk:         &config.BucketConfig{RequestsPerMinute: 1, Burst: 1},
+		MoveCooldown: 0,
+	})
+	handler := newTestHandler(services)
+
+	for _, body := range []string{`{"height": -1}`, `{"height": 20000}`, `{"height": `} {
+		require.Equal(t, http.StatusBadRequest, serve(t, handler, http.MethodPatch, "/v1/desk/"+desk, "token-a", body))
+	}
+
+	// Moves that get past the limits fail to connect to the desk, as there is no bluetooth
+	require.Equal(
+		t,
+		http.StatusInternalServerError,
+		serve(t, handler, http.MethodPatch, "/v1/desk/"+desk, "token-a", `{"height": 7000}`),
+		"bad requests should not consume tokens",
+	)
+	require.Equal(
+		t,
+		http.StatusTooManyRequests,
+		serve(t, handler, http.MethodPatch, "/v1/desk/"+desk, "token-a", `{"height": 7000}`),
+	)
+}
@@ -0,0 +1,240 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/reminders"
+	"github.com/go-chi/render"
+)
+
+const (
+	defaultSnoozeDuration = 15 * time.Minute
+	maxSnoozeDuration     = 24 * time.Hour
+	eventStreamKeepAlive  = 30 * time.Second
+)
+
+var (
+	ErrRemindersDisabled = errors.New("reminders are not enabled")
+	ErrStreamingDisabled = errors.New("streaming is not supported")
+)
+
+type (
+	ReminderStateResponse struct {
+		reminders.State
+	}
+	SnoozeRequest struct {
+		Duration string `json:"duration"`
+
+		duration time.Duration
+	}
+)
+
+var (
+	_ render.Renderer = (*ReminderStateResponse)(nil)
+	_ render.Binder   = (*SnoozeRequest)(nil)
+)
+
+func handleGetReminders(engine *reminders.Engine, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			if engine == nil {
+				return nil, remindersDisabledResponse()
+			}
+
+			state, err := engine.State(id)
+			if err != nil {
+				return nil, reminderErrorResponse(err)
+			}
+
+			return &ReminderStateResponse{State: state}, nil
+		},
+		logger,
+	)
+}
+
+func handleSnoozeReminders(engine *reminders.Engine, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			if engine == nil {
+				return nil, remindersDisabledResponse()
+			}
+
+			var req SnoozeRequest
+			if r.ContentLength != 0 {
+				if err := render.Bind(r, &req); err != nil {
+					return nil, api.NewErrorResponse(
+						err,
+						http.StatusBadRequest,
+						http.StatusText(http.StatusBadRequest),
+						"Invalid request",
+						nil,
+					)
+				}
+			} else {
+				req.duration = defaultSnoozeDuration
+			}
+
+			state, err := engine.Snooze(id, req.duration)
+			if err != nil {
+				return nil, reminderErrorResponse(err)
+			}
+
+			logger.InfoContext(
+				r.Context(),
+				"Snoozed reminders",
+				slog.String("desk", id),
+				slog.Duration("duration", req.duration),
+			)
+
+			return &ReminderStateResponse{State: state}, nil
+		},
+		logger,
+	)
+}
+
+// handleReminderEvents streams the reminder events of the desks the caller may access as server-sent events.
+func handleReminderEvents(broker *reminders.Broker, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if broker == nil || !ok {
+			err, msg := ErrRemindersDisabled, "Reminder events not enabled"
+			if broker != nil {
+				err, msg = ErrStreamingDisabled, "Streaming not supported"
+			}
+
+			resp := api.NewErrorResponse(err, http.StatusNotFound, http.StatusText(http.StatusNotFound), msg, nil)
+			if renderErr := render.Render(w, r, resp); renderErr != nil {
+				render.Render(w, r, api.RenderErrorResponse(renderErr)) //nolint: errcheck,gosec // ignore error
+			}
+
+			return
+		}
+
+		identity, _ := auth.IdentityFromContext(r.Context())
+
+		id, events := broker.Subscribe()
+		defer broker.Unsubscribe(id)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventStreamKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case event, open := <-events:
+				if !open {
+					return
+				}
+
+				if identity != nil && !identity.CanAccessDesk(event.Desk) {
+					continue
+				}
+
+				if err := writeEvent(w, event); err != nil {
+					logger.ErrorContext(r.Context(), "Error writing reminder event", slog.String("error", err.Error()))
+
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event reminders.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+
+	if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return fmt.Errorf("writing event: %w", err)
+	}
+
+	return nil
+}
+
+func remindersDisabledResponse() *api.ErrRepsonse {
+	return api.NewErrorResponse(
+		ErrRemindersDisabled,
+		http.StatusNotFound,
+		http.StatusText(http.StatusNotFound),
+		"Reminders not enabled",
+		nil,
+	)
+}
+
+func reminderErrorResponse(err error) *api.ErrRepsonse {
+	if errors.Is(err, reminders.ErrUnknownDesk) {
+		return api.NewErrorResponse(
+			err,
+			http.StatusNotFound,
+			http.StatusText(http.StatusNotFound),
+			"No readings for desk yet",
+			nil,
+		)
+	}
+
+	return api.NewErrorResponse(
+		err,
+		http.StatusInternalServerError,
+		http.StatusText(http.StatusInternalServerError),
+		"Failed to read reminders",
+		nil,
+	)
+}
+
+func (s *SnoozeRequest) Bind(_ *http.Request) error {
+	if s.Duration == "" {
+		s.duration = defaultSnoozeDuration
+
+		return nil
+	}
+
+	duration, err := time.ParseDuration(s.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %w", err)
+	}
+
+	if duration <= 0 || duration > maxSnoozeDuration {
+		return fmt.Errorf("duration must be positive and at most %s", maxSnoozeDuration)
+	}
+
+	s.duration = duration
+
+	return nil
+}
+
+func (s *ReminderStateResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
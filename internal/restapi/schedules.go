@@ -0,0 +1,380 @@
+package restapi
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/ratelimit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/scheduler"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+var ErrSchedulerDisabled = errors.New("scheduler is not enabled")
+
+type (
+	SchedulesResponse struct {
+		Schedules []scheduler.Status `json:"schedules"`
+	}
+	ScheduleResponse struct {
+		scheduler.Status
+
+		created bool
+	}
+	ScheduleRunResponse struct {
+		scheduler.Run
+	}
+	// ScheduleRequest creates or replaces a schedule. Its id is ignored, as it is set by the scheduler.
+	ScheduleRequest struct {
+		scheduler.Schedule
+	}
+)
+
+var (
+	_ render.Renderer = (*SchedulesResponse)(nil)
+	_ render.Renderer = (*ScheduleResponse)(nil)
+	_ render.Renderer = (*ScheduleRunResponse)(nil)
+	_ render.Binder   = (*ScheduleRequest)(nil)
+)
+
+// handleListSchedules lists the schedules targeting only desks the caller may access.
+func handleListSchedules(sched *scheduler.Scheduler, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			if sched == nil {
+				return nil, schedulerDisabledResponse()
+			}
+
+			identity, _ := auth.IdentityFromContext(r.Context())
+			schedules := []scheduler.Status{}
+
+			for _, status := range sched.List() {
+				if canAccessSchedule(identity, status.Desks) {
+					schedules = append(schedules, status)
+				}
+			}
+
+			return &SchedulesResponse{Schedules: schedules}, nil
+		},
+		logger,
+	)
+}
+
+func handleGetSchedule(sched *scheduler.Scheduler, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			status, errResp := scheduleParam(r, sched)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			return &ScheduleResponse{Status: status, created: false}, nil
+		},
+		logger,
+	)
+}
+
+// handleCreateSchedule creates a schedule. Its desks may not be leased to someone else than the caller.
+func handleCreateSchedule(
+	sched *scheduler.Scheduler,
+	leases *lease.Store,
+	desks func() config.DesksConfig,
+	auditLog *audit.Log,
+	logger *slog.Logger,
+) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			if sched == nil {
+				return nil, schedulerDisabledResponse()
+			}
+
+			req, errResp := bindSchedule(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			if errResp = checkScheduleLeases(r, leases, desks, req.Schedule); errResp != nil {
+				return nil, errResp
+			}
+
+			entry := audit.NewEntry(r.Context(), audit.ActionConfigChange, "")
+
+			status, err := sched.Create(req.Schedule)
+			entry.Details = map[string]any{"operation": "create_schedule", "schedule": status.ID}
+			recordAudit(r.Context(), auditLog, entry.Done(err), logger)
+
+			if err != nil {
+				return nil, scheduleErrorResponse(err)
+			}
+
+			return &ScheduleResponse{Status: status, created: true}, nil
+		},
+		logger,
+	)
+}
+
+// handleUpdateSchedule replaces a schedule. The desks it moves once replaced may not be leased to someone else than the
+// caller.
+func handleUpdateSchedule(
+	sched *scheduler.Scheduler,
+	leases *lease.Store,
+	desks func() config.DesksConfig,
+	auditLog *audit.Log,
+	logger *slog.Logger,
+) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			current, errResp := scheduleParam(r, sched)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			req, errResp := bindSchedule(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			if errResp = checkScheduleLeases(r, leases, desks, req.Schedule); errResp != nil {
+				return nil, errResp
+			}
+
+			entry := audit.NewEntry(r.Context(), audit.ActionConfigChange, "")
+			entry.Details = map[string]any{"operation": "update_schedule", "schedule": current.ID}
+
+			status, err := sched.Update(current.ID, req.Schedule)
+			recordAudit(r.Context(), auditLog, entry.Done(err), logger)
+
+			if err != nil {
+				return nil, scheduleErrorResponse(err)
+			}
+
+			return &ScheduleResponse{Status: status, created: false}, nil
+		},
+		logger,
+	)
+}
+
+func handleDeleteSchedule(sched *scheduler.Scheduler, auditLog *audit.Log, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			status, errResp := scheduleParam(r, sched)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			entry := audit.NewEntry(r.Context(), audit.ActionConfigChange, "")
+			entry.Details = map[string]any{"operation": "delete_schedule", "schedule": status.ID}
+
+			err := sched.Delete(status.ID)
+			recordAudit(r.Context(), auditLog, entry.Done(err), logger)
+
+			if err != nil {
+				return nil, scheduleErrorResponse(err)
+			}
+
+			return &ScheduleResponse{Status: status, created: false}, nil
+		},
+		logger,
+	)
+}
+
+// handleRunSchedule runs a schedule right away, which is handy to try it out. None of its desks may be leased to
+// someone else than the caller. The run is rate limited like a group move: it costs the caller a single token, and
+// every desk must be within its own limits.
+func handleRunSchedule(
+	sched *scheduler.Scheduler,
+	leases *lease.Store,
+	limiter *ratelimit.MoveLimiter,
+	desks func() config.DesksConfig,
+	logger *slog.Logger,
+) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(w http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			status, errResp := scheduleParam(r, sched)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			if errResp = checkScheduleLeases(r, leases, desks, status.Schedule); errResp != nil {
+				return nil, errResp
+			}
+
+			if retryAfter, err := limiter.Allow(callerSubject(r), scheduleDesks(desks, status.Schedule)...); err != nil {
+				return nil, rateLimitedResponse(w, retryAfter, err)
+			}
+
+			run, err := sched.Execute(r.Context(), status.ID)
+			if err != nil {
+				return nil, scheduleErrorResponse(err)
+			}
+
+			for _, result := range run.Results {
+				if result.Outcome != scheduler.OutcomeSkipped && motorRan(result.Err) {
+					limiter.Completed(result.Desk)
+				}
+			}
+
+			return &ScheduleRunResponse{Run: run}, nil
+		},
+		logger,
+	)
+}
+
+// scheduleParam looks up the schedule in the URL and checks that the caller may access all of its desks.
+func scheduleParam(r *http.Request, sched *scheduler.Scheduler) (scheduler.Status, *api.ErrRepsonse) {
+	if sched == nil {
+		return scheduler.Status{}, schedulerDisabledResponse() //nolint:exhaustruct // disabled
+	}
+
+	status, err := sched.Get(chi.URLParam(r, "scheduleID"))
+	if err != nil {
+		return status, scheduleErrorResponse(err)
+	}
+
+	if identity, _ := auth.IdentityFromContext(r.Context()); !canAccessSchedule(identity, status.Desks) {
+		return status, scheduleForbiddenResponse()
+	}
+
+	return status, nil
+}
+
+func bindSchedule(r *http.Request) (*ScheduleRequest, *api.ErrRepsonse) {
+	var req ScheduleRequest
+	if err := render.Bind(r, &req); err != nil {
+		return nil, api.NewErrorResponse(
+			err,
+			http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest),
+			"Invalid request",
+			nil,
+		)
+	}
+
+	if identity, _ := auth.IdentityFromContext(r.Context()); !canAccessSchedule(identity, req.Desks) {
+		return nil, scheduleForbiddenResponse()
+	}
+
+	return &req, nil
+}
+
+// checkScheduleLeases rejects schedules moving a desk leased to someone else than the caller. Schedules without desks
+// move every configured desk.
+func checkScheduleLeases(
+	r *http.Request,
+	leases *lease.Store,
+	desks func() config.DesksConfig,
+	schedule scheduler.Schedule,
+) *api.ErrRepsonse {
+	caller := callerSubject(r)
+
+	for _, id := range scheduleDesks(desks, schedule) {
+		if err := leases.CheckMove(id, caller); err != nil {
+			return leaseErrorResponse(err)
+		}
+	}
+
+	return nil
+}
+
+// scheduleDesks returns the desks the schedule moves, which are every configured desk when it has none.
+func scheduleDesks(desks func() config.DesksConfig, schedule scheduler.Schedule) []string {
+	if len(schedule.Desks) > 0 {
+		return schedule.Desks
+	}
+
+	devices := desks().Devices
+
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.ID)
+	}
+
+	return ids
+}
+
+// canAccessSchedule reports whether the identity may access every desk of a schedule. Schedules without desks
+// target every desk, so they need an identity that is not restricted to some desks.
+func canAccessSchedule(identity *auth.Identity, desks []string) bool {
+	if identity == nil {
+		return false
+	}
+
+	if len(desks) == 0 {
+		return len(identity.Desks) == 0
+	}
+
+	for _, desk := range desks {
+		if !identity.CanAccessDesk(desk) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func scheduleForbiddenResponse() *api.ErrRepsonse {
+	return api.NewErrorResponse(
+		auth.ErrForbidden,
+		http.StatusForbidden,
+		http.StatusText(http.StatusForbidden),
+		"Desk not allowed",
+		nil,
+	)
+}
+
+func schedulerDisabledResponse() *api.ErrRepsonse {
+	return api.NewErrorResponse(
+		ErrSchedulerDisabled,
+		http.StatusNotFound,
+		http.StatusText(http.StatusNotFound),
+		"Scheduler not enabled",
+		nil,
+	)
+}
+
+func scheduleErrorResponse(err error) *api.ErrRepsonse {
+	status, msg := http.StatusInternalServerError, "Failed to update schedules"
+
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		status, msg = http.StatusNotFound, "Schedule not found"
+	case errors.Is(err, scheduler.ErrInvalidSchedule):
+		status, msg = http.StatusBadRequest, "Invalid schedule"
+	case errors.Is(err, scheduler.ErrReadOnly):
+		status, msg = http.StatusConflict, "Schedule is defined in the config file"
+	}
+
+	return api.NewErrorResponse(err, status, http.StatusText(status), msg, nil)
+}
+
+func (s *ScheduleRequest) Bind(_ *http.Request) error {
+	return nil
+}
+
+func (s *SchedulesResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
+
+func (s *ScheduleResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	if s.created {
+		render.Status(r, http.StatusCreated)
+	} else {
+		render.Status(r, http.StatusOK)
+	}
+
+	return nil
+}
+
+func (s *ScheduleRunResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package restapi_test
+
+import (
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/ratelimit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/scheduler"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunScheduleIsRateLimited(t *testing.T) {
+	t.Parallel()
+
+	services := newTestServices(t)
+	services.MoveLimiter = ratelimit.NewMoveLimiter(config.RateLimitConfig{
+		Token:        &config.BucketConfig{RequestsPerMinute: 1, Burst: 1},
+		Desk:         nil,
+		MoveCooldown: 0,
+	})
+
+	sched, err := scheduler.NewScheduler(
+		config.SchedulerConfig{
+			File:         "",
+			Timezone:     "UTC",
+			ActiveWindow: time.Minute,
+			Schedules: []config.ScheduleConfig{{
+				ID:       "standup",
+				Name:     "",
+				Cron:     "0 10 * * *",
+				Timezone: "",
+				Desks:    []string{desk},
+				Height:   11000,
+				Preset:   "",
+				Disabled: false,
+			}},
+		},
+		services.Desks,
+		services.Manager,
+		nil,
+		slog.New(slog.DiscardHandler),
+	)
+	require.NoError(t, err)
+
+	services.Scheduler = sched
+	handler := newTestHandler(services)
+
+	require.Equal(t, http.StatusOK, serve(t, handler, http.MethodPost, "/v1/schedules/standup/run", "token-a", ""))
+	require.Equal(
+		t,
+		http.StatusTooManyRequests,
+		serve(t, handler, http.MethodPost, "/v1/schedules/standup/run", "token-a", ""),
+		"should charge the caller for running schedules",
+	)
+	require.Equal(t, http.StatusOK, serve(t, handler, http.MethodPost, "/v1/schedules/standup/run", "token-b", ""))
+}
@@ -5,22 +5,46 @@ import (
 	"net/http"
 
 	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/history"
 	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/ratelimit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/registry"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/reminders"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/scheduler"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
 )
 
-type Config struct {
-	Port uint
-}
+type (
+	Config struct {
+		Port uint
+	}
+	// Services are the dependencies shared by the API handlers.
+	Services struct {
+		AuthValidators []auth.Validator
+		Manager        *idasen.Manager
+		Audit          *audit.Log
+		MoveLimiter    *ratelimit.MoveLimiter
+		History        *history.Store
+		Reminders      *reminders.Engine
+		ReminderEvents *reminders.Broker
+		Scheduler      *scheduler.Scheduler
+		Webhooks       *webhooks.Dispatcher
+		Discovery      *idasen.Discovery
+		Registry       *registry.Registry
+		Desks          func() config.DesksConfig // configured and adopted desks
+		Leases         *lease.Store
+	}
+)
 
-func NewHandler(
-	authTokens []string,
-	manager *idasen.Manager,
-	logger *slog.Logger,
-) http.Handler {
+func NewHandler(services Services, logger *slog.Logger) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Recoverer)
@@ -39,7 +63,7 @@ func NewHandler(
 		render.JSON(w, r, ok)
 	}))
 
-	v1router := NewV1Router(authTokens, manager, logger)
+	v1router := NewV1Router(services, logger)
 
 	r.Mount("/v1", v1router)
 
@@ -0,0 +1,68 @@
+package restapi_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/restapi"
+)
+
+const desk = "6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10"
+
+var errNoBluetooth = errors.New("no bluetooth")
+
+// newTestServices returns services with two full access tokens, token-a for alice and token-b for bob, and a
+// manager that fails to connect to any desk.
+func newTestServices(t *testing.T) restapi.Services {
+	t.Helper()
+
+	return restapi.Services{
+		AuthValidators: []auth.Validator{auth.NewStaticTokenValidator([]config.AuthToken{
+			{Token: "token-a", Name: "alice", Scopes: nil, Desks: nil, ExpiresAt: nil, NotBefore: nil},
+			{Token: "token-b", Name: "bob", Scopes: nil, Desks: nil, ExpiresAt: nil, NotBefore: nil},
+		})},
+		Manager: idasen.NewManager(
+			t.Context(),
+			func(context.Context, string) (idasen.BTDesk, error) { return nil, errNoBluetooth },
+			slog.New(slog.DiscardHandler),
+		),
+		Audit:          nil,
+		MoveLimiter:    nil,
+		History:        nil,
+		Reminders:      nil,
+		ReminderEvents: nil,
+		Scheduler:      nil,
+		Webhooks:       nil,
+		Discovery:      nil,
+		Registry:       nil,
+		Desks:          func() config.DesksConfig { return config.DesksConfig{} }, //nolint:exhaustruct // no desks
+		Leases:         lease.NewStore(config.LeasesConfig{DefaultDuration: time.Hour, MaxDuration: time.Hour}),
+	}
+}
+
+func newTestHandler(services restapi.Services) http.Handler {
+	return restapi.NewHandler(services, slog.New(slog.DiscardHandler))
+}
+
+func serve(t *testing.T, handler http.Handler, method, path, token, body string) int {
+	t.Helper()
+
+	req := httptest.NewRequestWithContext(t.Context(), method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec.Code
+}
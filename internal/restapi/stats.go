@@ -0,0 +1,124 @@
+package restapi
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/history"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/stats"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type StatsResponse struct {
+	Period         stats.Period  `json:"period"`
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	StandThreshold int           `json:"stand_threshold"`
+	Total          stats.Summary `json:"total"`
+	Days           []stats.Day   `json:"days"`
+}
+
+var _ render.Renderer = (*StatsResponse)(nil)
+
+// handleGetStats serves the sit/stand statistics of a desk as JSON, or as CSV when requested as stats.csv.
+func handleGetStats(store *history.Store, desks func() config.DesksConfig, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp, errResp := getStats(r, store, desks())
+		if errResp != nil {
+			if renderErr := render.Render(w, r, errResp); renderErr != nil {
+				render.Render(w, r, api.RenderErrorResponse(renderErr)) //nolint: errcheck,gosec // ignore error
+			}
+
+			return
+		}
+
+		if format, _ := r.Context().Value(middleware.URLFormatCtxKey).(string); format == "csv" {
+			filename := fmt.Sprintf("%s-%s.csv", chi.URLParam(r, "id"), resp.Period)
+
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+			if err := stats.WriteCSV(w, resp.Days); err != nil {
+				logger.ErrorContext(r.Context(), "Error writing stats csv", slog.String("error", err.Error()))
+			}
+
+			return
+		}
+
+		if renderErr := render.Render(w, r, resp); renderErr != nil {
+			render.Render(w, r, api.RenderErrorResponse(renderErr)) //nolint: errcheck,gosec // ignore error
+		}
+	}
+}
+
+func getStats(r *http.Request, store *history.Store, desks config.DesksConfig) (*StatsResponse, *api.ErrRepsonse) {
+	id, errResp := deskIDParam(r)
+	if errResp != nil {
+		return nil, errResp
+	}
+
+	periodParam := r.URL.Query().Get("period")
+	if periodParam == "" {
+		periodParam = string(stats.PeriodDay)
+	}
+
+	period, err := stats.ParsePeriod(periodParam)
+	if err != nil {
+		return nil, api.NewErrorResponse(
+			err,
+			http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest),
+			"Invalid query",
+			nil,
+		)
+	}
+
+	to := time.Now()
+	from := period.Start(to)
+
+	var initial *history.Sample
+
+	last, found, err := store.Last(id, from)
+	if err == nil && found {
+		initial = &last
+	}
+
+	var samples []history.Sample
+	if err == nil {
+		samples, err = store.Query(history.Query{Desk: id, From: from, To: to, Resolution: 0})
+	}
+
+	if err != nil {
+		return nil, api.NewErrorResponse(
+			err,
+			http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError),
+			"Failed to read history",
+			nil,
+		)
+	}
+
+	threshold := desks.StandThresholdFor(id)
+	days := stats.Compute(initial, samples, from, to, threshold, store.MaxHold())
+
+	return &StatsResponse{
+		Period:         period,
+		From:           from,
+		To:             to,
+		StandThreshold: threshold,
+		Total:          stats.Total(days),
+		Days:           days,
+	}, nil
+}
+
+func (s *StatsResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
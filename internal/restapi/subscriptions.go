@@ -0,0 +1,51 @@
+package restapi
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/go-chi/render"
+)
+
+// SubscriptionsResponse lists how well every subscriber of a desk keeps up with its height updates. Lags are in
+// nanoseconds.
+type SubscriptionsResponse struct {
+	Subscriptions []idasen.SubscriptionStats `json:"subscriptions"`
+}
+
+var _ render.Renderer = (*SubscriptionsResponse)(nil)
+
+func handleGetSubscriptions(manager *idasen.Manager, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			stats, err := manager.SubscriptionStats(id)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "Error reading subscription stats", slog.String("error", err.Error()))
+
+				return nil, api.NewErrorResponse(
+					err,
+					http.StatusInternalServerError,
+					http.StatusText(http.StatusInternalServerError),
+					"Failed to read subscriptions",
+					nil,
+				)
+			}
+
+			return &SubscriptionsResponse{Subscriptions: stats}, nil
+		},
+		logger,
+	)
+}
+
+func (s *SubscriptionsResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
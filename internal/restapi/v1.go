@@ -6,29 +6,24 @@ import (
 	"net/http"
 
 	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
 	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
 	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
-	"github.com/google/uuid"
 )
 
-func NewV1Router(authTokens []string, manager *idasen.Manager, logger *slog.Logger) *chi.Mux {
+func NewV1Router(services Services, logger *slog.Logger) *chi.Mux {
 	r := chi.NewRouter()
+	manager := services.Manager
 
-	r.Use(auth.ValidateToken(authTokens))
+	r.Use(auth.Authenticate(services.AuthValidators...))
 
-	r.Get("/desk/{id}", api.HandleRendererFunc(
+	r.With(auth.RequireScope(auth.ScopeDeskRead)).Get("/desk/{id}", api.HandleRendererFunc(
 		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
-			id := chi.URLParam(r, "id")
-			if _, err := uuid.Parse(id); err != nil {
-				return nil, api.NewErrorResponse(
-					err,
-					http.StatusBadRequest,
-					http.StatusText(http.StatusBadRequest),
-					"Invalid UUID",
-					nil,
-				)
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
 			}
 
 			height, err := manager.ReadHeight(id)
@@ -49,17 +44,15 @@ func NewV1Router(authTokens []string, manager *idasen.Manager, logger *slog.Logg
 		logger,
 	))
 
-	r.Patch("/desk/{id}", api.HandleRendererFunc(
-		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
-			id := chi.URLParam(r, "id")
-			if _, err := uuid.Parse(id); err != nil {
-				return nil, api.NewErrorResponse(
-					err,
-					http.StatusBadRequest,
-					http.StatusText(http.StatusBadRequest),
-					"Invalid UUID",
-					nil,
-				)
+	r.With(
+		auth.RequireScope(auth.ScopeDeskMove),
+		requireDeskID,
+		requireLease(services.Leases),
+	).Patch("/desk/{id}", api.HandleRendererFunc(
+		func(w http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
 			}
 
 			var req MoveToRquest
@@ -73,15 +66,75 @@ func NewV1Router(authTokens []string, manager *idasen.Manager, logger *slog.Logg
 				)
 			}
 
+			// Only valid requests are charged, so limiting comes after binding
+			if retryAfter, err := services.MoveLimiter.Allow(callerSubject(r), id); err != nil {
+				return nil, rateLimitedResponse(w, retryAfter, err)
+			}
+
+			entry := audit.NewEntry(r.Context(), audit.ActionMove, id)
+			entry.ToHeight = &req.Height
+
+			if fromHeight, readErr := manager.ReadHeight(id); readErr == nil {
+				entry.FromHeight = &fromHeight
+			}
+
 			height, err := manager.MoveTo(r.Context(), id, req.Height)
+			recordAudit(r.Context(), services.Audit, entry.Done(err), logger)
+
+			if motorRan(err) {
+				services.MoveLimiter.Completed(id)
+			}
+
 			if err != nil {
 				logger.ErrorContext(r.Context(), "Error moving to height", slog.String("error", err.Error()))
 
+				status := http.StatusInternalServerError
+				if errors.Is(err, idasen.ErrShuttingDown) {
+					status = http.StatusServiceUnavailable
+				}
+
+				return nil, api.NewErrorResponse(
+					err,
+					status,
+					http.StatusText(status),
+					"Failed to move to height",
+					nil,
+				)
+			}
+
+			return NewHeightResponse(height), nil
+		},
+		logger,
+	))
+
+	r.With(
+		auth.RequireScope(auth.ScopeDeskMove),
+		requireDeskID,
+		requireLease(services.Leases),
+	).Post("/desk/{id}/stop", api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			id, errResp := deskIDParam(r)
+			if errResp != nil {
+				return nil, errResp
+			}
+
+			entry := audit.NewEntry(r.Context(), audit.ActionStop, id)
+
+			height, err := manager.Stop(r.Context(), id)
+			if err == nil {
+				entry.ToHeight = &height
+			}
+
+			recordAudit(r.Context(), services.Audit, entry.Done(err), logger)
+
+			if err != nil {
+				logger.ErrorContext(r.Context(), "Error stopping desk", slog.String("error", err.Error()))
+
 				return nil, api.NewErrorResponse(
 					err,
 					http.StatusInternalServerError,
 					http.StatusText(http.StatusInternalServerError),
-					"Failed to move to height",
+					"Failed to stop desk",
 					nil,
 				)
 			}
@@ -91,9 +144,156 @@ func NewV1Router(authTokens []string, manager *idasen.Manager, logger *slog.Logg
 		logger,
 	))
 
+	r.With(auth.RequireScope(auth.ScopeAdmin)).Get("/desk/{id}/subscriptions", handleGetSubscriptions(manager, logger))
+
+	r.With(auth.RequireScope(auth.ScopeDeskRead)).Get("/desk/{id}/lease", handleGetLease(services.Leases, logger))
+
+	r.With(auth.RequireScope(auth.ScopeDeskMove)).Post(
+		"/desk/{id}/lease",
+		handleAcquireLease(services.Leases, services.Audit, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskMove)).Put(
+		"/desk/{id}/lease",
+		handleRenewLease(services.Leases, services.Audit, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskMove)).Delete(
+		"/desk/{id}/lease",
+		handleReleaseLease(services.Leases, services.Audit, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskRead)).Get("/desk/{id}/metadata", handleGetMetadata(manager, logger))
+
+	r.With(auth.RequireScope(auth.ScopeAdmin)).Put("/desk/{id}/name", handleRenameDesk(manager, services.Audit, logger))
+
+	r.With(auth.RequireScope(auth.ScopeDeskMove)).Put(
+		"/desk/{id}/memory/{slot}",
+		handleSetMemoryPosition(manager, services.Desks, services.Audit, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskMove)).Post(
+		"/groups/{name}/move",
+		handleMoveGroup(manager, services.Desks, services.MoveLimiter, services.Leases, services.Audit, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskRead)).Get("/desk/{id}/history", handleGetHistory(services.History, logger))
+
+	r.With(auth.RequireScope(auth.ScopeDeskRead)).Get(
+		"/desk/{id}/stats",
+		handleGetStats(services.History, services.Desks, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskRead)).Get(
+		"/desk/{id}/reminders",
+		handleGetReminders(services.Reminders, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskMove)).Post(
+		"/desk/{id}/reminders/snooze",
+		handleSnoozeReminders(services.Reminders, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskRead)).Get(
+		"/reminders/events",
+		handleReminderEvents(services.ReminderEvents, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskRead)).Get("/schedules", handleListSchedules(services.Scheduler, logger))
+
+	r.With(auth.RequireScope(auth.ScopeDeskMove)).Post(
+		"/schedules",
+		handleCreateSchedule(services.Scheduler, services.Leases, services.Desks, services.Audit, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskRead)).Get(
+		"/schedules/{scheduleID}",
+		handleGetSchedule(services.Scheduler, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskMove)).Put(
+		"/schedules/{scheduleID}",
+		handleUpdateSchedule(services.Scheduler, services.Leases, services.Desks, services.Audit, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskMove)).Delete(
+		"/schedules/{scheduleID}",
+		handleDeleteSchedule(services.Scheduler, services.Audit, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeDeskMove)).Post(
+		"/schedules/{scheduleID}/run",
+		handleRunSchedule(services.Scheduler, services.Leases, services.MoveLimiter, services.Desks, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeAdmin)).Get("/audit", handleGetAudit(services.Audit, logger))
+
+	r.With(auth.RequireScope(auth.ScopeAdmin)).Get(
+		"/webhooks/deliveries",
+		handleGetDeliveries(services.Webhooks, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeAdmin)).Post(
+		"/desks",
+		handleAdoptDesk(services.Registry, services.Discovery, services.Audit, logger),
+	)
+
+	r.With(auth.RequireScope(auth.ScopeAdmin)).Get(
+		"/discovery",
+		handleGetDiscovery(services.Discovery, services.Desks, logger),
+	)
+
 	return r
 }
 
+// deskIDParam reads the desk id from the URL and checks that the caller may operate on it.
+func deskIDParam(r *http.Request) (string, *api.ErrRepsonse) {
+	id := chi.URLParam(r, "id")
+	if err := idasen.ValidateAddress(id); err != nil {
+		return "", api.NewErrorResponse(
+			err,
+			http.StatusBadRequest,
+			http.StatusText(http.StatusBadRequest),
+			"Invalid desk id",
+			nil,
+		)
+	}
+
+	if identity, ok := auth.IdentityFromContext(r.Context()); !ok || !identity.CanAccessDesk(id) {
+		return "", api.NewErrorResponse(
+			auth.ErrForbidden,
+			http.StatusForbidden,
+			http.StatusText(http.StatusForbidden),
+			"Desk not allowed",
+			nil,
+		)
+	}
+
+	return id, nil
+}
+
+// requireDeskID rejects requests for invalid or forbidden desk ids before the next handlers, such as the lease check,
+// account for them.
+func requireDeskID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, errResp := deskIDParam(r); errResp != nil {
+			if renderErr := render.Render(w, r, errResp); renderErr != nil {
+				render.Render(w, r, api.RenderErrorResponse(renderErr)) //nolint: errcheck,gosec // ignore error
+			}
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// motorRan reports whether a move that returned err drove the desk, so it has to cool down. Moves that did not reach
+// the desk, such as unknown desks, connection failures, invalid heights or moves rejected on shutdown, did not.
+func motorRan(err error) bool {
+	return err == nil || errors.Is(err, idasen.ErrCancelled) || errors.Is(err, idasen.ErrTimeout)
+}
+
 type MoveToRquest struct {
 	Height int `json:"height"`
 }
@@ -101,11 +301,7 @@ type MoveToRquest struct {
 var _ render.Binder = (*MoveToRquest)(nil)
 
 func (m *MoveToRquest) Bind(_ *http.Request) error {
-	if m.Height < 0 {
-		return errors.New("height must be greater than or equal to 0")
-	}
-
-	return nil
+	return idasen.ValidateHeight(m.Height) //nolint:wrapcheck // the error is the response
 }
 
 type HeightResponse struct {
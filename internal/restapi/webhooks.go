@@ -0,0 +1,90 @@
+package restapi
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/AlejandroHerr/go-common/pkg/api"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/webhooks"
+	"github.com/go-chi/render"
+)
+
+const (
+	defaultDeliveriesLimit = 100
+	maxDeliveriesLimit     = 1000
+)
+
+var ErrWebhooksDisabled = errors.New("webhooks are not enabled")
+
+type DeliveriesResponse struct {
+	Deliveries []webhooks.Delivery `json:"deliveries"`
+}
+
+var _ render.Renderer = (*DeliveriesResponse)(nil)
+
+func handleGetDeliveries(dispatcher *webhooks.Dispatcher, logger *slog.Logger) http.HandlerFunc {
+	return api.HandleRendererFunc(
+		func(_ http.ResponseWriter, r *http.Request) (render.Renderer, *api.ErrRepsonse) {
+			if dispatcher == nil {
+				return nil, api.NewErrorResponse(
+					ErrWebhooksDisabled,
+					http.StatusNotFound,
+					http.StatusText(http.StatusNotFound),
+					"Webhooks not enabled",
+					nil,
+				)
+			}
+
+			filter, err := parseDeliveryFilter(r)
+			if err != nil {
+				return nil, api.NewErrorResponse(
+					err,
+					http.StatusBadRequest,
+					http.StatusText(http.StatusBadRequest),
+					"Invalid query",
+					nil,
+				)
+			}
+
+			return &DeliveriesResponse{Deliveries: dispatcher.Deliveries(filter)}, nil
+		},
+		logger,
+	)
+}
+
+func parseDeliveryFilter(r *http.Request) (webhooks.DeliveryFilter, error) {
+	query := r.URL.Query()
+
+	filter := webhooks.DeliveryFilter{
+		Endpoint: query.Get("endpoint"),
+		Desk:     query.Get("desk"),
+		Status:   webhooks.DeliveryStatus(query.Get("status")),
+		Limit:    defaultDeliveriesLimit,
+	}
+
+	switch filter.Status {
+	case "", webhooks.StatusPending, webhooks.StatusDelivered, webhooks.StatusFailed:
+	default:
+		return filter, fmt.Errorf("invalid status %q", filter.Status)
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 {
+			return filter, fmt.Errorf("invalid limit %q", limit)
+		}
+
+		filter.Limit = min(filter.Limit, maxDeliveriesLimit)
+	}
+
+	return filter, nil
+}
+
+func (d *DeliveriesResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusOK)
+
+	return nil
+}
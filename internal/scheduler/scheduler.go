@@ -0,0 +1,657 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/audit"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/auth"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	SourceConfig Source = "config"
+	SourceAPI    Source = "api"
+
+	OutcomeMoved   Outcome = "moved"
+	OutcomeSkipped Outcome = "skipped"
+	OutcomeFailed  Outcome = "failed"
+
+	subjectPrefix = "scheduler:"
+)
+
+var (
+	ErrNotFound        = errors.New("schedule not found")
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	ErrReadOnly        = errors.New("schedule is defined in the config file")
+	ErrUnknownPreset   = errors.New("unknown preset")
+)
+
+type (
+	Source  string
+	Outcome string
+	// Schedule moves Desks, or every configured desk when empty, to Height or to the named Preset whenever Cron
+	// fires in Timezone.
+	Schedule struct {
+		ID       string   `json:"id"`
+		Name     string   `json:"name,omitempty"`
+		Cron     string   `json:"cron"`
+		Timezone string   `json:"timezone,omitempty"`
+		Desks    []string `json:"desks,omitempty"`
+		Height   int      `json:"height,omitempty"`
+		Preset   string   `json:"preset,omitempty"`
+		Disabled bool     `json:"disabled,omitempty"`
+	}
+	// Run is the outcome of a schedule firing, with a result per desk.
+	Run struct {
+		Time    time.Time `json:"time"`
+		Results []Result  `json:"results"`
+	}
+	// Result is the outcome of moving a desk. Err is the error the move returned, and it is not stored.
+	Result struct {
+		Desk    string  `json:"desk"`
+		Outcome Outcome `json:"outcome"`
+		Height  int     `json:"height,omitempty"`
+		Reason  string  `json:"reason,omitempty"`
+		Err     error   `json:"-"`
+	}
+	// Status is a schedule along with where it comes from and when it runs. Error explains why a stored schedule
+	// that is no longer valid is not running.
+	Status struct {
+		Schedule
+		Source  Source     `json:"source"`
+		NextRun *time.Time `json:"next_run,omitempty"`
+		LastRun *Run       `json:"last_run,omitempty"`
+		Error   string     `json:"error,omitempty"`
+	}
+	// Mover moves desks. It is implemented by idasen.Manager.
+	Mover interface {
+		MoveTo(ctx context.Context, addr string, targetHeight int) (int, error)
+		IsMoving(addr string) bool
+	}
+	// Scheduler runs the schedules defined in the config file and the ones created through the API.
+	Scheduler struct {
+		cfg       config.SchedulerConfig
+		desks     func() config.DesksConfig
+		mover     Mover
+		audit     *audit.Log
+		logger    *slog.Logger
+		options   *SchedulerOptions
+		parser    cron.Parser
+		cron      *cron.Cron
+		mutex     sync.Mutex
+		runCtx    context.Context
+		schedules map[string]*entry
+		runs      map[string]Run
+		heights   map[string]int
+		activity  map[string]time.Time
+	}
+	SchedulerOptions struct {
+		now    func() time.Time
+		leases *lease.Store
+	}
+	entry struct {
+		schedule Schedule
+		source   Source
+		spec     cron.Schedule
+		cronID   cron.EntryID
+		err      error
+	}
+	SchedulerOption func(*SchedulerOptions)
+)
+
+// NewScheduler loads the stored schedules and registers them along with the ones in cfg. Invalid schedules in cfg
+// are an error, while invalid stored schedules are kept but do not run. Schedules without desks move every desk
+// returned by desks when they run, including the ones adopted since the scheduler started.
+func NewScheduler(
+	cfg config.SchedulerConfig,
+	desks func() config.DesksConfig,
+	mover Mover,
+	auditLog *audit.Log,
+	logger *slog.Logger,
+	opts ...SchedulerOption,
+) (*Scheduler, error) {
+	options := &SchedulerOptions{
+		now:    time.Now,
+		leases: nil,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+	s := &Scheduler{
+		cfg:       cfg,
+		desks:     desks,
+		mover:     mover,
+		audit:     auditLog,
+		logger:    logger.With("component", "scheduler"),
+		options:   options,
+		parser:    parser,
+		cron:      cron.New(cron.WithParser(parser)),
+		mutex:     sync.Mutex{},
+		runCtx:    context.Background(),
+		schedules: map[string]*entry{},
+		runs:      map[string]Run{},
+		heights:   map[string]int{},
+		activity:  map[string]time.Time{},
+	}
+
+	for _, scheduleCfg := range cfg.Schedules {
+		schedule := Schedule(scheduleCfg)
+
+		if schedule.ID == "" {
+			return nil, fmt.Errorf("%w: schedules in the config file need an id", ErrInvalidSchedule)
+		}
+
+		if _, exists := s.schedules[schedule.ID]; exists {
+			return nil, fmt.Errorf("%w: duplicated id %q", ErrInvalidSchedule, schedule.ID)
+		}
+
+		if err := s.add(schedule, SourceConfig); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", schedule.ID, err)
+		}
+	}
+
+	if cfg.File == "" {
+		return s, nil
+	}
+
+	stored, err := loadState(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, schedule := range stored.Schedules {
+		if err = s.add(schedule, SourceAPI); err != nil {
+			s.logger.Error(
+				"Stored schedule is no longer valid",
+				slog.String("id", schedule.ID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	for id, run := range stored.Runs {
+		if _, ok := s.schedules[id]; ok {
+			s.runs[id] = run
+		}
+	}
+
+	return s, nil
+}
+
+// Run runs the schedules until ctx is done, then waits for the running ones to finish.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mutex.Lock()
+	s.runCtx = ctx
+	s.mutex.Unlock()
+
+	s.cron.Start()
+
+	<-ctx.Done()
+
+	<-s.cron.Stop().Done()
+}
+
+// Observe takes a height reading of a desk. Height changes mark the desk as in use. It does not block, so it can be
+// used as a height observer.
+func (s *Scheduler) Observe(desk string, height int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if previous, ok := s.heights[desk]; ok && previous != height {
+		s.activity[desk] = s.options.now()
+	}
+
+	s.heights[desk] = height
+}
+
+// List returns every schedule sorted by id.
+func (s *Scheduler) List() []Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statuses := make([]Status, 0, len(s.schedules))
+	for id := range s.schedules {
+		statuses = append(statuses, s.status(id))
+	}
+
+	slices.SortFunc(statuses, func(a, b Status) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return statuses
+}
+
+func (s *Scheduler) Get(id string) (Status, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.schedules[id]; !ok {
+		return Status{}, ErrNotFound //nolint:exhaustruct // not found
+	}
+
+	return s.status(id), nil
+}
+
+// Create adds a schedule with a new id and stores it.
+func (s *Scheduler) Create(schedule Schedule) (Status, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	schedule.ID = uuid.NewString()
+
+	if err := s.add(schedule, SourceAPI); err != nil {
+		s.remove(schedule.ID)
+
+		return Status{}, err //nolint:exhaustruct // invalid
+	}
+
+	if err := s.save(); err != nil {
+		s.remove(schedule.ID)
+
+		return Status{}, err //nolint:exhaustruct // not stored
+	}
+
+	return s.status(schedule.ID), nil
+}
+
+// Update replaces a schedule created through the API.
+func (s *Scheduler) Update(id string, schedule Schedule) (Status, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous, err := s.modifiable(id)
+	if err != nil {
+		return Status{}, err //nolint:exhaustruct // not modifiable
+	}
+
+	schedule.ID = id
+
+	if err = s.validate(schedule); err != nil {
+		return Status{}, err //nolint:exhaustruct // invalid
+	}
+
+	s.remove(id)
+
+	if err = s.add(schedule, SourceAPI); err == nil {
+		err = s.save()
+	}
+
+	if err != nil {
+		s.remove(id)
+		s.add(previous.schedule, previous.source) //nolint:errcheck,gosec // it was registered before
+
+		return Status{}, err //nolint:exhaustruct // not stored
+	}
+
+	return s.status(id), nil
+}
+
+// Delete removes a schedule created through the API.
+func (s *Scheduler) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous, err := s.modifiable(id)
+	if err != nil {
+		return err
+	}
+
+	run, hasRun := s.runs[id]
+
+	s.remove(id)
+	delete(s.runs, id)
+
+	if err = s.save(); err != nil {
+		s.add(previous.schedule, previous.source) //nolint:errcheck,gosec // it was registered before
+
+		if hasRun {
+			s.runs[id] = run
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Execute runs a schedule right away, whether it is disabled or not, and records its results.
+func (s *Scheduler) Execute(ctx context.Context, id string) (Run, error) {
+	s.mutex.Lock()
+
+	scheduled, ok := s.schedules[id]
+	if !ok {
+		s.mutex.Unlock()
+
+		return Run{}, ErrNotFound //nolint:exhaustruct // not found
+	}
+
+	schedule := scheduled.schedule
+	s.mutex.Unlock()
+
+	desks := schedule.Desks
+	if len(desks) == 0 {
+		desks = s.configuredDesks()
+	}
+
+	run := Run{Time: s.options.now(), Results: make([]Result, len(desks))}
+
+	var wg sync.WaitGroup
+
+	for i, desk := range desks {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			run.Results[i] = s.moveDesk(ctx, schedule, desk)
+		}()
+	}
+
+	wg.Wait()
+
+	s.logger.InfoContext(ctx, "Ran schedule", slog.String("id", id), slog.Any("results", run.Results))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok = s.schedules[id]; ok {
+		s.runs[id] = run
+
+		if err := s.save(); err != nil {
+			s.logger.ErrorContext(ctx, "Error storing schedule run", slog.String("error", err.Error()))
+		}
+	}
+
+	return run, nil
+}
+
+func (s *Scheduler) moveDesk(ctx context.Context, schedule Schedule, desk string) Result {
+	result := Result{Desk: desk, Outcome: OutcomeMoved, Height: schedule.Height, Reason: "", Err: nil}
+
+	if schedule.Preset != "" {
+		height, ok := s.desks().PresetFor(desk, schedule.Preset)
+		if !ok {
+			result.Outcome = OutcomeFailed
+			result.Err = fmt.Errorf("%w: %s", ErrUnknownPreset, schedule.Preset)
+			result.Reason = result.Err.Error()
+
+			return result
+		}
+
+		result.Height = height
+	}
+
+	if reason := s.inUse(desk); reason != "" {
+		result.Outcome = OutcomeSkipped
+		result.Reason = reason
+
+		return result
+	}
+
+	subject := subjectPrefix + schedule.ID
+
+	if err := s.options.leases.CheckMove(desk, subject); err != nil {
+		result.Outcome = OutcomeSkipped
+		result.Reason = err.Error()
+
+		return result
+	}
+
+	ctx = auth.WithIdentity(ctx, &auth.Identity{
+		Subject: subject,
+		Scopes:  []string{auth.ScopeDeskMove},
+		Desks:   []string{desk},
+	})
+
+	entry := audit.NewEntry(ctx, audit.ActionMove, desk)
+	entry.ToHeight = &result.Height
+	entry.Details = map[string]any{"schedule": schedule.ID}
+
+	_, err := s.mover.MoveTo(ctx, desk, result.Height)
+
+	if auditErr := s.audit.Record(entry.Done(err)); auditErr != nil {
+		s.logger.ErrorContext(ctx, "Error recording audit entry", slog.String("error", auditErr.Error()))
+	}
+
+	// The move itself is not use of the desk
+	s.mutex.Lock()
+	delete(s.activity, desk)
+	s.mutex.Unlock()
+
+	if err != nil {
+		result.Outcome = OutcomeFailed
+		result.Reason = err.Error()
+		result.Err = err
+	}
+
+	return result
+}
+
+// inUse returns why the desk is considered in use, or an empty string when it is not.
+func (s *Scheduler) inUse(desk string) string {
+	if s.mover.IsMoving(desk) {
+		return "desk is moving"
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if last, ok := s.activity[desk]; ok && s.options.now().Sub(last) < s.cfg.ActiveWindow {
+		return fmt.Sprintf("desk moved at %s", last.Format(time.RFC3339))
+	}
+
+	return ""
+}
+
+// add registers a schedule, running it unless it is disabled. Invalid schedules are registered without running so
+// they can still be listed. The caller must hold the mutex, except during construction.
+func (s *Scheduler) add(schedule Schedule, source Source) error {
+	scheduled := &entry{schedule: schedule, source: source, spec: nil, cronID: 0, err: nil}
+	s.schedules[schedule.ID] = scheduled
+
+	if err := s.validate(schedule); err != nil {
+		scheduled.err = err
+
+		return err
+	}
+
+	spec, err := s.parse(schedule)
+	if err != nil {
+		scheduled.err = err
+
+		return err
+	}
+
+	scheduled.spec = spec
+
+	if !schedule.Disabled {
+		id := schedule.ID
+		scheduled.cronID = s.cron.Schedule(spec, cron.FuncJob(func() {
+			if _, runErr := s.Execute(s.context(), id); runErr != nil {
+				s.logger.Error("Error running schedule", slog.String("id", id), slog.String("error", runErr.Error()))
+			}
+		}))
+	}
+
+	return nil
+}
+
+// remove unregisters a schedule. The caller must hold the mutex.
+func (s *Scheduler) remove(id string) {
+	scheduled, ok := s.schedules[id]
+	if !ok {
+		return
+	}
+
+	if scheduled.cronID != 0 {
+		s.cron.Remove(scheduled.cronID)
+	}
+
+	delete(s.schedules, id)
+}
+
+// modifiable returns the schedule if it exists and was created through the API. The caller must hold the mutex.
+func (s *Scheduler) modifiable(id string) (*entry, error) {
+	scheduled, ok := s.schedules[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if scheduled.source != SourceAPI {
+		return nil, ErrReadOnly
+	}
+
+	return scheduled, nil
+}
+
+func (s *Scheduler) validate(schedule Schedule) error {
+	if (schedule.Height > 0) == (schedule.Preset != "") {
+		return fmt.Errorf("%w: set either a height or a preset", ErrInvalidSchedule)
+	}
+
+	if schedule.Height < 0 {
+		return fmt.Errorf("%w: height must be positive", ErrInvalidSchedule)
+	}
+
+	for _, desk := range schedule.Desks {
+		if err := idasen.ValidateAddress(desk); err != nil {
+			return fmt.Errorf("%w: invalid desk %q", ErrInvalidSchedule, desk)
+		}
+	}
+
+	if schedule.Preset == "" {
+		return nil
+	}
+
+	desks := schedule.Desks
+	if len(desks) == 0 {
+		desks = s.configuredDesks()
+	}
+
+	for _, desk := range desks {
+		if _, ok := s.desks().PresetFor(desk, schedule.Preset); !ok {
+			return fmt.Errorf("%w: %w %q for desk %s", ErrInvalidSchedule, ErrUnknownPreset, schedule.Preset, desk)
+		}
+	}
+
+	return nil
+}
+
+//nolint:ireturn // cron schedules are interfaces
+func (s *Scheduler) parse(schedule Schedule) (cron.Schedule, error) {
+	if schedule.Cron == "" || strings.Contains(schedule.Cron, "TZ=") {
+		return nil, fmt.Errorf("%w: cron must be set, with the timezone set apart", ErrInvalidSchedule)
+	}
+
+	timezone := schedule.Timezone
+	if timezone == "" {
+		timezone = s.cfg.Timezone
+	}
+
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchedule, err)
+	}
+
+	spec, err := s.parser.Parse("CRON_TZ=" + timezone + " " + schedule.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchedule, err)
+	}
+
+	return spec, nil
+}
+
+// status builds the Status of a schedule. The caller must hold the mutex.
+func (s *Scheduler) status(id string) Status {
+	scheduled := s.schedules[id]
+
+	status := Status{
+		Schedule: scheduled.schedule,
+		Source:   scheduled.source,
+		NextRun:  nil,
+		LastRun:  nil,
+		Error:    "",
+	}
+
+	if scheduled.err != nil {
+		status.Error = scheduled.err.Error()
+	}
+
+	if scheduled.cronID != 0 {
+		next := scheduled.spec.Next(s.options.now())
+		status.NextRun = &next
+	}
+
+	if run, ok := s.runs[id]; ok {
+		status.LastRun = &run
+	}
+
+	return status
+}
+
+// save stores the schedules created through the API and the runs. The caller must hold the mutex.
+func (s *Scheduler) save() error {
+	if s.cfg.File == "" {
+		return nil
+	}
+
+	saved := state{Schedules: []Schedule{}, Runs: s.runs}
+
+	for _, scheduled := range s.schedules {
+		if scheduled.source == SourceAPI {
+			saved.Schedules = append(saved.Schedules, scheduled.schedule)
+		}
+	}
+
+	slices.SortFunc(saved.Schedules, func(a, b Schedule) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return saveState(s.cfg.File, saved)
+}
+
+func (s *Scheduler) configuredDesks() []string {
+	devices := s.desks().Devices
+
+	desks := make([]string, 0, len(devices))
+	for _, desk := range devices {
+		desks = append(desks, desk.ID)
+	}
+
+	return desks
+}
+
+func (s *Scheduler) context() context.Context {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.runCtx
+}
+
+// SchedulerOptionsWithLeases skips the desks leased to someone, as schedules never hold leases.
+func SchedulerOptionsWithLeases(leases *lease.Store) SchedulerOption {
+	return func(o *SchedulerOptions) {
+		o.leases = leases
+	}
+}
+
+// SchedulerOptionsWithClock sets the function returning the current time.
+func SchedulerOptionsWithClock(now func() time.Time) SchedulerOption {
+	return func(o *SchedulerOptions) {
+		o.now = now
+	}
+}
@@ -0,0 +1,236 @@
+package scheduler_test
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/lease"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/scheduler"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	officeDesk  = "6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10"
+	meetingDesk = "0b9c7c1e-3c4f-4d8a-9a55-7a1f0e2d3c4b"
+)
+
+type fakeMover struct {
+	mutex  sync.Mutex
+	moves  map[string]int
+	moving map[string]bool
+}
+
+func newFakeMover() *fakeMover {
+	return &fakeMover{mutex: sync.Mutex{}, moves: map[string]int{}, moving: map[string]bool{}}
+}
+
+func (m *fakeMover) MoveTo(_ context.Context, addr string, targetHeight int) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.moves[addr] = targetHeight
+
+	return targetHeight, nil
+}
+
+func (m *fakeMover) IsMoving(addr string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.moving[addr]
+}
+
+func testDesks() config.DesksConfig {
+	return config.DesksConfig{
+		IdleTimeout:    0,
+		StandThreshold: config.DefaultStandThreshold,
+		Presets:        map[string]int{"cleaning": 12000},
+		Devices: []config.DeskConfig{
+			{ID: officeDesk, Name: "office", IdleTimeout: nil, StandThreshold: 0, SittingGoal: 0, Presets: nil, Adapter: ""},
+			{ID: meetingDesk, Name: "meeting", IdleTimeout: nil, StandThreshold: 0, SittingGoal: 0, Presets: nil, Adapter: ""},
+		},
+		Groups: nil,
+	}
+}
+
+func newTestScheduler(
+	t *testing.T,
+	file string,
+	mover scheduler.Mover,
+	now func() time.Time,
+	opts ...scheduler.SchedulerOption,
+) *scheduler.Scheduler {
+	t.Helper()
+
+	sched, err := scheduler.NewScheduler(
+		config.SchedulerConfig{
+			File:         file,
+			Timezone:     "UTC",
+			ActiveWindow: 10 * time.Minute,
+			Schedules: []config.ScheduleConfig{{
+				ID:       "cleaning",
+				Name:     "Cleaning",
+				Cron:     "0 19 * * *",
+				Timezone: "Europe/Madrid",
+				Desks:    nil,
+				Height:   0,
+				Preset:   "cleaning",
+				Disabled: false,
+			}},
+		},
+		testDesks,
+		mover,
+		nil,
+		slog.New(slog.DiscardHandler),
+		append(opts, scheduler.SchedulerOptionsWithClock(now))...,
+	)
+	require.NoError(t, err)
+
+	return sched
+}
+
+func TestScheduler(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	t.Run("computes the next run in the schedule timezone", func(t *testing.T) {
+		t.Parallel()
+
+		sched := newTestScheduler(t, "", newFakeMover(), clock)
+
+		status, err := sched.Get("cleaning")
+		require.NoError(t, err)
+		require.Equal(t, scheduler.SourceConfig, status.Source)
+		require.Equal(t, time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC), status.NextRun.UTC())
+	})
+
+	t.Run("moves every desk to the preset and skips the ones in use", func(t *testing.T) {
+		t.Parallel()
+
+		mover := newFakeMover()
+		mover.moving[meetingDesk] = true
+
+		sched := newTestScheduler(t, "", mover, clock)
+
+		run, err := sched.Execute(t.Context(), "cleaning")
+		require.NoError(t, err)
+		require.Equal(t, []scheduler.Result{
+			{Desk: officeDesk, Outcome: scheduler.OutcomeMoved, Height: 12000, Reason: "", Err: nil},
+			{Desk: meetingDesk, Outcome: scheduler.OutcomeSkipped, Height: 12000, Reason: "desk is moving", Err: nil},
+		}, run.Results)
+		require.Equal(t, map[string]int{officeDesk: 12000}, mover.moves)
+	})
+
+	t.Run("skips desks that moved recently", func(t *testing.T) {
+		t.Parallel()
+
+		mover := newFakeMover()
+		sched := newTestScheduler(t, "", mover, clock)
+
+		sched.Observe(officeDesk, 7000)
+		sched.Observe(officeDesk, 7500)
+		sched.Observe(meetingDesk, 7000)
+
+		run, err := sched.Execute(t.Context(), "cleaning")
+		require.NoError(t, err)
+		require.Equal(t, scheduler.OutcomeSkipped, run.Results[0].Outcome)
+		require.Equal(t, scheduler.OutcomeMoved, run.Results[1].Outcome, "a first reading is not use")
+	})
+
+	t.Run("skips leased desks", func(t *testing.T) {
+		t.Parallel()
+
+		leases := lease.NewStore(
+			config.LeasesConfig{DefaultDuration: time.Hour, MaxDuration: time.Hour},
+			lease.StoreOptionsWithClock(clock),
+		)
+		_, err := leases.Acquire(meetingDesk, "alice", 0)
+		require.NoError(t, err)
+
+		mover := newFakeMover()
+		sched := newTestScheduler(t, "", mover, clock, scheduler.SchedulerOptionsWithLeases(leases))
+
+		run, err := sched.Execute(t.Context(), "cleaning")
+		require.NoError(t, err)
+		require.Equal(t, scheduler.OutcomeMoved, run.Results[0].Outcome)
+		require.Equal(t, scheduler.OutcomeSkipped, run.Results[1].Outcome)
+		require.Contains(t, run.Results[1].Reason, lease.ErrLeaseHeld.Error())
+		require.Equal(t, map[string]int{officeDesk: 12000}, mover.moves)
+	})
+
+	t.Run("validates schedules", func(t *testing.T) {
+		t.Parallel()
+
+		sched := newTestScheduler(t, "", newFakeMover(), clock)
+
+		for name, schedule := range map[string]scheduler.Schedule{
+			"cron":     {Cron: "61 * * * *", Height: 7000},
+			"timezone": {Cron: "0 14 * * *", Timezone: "Mars/Olympus", Height: 7000},
+			"target":   {Cron: "0 14 * * *", Height: 7000, Preset: "cleaning"},
+			"preset":   {Cron: "0 14 * * *", Preset: "unknown"},
+			"desk":     {Cron: "0 14 * * *", Desks: []string{"office"}, Height: 7000},
+		} {
+			_, err := sched.Create(schedule)
+			require.ErrorIs(t, err, scheduler.ErrInvalidSchedule, name)
+		}
+
+		require.Len(t, sched.List(), 1, "should not keep invalid schedules")
+	})
+
+	t.Run("schedules in the config file are read only", func(t *testing.T) {
+		t.Parallel()
+
+		sched := newTestScheduler(t, "", newFakeMover(), clock)
+
+		require.ErrorIs(t, sched.Delete("cleaning"), scheduler.ErrReadOnly)
+		require.ErrorIs(t, sched.Delete("unknown"), scheduler.ErrNotFound)
+	})
+
+	t.Run("survives restarts", func(t *testing.T) {
+		t.Parallel()
+
+		file := filepath.Join(t.TempDir(), "schedules.json")
+		sched := newTestScheduler(t, file, newFakeMover(), clock)
+
+		created, err := sched.Create(scheduler.Schedule{ //nolint:exhaustruct // defaults
+			Name:   "Afternoon",
+			Cron:   "0 14 * * 1-5",
+			Desks:  []string{officeDesk},
+			Height: 11000,
+		})
+		require.NoError(t, err)
+		require.Equal(t, scheduler.SourceAPI, created.Source)
+
+		updated, err := sched.Update(created.ID, scheduler.Schedule{ //nolint:exhaustruct // defaults
+			Name:   "Afternoon",
+			Cron:   "30 14 * * 1-5",
+			Desks:  []string{officeDesk},
+			Height: 11000,
+		})
+		require.NoError(t, err)
+		require.Equal(t, time.Date(2025, 3, 10, 14, 30, 0, 0, time.UTC), updated.NextRun.UTC())
+
+		_, err = sched.Execute(t.Context(), created.ID)
+		require.NoError(t, err)
+
+		restarted := newTestScheduler(t, file, newFakeMover(), clock)
+
+		status, err := restarted.Get(created.ID)
+		require.NoError(t, err)
+		require.Equal(t, "30 14 * * 1-5", status.Cron)
+		require.NotNil(t, status.LastRun)
+		require.Equal(t, scheduler.OutcomeMoved, status.LastRun.Results[0].Outcome)
+
+		require.NoError(t, restarted.Delete(created.ID))
+
+		restarted = newTestScheduler(t, file, newFakeMover(), clock)
+		require.Len(t, restarted.List(), 1, "should only keep the config schedule")
+	})
+}
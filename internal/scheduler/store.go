@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const filePermissions = 0o600
+
+// state is what the scheduler keeps across restarts: the schedules created through the API and the last run of
+// every schedule.
+type state struct {
+	Schedules []Schedule     `json:"schedules"`
+	Runs      map[string]Run `json:"runs"`
+}
+
+func loadState(file string) (state, error) {
+	loaded := state{Schedules: []Schedule{}, Runs: map[string]Run{}}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return loaded, nil
+	}
+
+	if err != nil {
+		return loaded, fmt.Errorf("reading schedules: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &loaded); err != nil {
+		return loaded, fmt.Errorf("decoding schedules: %w", err)
+	}
+
+	if loaded.Runs == nil {
+		loaded.Runs = map[string]Run{}
+	}
+
+	return loaded, nil
+}
+
+// saveState writes the state to a temporary file first, so a crash never leaves a truncated file behind.
+func saveState(file string, saved state) error {
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding schedules: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating schedules file: %w", err)
+	}
+
+	defer os.Remove(tmp.Name()) //nolint:errcheck // already renamed on success
+
+	if err = tmp.Chmod(filePermissions); err == nil {
+		_, err = tmp.Write(data)
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("writing schedules: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("replacing schedules file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package stats
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/history"
+)
+
+const (
+	PeriodDay   Period = "day"
+	PeriodWeek  Period = "week"
+	PeriodMonth Period = "month"
+
+	PositionSitting  Position = "sitting"
+	PositionStanding Position = "standing"
+
+	dateLayout = "2006-01-02"
+)
+
+var ErrInvalidPeriod = errors.New("invalid period, must be day, week or month")
+
+type (
+	Period   string
+	Position string
+	// Summary is how a desk was used over some time. Streaks are clipped to the day they happen in.
+	Summary struct {
+		SittingSeconds        int64 `json:"sitting_seconds"`
+		StandingSeconds       int64 `json:"standing_seconds"`
+		Transitions           int   `json:"transitions"`
+		LongestSittingSeconds int64 `json:"longest_sitting_streak_seconds"`
+	}
+	Day struct {
+		Date string `json:"date"`
+		Summary
+	}
+)
+
+func ParsePeriod(period string) (Period, error) {
+	switch p := Period(period); p {
+	case PeriodDay, PeriodWeek, PeriodMonth:
+		return p, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidPeriod, period)
+	}
+}
+
+// Start returns the beginning of the calendar period containing now, in the location of now. Weeks start on Monday.
+func (p Period) Start(now time.Time) time.Time {
+	year, month, day := now.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+
+	switch p {
+	case PeriodWeek:
+		daysSinceMonday := (int(midnight.Weekday()) + 6) % 7 //nolint:mnd // days in a week
+
+		return midnight.AddDate(0, 0, -daysSinceMonday)
+	case PeriodMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+	case PeriodDay:
+		return midnight
+	}
+
+	return midnight
+}
+
+func Classify(height, standThreshold int) Position {
+	if height >= standThreshold {
+		return PositionStanding
+	}
+
+	return PositionSitting
+}
+
+// Compute accumulates the statistics of every calendar day in [from, to), in the location of from. Each sample holds
+// until the next one, or for maxHold at most, as a desk that does not move for longer is likely left alone; a zero
+// maxHold does not bound it. initial is the last sample before from. The time the position of the desk is unknown,
+// before the first sample without initial or once a sample stops holding, is not counted.
+func Compute(
+	initial *history.Sample,
+	samples []history.Sample,
+	from, to time.Time,
+	standThreshold int,
+	maxHold time.Duration,
+) []Day {
+	acc := newAccumulator(from, to)
+
+	var (
+		current *Position
+		since   time.Time
+	)
+
+	if initial != nil {
+		position := Classify(initial.Height, standThreshold)
+		current = &position
+		since = initial.Time
+	}
+
+	cursor := from
+
+	for _, sample := range samples {
+		if sample.Time.Before(from) || !sample.Time.Before(to) {
+			continue
+		}
+
+		end := holdEnd(since, sample.Time, maxHold)
+		acc.add(current, cursor, end)
+
+		if end.Before(sample.Time) {
+			current = nil
+			acc.add(current, end, sample.Time)
+		}
+
+		position := Classify(sample.Height, standThreshold)
+		if current != nil && *current != position {
+			acc.day(sample.Time).Transitions++
+		}
+
+		current = &position
+		since = sample.Time
+		cursor = sample.Time
+	}
+
+	acc.add(current, cursor, holdEnd(since, to, maxHold))
+
+	return acc.result()
+}
+
+// holdEnd returns when a sample taken at since stops holding, which is next at the latest.
+func holdEnd(since, next time.Time, maxHold time.Duration) time.Time {
+	if maxHold > 0 && since.Add(maxHold).Before(next) {
+		return since.Add(maxHold)
+	}
+
+	return next
+}
+
+// Total sums the statistics of the given days.
+func Total(days []Day) Summary {
+	var total Summary
+
+	for _, day := range days {
+		total.SittingSeconds += day.SittingSeconds
+		total.StandingSeconds += day.StandingSeconds
+		total.Transitions += day.Transitions
+		total.LongestSittingSeconds = max(total.LongestSittingSeconds, day.LongestSittingSeconds)
+	}
+
+	return total
+}
+
+func WriteCSV(w io.Writer, days []Day) error {
+	writer := csv.NewWriter(w)
+
+	records := [][]string{{
+		"date",
+		"sitting_seconds",
+		"standing_seconds",
+		"transitions",
+		"longest_sitting_streak_seconds",
+	}}
+
+	for _, day := range days {
+		records = append(records, []string{
+			day.Date,
+			strconv.FormatInt(day.SittingSeconds, 10),
+			strconv.FormatInt(day.StandingSeconds, 10),
+			strconv.Itoa(day.Transitions),
+			strconv.FormatInt(day.LongestSittingSeconds, 10),
+		})
+	}
+
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("writing csv: %w", err)
+	}
+
+	return nil
+}
+
+type (
+	accumulator struct {
+		location  *time.Location
+		days      []Day
+		durations []dayDurations
+		index     map[string]int
+		streak    time.Duration
+		streakDay int
+	}
+	// dayDurations are kept apart from Day so rounding to seconds happens once.
+	dayDurations struct {
+		sitting        time.Duration
+		standing       time.Duration
+		longestSitting time.Duration
+	}
+)
+
+func newAccumulator(from, to time.Time) *accumulator {
+	acc := &accumulator{
+		location:  from.Location(),
+		days:      []Day{},
+		durations: []dayDurations{},
+		index:     map[string]int{},
+		streak:    0,
+		streakDay: -1,
+	}
+
+	for day := startOfDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dateLayout)
+		acc.index[date] = len(acc.days)
+		acc.days = append(acc.days, Day{Date: date, Summary: Summary{}})
+		acc.durations = append(acc.durations, dayDurations{sitting: 0, standing: 0, longestSitting: 0})
+	}
+
+	return acc
+}
+
+func (a *accumulator) dayIndex(t time.Time) int {
+	return a.index[t.In(a.location).Format(dateLayout)]
+}
+
+func (a *accumulator) day(t time.Time) *Day {
+	return &a.days[a.dayIndex(t)]
+}
+
+func (a *accumulator) result() []Day {
+	for i, durations := range a.durations {
+		a.days[i].SittingSeconds = int64(durations.sitting.Seconds())
+		a.days[i].StandingSeconds = int64(durations.standing.Seconds())
+		a.days[i].LongestSittingSeconds = int64(durations.longestSitting.Seconds())
+	}
+
+	return a.days
+}
+
+// add accounts [start, end) in the given position, splitting it at midnight. Time in an unknown position is not
+// accounted, but breaks the sitting streak.
+func (a *accumulator) add(position *Position, start, end time.Time) {
+	if position == nil {
+		a.streak = 0
+
+		return
+	}
+
+	for start.Before(end) {
+		chunkEnd := startOfDay(start.In(a.location)).AddDate(0, 0, 1)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+
+		index := a.dayIndex(start)
+		day := &a.durations[index]
+		duration := chunkEnd.Sub(start)
+
+		if *position == PositionSitting {
+			if a.streakDay != index {
+				a.streak = 0
+				a.streakDay = index
+			}
+
+			a.streak += duration
+			day.sitting += duration
+			day.longestSitting = max(day.longestSitting, a.streak)
+		} else {
+			a.streak = 0
+			day.standing += duration
+		}
+
+		start = chunkEnd
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,142 @@
+package stats_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/history"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/stats"
+	"github.com/stretchr/testify/require"
+)
+
+const threshold = 9500
+
+func sample(at time.Time, height int) history.Sample {
+	return history.Sample{Time: at, Height: height, Min: 0, Max: 0, Count: 0}
+}
+
+func TestCompute(t *testing.T) {
+	t.Parallel()
+
+	from := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 2)
+	at := func(day, hour, minute int) time.Time {
+		return from.Add(time.Duration(day*24+hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	t.Run("accumulates time, transitions and streaks per day", func(t *testing.T) {
+		t.Parallel()
+
+		initial := sample(from.Add(-time.Hour), 7000)
+		samples := []history.Sample{
+			sample(at(0, 9, 0), 7200),   // still sitting
+			sample(at(0, 10, 0), 11000), // stand
+			sample(at(0, 10, 30), 7000), // sit
+			sample(at(1, 1, 0), 11000),  // stand after midnight
+		}
+
+		days := stats.Compute(&initial, samples, from, to, threshold, 0)
+
+		require.Equal(t, []stats.Day{
+			{
+				Date: "2025-03-10",
+				Summary: stats.Summary{
+					SittingSeconds:        int64((10*time.Hour + 13*time.Hour + 30*time.Minute).Seconds()),
+					StandingSeconds:       int64((30 * time.Minute).Seconds()),
+					Transitions:           2,
+					LongestSittingSeconds: int64((13*time.Hour + 30*time.Minute).Seconds()),
+				},
+			},
+			{
+				Date: "2025-03-11",
+				Summary: stats.Summary{
+					SittingSeconds:        int64(time.Hour.Seconds()),
+					StandingSeconds:       int64((23 * time.Hour).Seconds()),
+					Transitions:           1,
+					LongestSittingSeconds: int64(time.Hour.Seconds()),
+				},
+			},
+		}, days)
+
+		total := stats.Total(days)
+		require.Equal(t, 3, total.Transitions)
+		require.Equal(t, int64((48 * time.Hour).Seconds()), total.SittingSeconds+total.StandingSeconds)
+	})
+
+	t.Run("does not count time before the first known position", func(t *testing.T) {
+		t.Parallel()
+
+		days := stats.Compute(nil, []history.Sample{sample(at(1, 12, 0), 11000)}, from, to, threshold, 0)
+
+		require.Equal(t, stats.Summary{}, days[0].Summary)
+		require.Equal(t, int64((12 * time.Hour).Seconds()), days[1].StandingSeconds)
+		require.Equal(t, 0, days[1].Transitions)
+	})
+
+	t.Run("does not count overnight gaps", func(t *testing.T) {
+		t.Parallel()
+
+		initial := sample(from.Add(-time.Hour), 7000)
+		samples := []history.Sample{
+			sample(at(0, 8, 0), 11000), // stand in the morning
+			sample(at(0, 9, 0), 7000),  // sit until leaving
+			sample(at(1, 9, 0), 7000),  // sit the next morning
+			sample(at(1, 10, 0), 11000),
+		}
+
+		days := stats.Compute(&initial, samples, from, to, threshold, 4*time.Hour)
+
+		// The initial sample holds until 03:00, so standing up at 08:00 is not a transition
+		require.Equal(t, []stats.Day{
+			{
+				Date: "2025-03-10",
+				Summary: stats.Summary{
+					SittingSeconds:        int64((3*time.Hour + 4*time.Hour).Seconds()),
+					StandingSeconds:       int64(time.Hour.Seconds()),
+					Transitions:           1,
+					LongestSittingSeconds: int64((4 * time.Hour).Seconds()),
+				},
+			},
+			{
+				Date: "2025-03-11",
+				Summary: stats.Summary{
+					SittingSeconds:        int64(time.Hour.Seconds()),
+					StandingSeconds:       int64((4 * time.Hour).Seconds()),
+					Transitions:           1,
+					LongestSittingSeconds: int64(time.Hour.Seconds()),
+				},
+			},
+		}, days)
+	})
+}
+
+func TestPeriodStart(t *testing.T) {
+	t.Parallel()
+
+	// A Wednesday
+	now := time.Date(2025, 3, 12, 15, 4, 5, 0, time.UTC)
+
+	require.Equal(t, time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC), stats.PeriodDay.Start(now))
+	require.Equal(t, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), stats.PeriodWeek.Start(now))
+	require.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), stats.PeriodMonth.Start(now))
+
+	_, err := stats.ParsePeriod("year")
+	require.ErrorIs(t, err, stats.ErrInvalidPeriod)
+}
+
+func TestWriteCSV(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	err := stats.WriteCSV(&buf, []stats.Day{{
+		Date:    "2025-03-10",
+		Summary: stats.Summary{SittingSeconds: 3600, StandingSeconds: 1800, Transitions: 2, LongestSittingSeconds: 2400},
+	}})
+	require.NoError(t, err)
+	require.Equal(t,
+		"date,sitting_seconds,standing_seconds,transitions,longest_sitting_streak_seconds\n2025-03-10,3600,1800,2,2400\n",
+		buf.String(),
+	)
+}
@@ -0,0 +1,439 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/stats"
+	"github.com/google/uuid"
+)
+
+const (
+	// EventPositionChanged is sent when a desk goes from sitting to standing position or the other way around.
+	EventPositionChanged idasen.EventType = "position_changed"
+
+	SignatureHeader = "X-Idasen-Signature"
+	TimestampHeader = "X-Idasen-Timestamp"
+	EventHeader     = "X-Idasen-Event"
+	DeliveryHeader  = "X-Idasen-Delivery"
+
+	StatusPending   DeliveryStatus = "pending"
+	StatusDelivered DeliveryStatus = "delivered"
+	StatusFailed    DeliveryStatus = "failed"
+
+	queueSize  = 64
+	maxBackoff = time.Minute
+)
+
+var (
+	ErrUnknownEvent = errors.New("unknown webhook event")
+	ErrQueueFull    = errors.New("webhook queue is full")
+	ErrStatus       = errors.New("webhook returned an error status")
+)
+
+type (
+	DeliveryStatus string
+	// Payload is the JSON body sent to the endpoints.
+	Payload struct {
+		ID               string           `json:"id"`
+		Type             idasen.EventType `json:"type"`
+		Desk             string           `json:"desk"`
+		Time             time.Time        `json:"time"`
+		Height           int              `json:"height,omitempty"`
+		TargetHeight     int              `json:"target_height,omitempty"`
+		Position         stats.Position   `json:"position,omitempty"`
+		PreviousPosition stats.Position   `json:"previous_position,omitempty"`
+		Error            string           `json:"error,omitempty"`
+	}
+	// Delivery is the state of sending an event to an endpoint.
+	Delivery struct {
+		ID         string         `json:"id"`
+		Endpoint   string         `json:"endpoint"`
+		Event      Payload        `json:"event"`
+		Status     DeliveryStatus `json:"status"`
+		Attempts   int            `json:"attempts"`
+		StatusCode int            `json:"status_code,omitempty"`
+		Error      string         `json:"error,omitempty"`
+		CreatedAt  time.Time      `json:"created_at"`
+		UpdatedAt  time.Time      `json:"updated_at"`
+	}
+	// DeliveryFilter selects deliveries. Zero values match everything, and a zero Limit returns every delivery.
+	DeliveryFilter struct {
+		Endpoint string
+		Desk     string
+		Status   DeliveryStatus
+		Limit    int
+	}
+	// Dispatcher turns desk events into webhook deliveries, sent in the background by a worker per endpoint.
+	Dispatcher struct {
+		desks      func() config.DesksConfig
+		endpoints  []*endpoint
+		logSize    int
+		logger     *slog.Logger
+		options    *DispatcherOptions
+		mutex      sync.Mutex
+		positions  map[string]stats.Position
+		deliveries []*Delivery
+	}
+	DispatcherOptions struct {
+		client *http.Client
+	}
+	DispatcherOption func(*DispatcherOptions)
+	endpoint         struct {
+		cfg   config.WebhookEndpointConfig
+		queue chan *Delivery
+	}
+)
+
+// NewDispatcher creates a dispatcher classifying the position of the desks with the stand thresholds returned by
+// desks.
+func NewDispatcher(
+	cfg config.WebhooksConfig,
+	desks func() config.DesksConfig,
+	logger *slog.Logger,
+	opts ...DispatcherOption,
+) (*Dispatcher, error) {
+	options := &DispatcherOptions{
+		client: &http.Client{}, //nolint:exhaustruct // timeouts are set per endpoint
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	endpoints := make([]*endpoint, 0, len(cfg.Endpoints))
+
+	for _, endpointCfg := range cfg.Endpoints {
+		for _, event := range endpointCfg.Events {
+			if !slices.Contains(Events(), idasen.EventType(event)) {
+				return nil, fmt.Errorf("%w %q for endpoint %s", ErrUnknownEvent, event, endpointCfg.ID)
+			}
+		}
+
+		endpoints = append(endpoints, &endpoint{cfg: endpointCfg, queue: make(chan *Delivery, queueSize)})
+	}
+
+	return &Dispatcher{
+		desks:      desks,
+		endpoints:  endpoints,
+		logSize:    cfg.DeliveryLogSize,
+		logger:     logger.With("component", "webhooks"),
+		options:    options,
+		mutex:      sync.Mutex{},
+		positions:  map[string]stats.Position{},
+		deliveries: []*Delivery{},
+	}, nil
+}
+
+// Events returns every event that can be sent.
+func Events() []idasen.EventType {
+	return []idasen.EventType{
+		idasen.EventMoveStarted,
+		idasen.EventTargetReached,
+		idasen.EventMoveFailed,
+		idasen.EventMoveTimedOut,
+		idasen.EventMoveCancelled,
+		idasen.EventConnected,
+		idasen.EventDisconnected,
+		idasen.EventAppeared,
+		idasen.EventDisappeared,
+		EventPositionChanged,
+	}
+}
+
+// Sign returns the signature of a payload sent at the given Unix time, as found in the SignatureHeader. Receivers
+// verify it by computing the same HMAC with their copy of the secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// HandleEvent queues a desk event for the endpoints interested in it. It does not block, so it can be used as an
+// event observer.
+func (d *Dispatcher) HandleEvent(event idasen.Event) {
+	payload := Payload{
+		ID:               uuid.NewString(),
+		Type:             event.Type,
+		Desk:             event.Desk,
+		Time:             event.Time,
+		Height:           event.Height,
+		TargetHeight:     event.TargetHeight,
+		Position:         "",
+		PreviousPosition: "",
+		Error:            "",
+	}
+
+	if event.Err != nil {
+		payload.Error = event.Err.Error()
+	}
+
+	d.dispatch(payload)
+}
+
+// Observe takes a height reading of a desk and sends EventPositionChanged when it crosses the stand threshold. It
+// does not block, so it can be used as a height observer.
+func (d *Dispatcher) Observe(desk string, height int) {
+	position := stats.Classify(height, d.desks().StandThresholdFor(desk))
+
+	d.mutex.Lock()
+	previous, known := d.positions[desk]
+	d.positions[desk] = position
+	d.mutex.Unlock()
+
+	if !known || previous == position {
+		return
+	}
+
+	d.dispatch(Payload{
+		ID:               uuid.NewString(),
+		Type:             EventPositionChanged,
+		Desk:             desk,
+		Time:             time.Now(),
+		Height:           height,
+		TargetHeight:     0,
+		Position:         position,
+		PreviousPosition: previous,
+		Error:            "",
+	})
+}
+
+// Run sends the queued deliveries until ctx is done. Deliveries still queued then are not sent.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, ep := range d.endpoints {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case delivery := <-ep.queue:
+					d.deliver(ctx, ep, delivery)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Deliveries returns the deliveries matching the filter, newest first.
+func (d *Dispatcher) Deliveries(filter DeliveryFilter) []Delivery {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	deliveries := []Delivery{}
+
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		delivery := d.deliveries[i]
+
+		if (filter.Endpoint != "" && delivery.Endpoint != filter.Endpoint) ||
+			(filter.Desk != "" && delivery.Event.Desk != filter.Desk) ||
+			(filter.Status != "" && delivery.Status != filter.Status) {
+			continue
+		}
+
+		deliveries = append(deliveries, *delivery)
+
+		if filter.Limit > 0 && len(deliveries) == filter.Limit {
+			break
+		}
+	}
+
+	return deliveries
+}
+
+func (d *Dispatcher) dispatch(payload Payload) {
+	for _, ep := range d.endpoints {
+		if !ep.wants(payload) {
+			continue
+		}
+
+		delivery := d.record(ep, payload)
+
+		select {
+		case ep.queue <- delivery:
+		default:
+			d.logger.Warn("Dropping webhook delivery", slog.String("endpoint", ep.cfg.ID))
+			d.update(delivery, func(delivery *Delivery) {
+				delivery.Status = StatusFailed
+				delivery.Error = ErrQueueFull.Error()
+			})
+		}
+	}
+}
+
+// deliver sends a delivery, retrying with exponential backoff on network errors, 429 and 5xx responses.
+func (d *Dispatcher) deliver(ctx context.Context, ep *endpoint, delivery *Delivery) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		d.update(delivery, func(delivery *Delivery) {
+			delivery.Status = StatusFailed
+			delivery.Error = err.Error()
+		})
+
+		return
+	}
+
+	backoff := ep.cfg.RetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		statusCode, sendErr := d.send(ctx, ep, delivery, body)
+
+		status := StatusDelivered
+		if sendErr != nil {
+			status = StatusFailed
+			if attempt < ep.cfg.MaxAttempts && retryable(statusCode) {
+				status = StatusPending
+			}
+		}
+
+		d.update(delivery, func(delivery *Delivery) {
+			delivery.Attempts = attempt
+			delivery.Status = status
+			delivery.StatusCode = statusCode
+			delivery.Error = ""
+
+			if sendErr != nil {
+				delivery.Error = sendErr.Error()
+			}
+		})
+
+		if status != StatusPending {
+			if status == StatusFailed {
+				d.logger.WarnContext(
+					ctx,
+					"Webhook delivery failed",
+					slog.String("endpoint", ep.cfg.ID),
+					slog.String("delivery", delivery.ID),
+					slog.Int("attempts", attempt),
+					slog.String("error", sendErr.Error()),
+				)
+			}
+
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, ep *endpoint, delivery *Delivery, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ep.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
+	}
+
+	for key, value := range ep.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(delivery.Event.Type))
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+
+	if ep.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(ep.cfg.Secret, timestamp, body))
+	}
+
+	resp, err := d.options.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("posting event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return resp.StatusCode, fmt.Errorf("%w: %s", ErrStatus, resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// record adds a pending delivery to the log, dropping the oldest one when the log is full.
+func (d *Dispatcher) record(ep *endpoint, payload Payload) *Delivery {
+	now := time.Now()
+
+	delivery := &Delivery{
+		ID:         uuid.NewString(),
+		Endpoint:   ep.cfg.ID,
+		Event:      payload,
+		Status:     StatusPending,
+		Attempts:   0,
+		StatusCode: 0,
+		Error:      "",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.logSize > 0 && len(d.deliveries) >= d.logSize {
+		d.deliveries = slices.Delete(d.deliveries, 0, len(d.deliveries)-d.logSize+1)
+	}
+
+	d.deliveries = append(d.deliveries, delivery)
+
+	return delivery
+}
+
+func (d *Dispatcher) update(delivery *Delivery, apply func(*Delivery)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	apply(delivery)
+	delivery.UpdatedAt = time.Now()
+}
+
+func (e *endpoint) wants(payload Payload) bool {
+	if len(e.cfg.Events) > 0 && !slices.Contains(e.cfg.Events, string(payload.Type)) {
+		return false
+	}
+
+	return len(e.cfg.Desks) == 0 || slices.Contains(e.cfg.Desks, payload.Desk)
+}
+
+// retryable reports whether a failed attempt may succeed later. Status 0 means the request did not get a response.
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// DispatcherOptionsWithClient sets the HTTP client used to send the deliveries.
+func DispatcherOptionsWithClient(client *http.Client) DispatcherOption {
+	return func(o *DispatcherOptions) {
+		o.client = client
+	}
+}
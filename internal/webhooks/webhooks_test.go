@@ -0,0 +1,226 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlejandroHerr/go-idasen-desk/internal/config"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/idasen"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/stats"
+	"github.com/AlejandroHerr/go-idasen-desk/internal/webhooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testDesk   = "6f4a1e9e-1f0b-4a55-9d8e-0c6b2d6f6f10"
+	testSecret = "s3cr3t"
+)
+
+var errTest = errors.New("bluetooth error")
+
+// receiver is an endpoint answering with the given status codes in order, and 200 once they run out.
+type receiver struct {
+	t        *testing.T
+	url      string
+	mutex    sync.Mutex
+	statuses []int
+	payloads []webhooks.Payload
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+
+	rc := &receiver{t: t, url: "", mutex: sync.Mutex{}, statuses: statuses, payloads: nil}
+
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	rc.url = server.URL
+
+	return rc
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	assert.NoError(rc.t, err)
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(webhooks.TimestampHeader), 10, 64)
+	assert.NoError(rc.t, err)
+	assert.Equal(rc.t, webhooks.Sign(testSecret, timestamp, body), r.Header.Get(webhooks.SignatureHeader))
+
+	var payload webhooks.Payload
+	assert.NoError(rc.t, json.Unmarshal(body, &payload))
+	assert.Equal(rc.t, string(payload.Type), r.Header.Get(webhooks.EventHeader))
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.payloads = append(rc.payloads, payload)
+
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() []webhooks.Payload {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return append([]webhooks.Payload(nil), rc.payloads...)
+}
+
+func newTestDispatcher(t *testing.T, url string, events ...string) *webhooks.Dispatcher {
+	t.Helper()
+
+	dispatcher, err := webhooks.NewDispatcher(
+		config.WebhooksConfig{
+			DeliveryLogSize: 10,
+			Endpoints: []config.WebhookEndpointConfig{{
+				ID:           "chat",
+				URL:          url,
+				Secret:       testSecret,
+				Events:       events,
+				Desks:        nil,
+				Headers:      nil,
+				Timeout:      time.Second,
+				MaxAttempts:  3,
+				RetryBackoff: time.Millisecond,
+			}},
+		},
+		func() config.DesksConfig {
+			return config.DesksConfig{
+				IdleTimeout:    0,
+				StandThreshold: config.DefaultStandThreshold,
+				Presets:        nil,
+				Devices:        nil,
+				Groups:         nil,
+			}
+		},
+		slog.New(slog.DiscardHandler),
+	)
+	require.NoError(t, err)
+
+	go dispatcher.Run(t.Context())
+
+	return dispatcher
+}
+
+func waitForDelivery(t *testing.T, dispatcher *webhooks.Dispatcher, status webhooks.DeliveryStatus) webhooks.Delivery {
+	t.Helper()
+
+	var deliveries []webhooks.Delivery
+
+	require.Eventually(t, func() bool {
+		deliveries = dispatcher.Deliveries(webhooks.DeliveryFilter{Endpoint: "", Desk: "", Status: status, Limit: 0})
+
+		return len(deliveries) == 1
+	}, time.Second, time.Millisecond)
+
+	return deliveries[0]
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+
+	t.Run("delivers signed events after retrying", func(t *testing.T) {
+		t.Parallel()
+
+		rc := newReceiver(t, http.StatusBadGateway)
+
+		dispatcher := newTestDispatcher(t, rc.url)
+		dispatcher.HandleEvent(idasen.Event{
+			Type:         idasen.EventMoveTimedOut,
+			Desk:         testDesk,
+			Time:         time.Now(),
+			Height:       9000,
+			TargetHeight: 11000,
+			Err:          idasen.ErrTimeout,
+		})
+
+		delivery := waitForDelivery(t, dispatcher, webhooks.StatusDelivered)
+		require.Equal(t, 2, delivery.Attempts)
+		require.Equal(t, http.StatusOK, delivery.StatusCode)
+
+		received := rc.received()
+		require.Len(t, received, 2)
+		require.Equal(t, idasen.EventMoveTimedOut, received[1].Type)
+		require.Equal(t, 11000, received[1].TargetHeight)
+		require.Equal(t, idasen.ErrTimeout.Error(), received[1].Error)
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		t.Parallel()
+
+		rc := newReceiver(t, http.StatusBadRequest)
+
+		dispatcher := newTestDispatcher(t, rc.url)
+		dispatcher.HandleEvent(idasen.Event{
+			Type:         idasen.EventMoveFailed,
+			Desk:         testDesk,
+			Time:         time.Now(),
+			Height:       9000,
+			TargetHeight: 11000,
+			Err:          errTest,
+		})
+
+		delivery := waitForDelivery(t, dispatcher, webhooks.StatusFailed)
+		require.Equal(t, 1, delivery.Attempts)
+		require.Equal(t, http.StatusBadRequest, delivery.StatusCode)
+	})
+
+	t.Run("sends position changes to subscribed endpoints", func(t *testing.T) {
+		t.Parallel()
+
+		rc := newReceiver(t)
+
+		dispatcher := newTestDispatcher(t, rc.url, string(webhooks.EventPositionChanged))
+
+		dispatcher.HandleEvent(idasen.Event{
+			Type:         idasen.EventConnected,
+			Desk:         testDesk,
+			Time:         time.Now(),
+			Height:       7000,
+			TargetHeight: 0,
+			Err:          nil,
+		})
+		dispatcher.Observe(testDesk, 7000)
+		dispatcher.Observe(testDesk, 8000)
+		dispatcher.Observe(testDesk, 11000)
+
+		delivery := waitForDelivery(t, dispatcher, webhooks.StatusDelivered)
+		require.Equal(t, webhooks.EventPositionChanged, delivery.Event.Type)
+		require.Equal(t, stats.PositionStanding, delivery.Event.Position)
+		require.Equal(t, stats.PositionSitting, delivery.Event.PreviousPosition)
+
+		deliveries := dispatcher.Deliveries(webhooks.DeliveryFilter{Endpoint: "", Desk: "", Status: "", Limit: 0})
+		require.Len(t, deliveries, 1, "should skip other events")
+	})
+
+	t.Run("rejects unknown events", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := webhooks.NewDispatcher(
+			config.WebhooksConfig{
+				DeliveryLogSize: 10,
+				Endpoints: []config.WebhookEndpointConfig{
+					{ID: "chat", Events: []string{"exploded"}}, //nolint:exhaustruct // invalid
+				},
+			},
+			nil, // unused
+			slog.New(slog.DiscardHandler),
+		)
+		require.ErrorIs(t, err, webhooks.ErrUnknownEvent)
+	})
+}